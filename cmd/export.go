@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	EXPORT_PATH = "/v1/export"
+	// Trailers of an export: the cursor resuming it after the last vote sent, and the reason it
+	// stopped early, since the status code was already sent
+	EXPORT_CURSOR_TRAILER = "X-Export-Cursor"
+	EXPORT_ERROR_TRAILER  = "X-Export-Error"
+)
+
+// Writes the chunks of ExportVotes to the HTTP response, the in-process gateway can't serve
+// streaming RPCs
+type exportStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	w       http.ResponseWriter
+	format  pb.ExportFormat
+	started bool
+	cursor  string
+}
+
+func (s *exportStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *exportStream) SetHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *exportStream) SendHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *exportStream) SetTrailer(metadata.MD) {}
+
+// Sends the headers of the download, once the request was found valid
+func (s *exportStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	header := s.w.Header()
+	if s.format == pb.ExportFormat_EXPORT_FORMAT_NDJSON {
+		header.Set("Content-Type", "application/x-ndjson")
+		header.Set("Content-Disposition", `attachment; filename="votes.ndjson"`)
+	} else {
+		header.Set("Content-Type", "text/csv; charset=utf-8")
+		header.Set("Content-Disposition", `attachment; filename="votes.csv"`)
+	}
+	header.Set("Trailer", EXPORT_CURSOR_TRAILER+", "+EXPORT_ERROR_TRAILER)
+	s.w.WriteHeader(http.StatusOK)
+}
+
+func (s *exportStream) Send(chunk *pb.ExportVotesResponse) error {
+	s.start()
+	if _, err := s.w.Write(chunk.GetData()); err != nil {
+		return err
+	}
+	s.cursor = chunk.GetCursor()
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// Lets the query use short values, such as format=ndjson and direction=up, besides the enum names
+func normalizeExportQuery(r *http.Request) url.Values {
+	query := r.URL.Query()
+	for key, prefix := range map[string]string{"format": "EXPORT_FORMAT_", "direction": "DIRECTION_"} {
+		value := strings.ToUpper(query.Get(key))
+		if _, err := strconv.Atoi(value); err == nil || value == "" || strings.HasPrefix(value, prefix) {
+			continue
+		}
+		query.Set(key, prefix+value)
+	}
+	return query
+}
+
+// Route streaming an export of votes as a file, filtered by the same query parameters as ExportVotes
+func exportHandler(mux *runtime.ServeMux, s rpc.Server) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		_, outboundMarshaler := runtime.MarshalerForRequest(mux, r)
+		ctx, err := runtime.AnnotateIncomingContext(r.Context(), mux, r, "/proto.Vote/ExportVotes", runtime.WithHTTPPathPattern(EXPORT_PATH))
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outboundMarshaler, w, r, err)
+			return
+		}
+		req := &pb.ExportVotesRequest{}
+		if err := runtime.PopulateQueryParameters(req, normalizeExportQuery(r), &utilities.DoubleArray{}); err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, r, status.Error(codes.InvalidArgument, err.Error()))
+			return
+		}
+		stream := &exportStream{ctx: ctx, w: w, format: req.Format, cursor: req.Cursor}
+		err = s.ExportVotes(req, stream)
+		if err != nil && !stream.started {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, r, err)
+			return
+		}
+		stream.start()
+		if err != nil {
+			w.Header().Set(EXPORT_ERROR_TRAILER, status.Convert(err).Message())
+		}
+		w.Header().Set(EXPORT_CURSOR_TRAILER, stream.cursor)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Exports two chunks, then fails if fail is set
+type fakeExportServer struct {
+	rpc.Server
+	request *pb.ExportVotesRequest
+	tenant  []string
+	fail    error
+}
+
+func (s *fakeExportServer) ExportVotes(req *pb.ExportVotesRequest, stream pb.Vote_ExportVotesServer) error {
+	s.request = req
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	s.tenant = md.Get("x-tenant-id")
+	if req.User == "invalid" {
+		return status.Error(codes.InvalidArgument, "invalid user")
+	}
+	stream.Send(&pb.ExportVotesResponse{Data: []byte("line 1\n"), Votes: 1, Cursor: "cursor-1"})
+	stream.Send(&pb.ExportVotesResponse{Data: []byte("line 2\n"), Votes: 1, Cursor: "cursor-2"})
+	return s.fail
+}
+
+func export(s *fakeExportServer, target string) *httptest.ResponseRecorder {
+	mux := newGatewayMux()
+	mux.HandlePath(http.MethodGet, EXPORT_PATH, exportHandler(mux, s))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("X-Tenant-Id", "acme")
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestExportHandler(t *testing.T) {
+	s := &fakeExportServer{}
+	w := export(s, "/v1/export?video=v&format=ndjson&direction=up&created_from=2021-12-01T00:00:00Z&cursor=start")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="votes.ndjson"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "line 1\nline 2\n", w.Body.String())
+	assert.Equal(t, "cursor-2", w.Result().Trailer.Get(EXPORT_CURSOR_TRAILER))
+	assert.Equal(t, "v", s.request.Video)
+	assert.Equal(t, pb.ExportFormat_EXPORT_FORMAT_NDJSON, s.request.Format)
+	assert.Equal(t, pb.Direction_DIRECTION_UP, s.request.Direction)
+	assert.Equal(t, int64(1638316800), s.request.CreatedFrom.GetSeconds())
+	assert.Equal(t, "start", s.request.Cursor)
+	assert.Equal(t, []string{"acme"}, s.tenant, "The tenant header should be forwarded")
+
+	w = export(&fakeExportServer{}, "/v1/export")
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"), "CSV should be the default format")
+}
+
+func TestExportHandlerErrors(t *testing.T) {
+	w := export(&fakeExportServer{}, "/v1/export?user=invalid")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Invalid requests should fail before the download starts")
+
+	w = export(&fakeExportServer{}, "/v1/export?format=xml")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = export(&fakeExportServer{fail: status.Error(codes.Unavailable, "database unreachable")}, "/v1/export")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "database unreachable", w.Result().Trailer.Get(EXPORT_ERROR_TRAILER))
+	assert.Equal(t, "cursor-2", w.Result().Trailer.Get(EXPORT_CURSOR_TRAILER), "The export should be resumable after the last chunk sent")
+}
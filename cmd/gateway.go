@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	"github.com/IsaqueB/ps-klever/pkg/logging"
+	"github.com/IsaqueB/ps-klever/pkg/metrics"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"github.com/IsaqueB/ps-klever/pkg/tracing"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// HTTP headers forwarded to the servers as metadata, besides the ones forwarded by default
+var forwardedHeaders = map[string]string{
+	http.CanonicalHeaderKey(tenant.METADATA_KEY):          tenant.METADATA_KEY,
+	http.CanonicalHeaderKey(rpc.IDEMPOTENCY_METADATA_KEY): rpc.IDEMPOTENCY_METADATA_KEY,
+	http.CanonicalHeaderKey(rpc.IF_MATCH_METADATA_KEY):    rpc.IF_MATCH_METADATA_KEY,
+	logging.REQUEST_ID_HEADER:                             logging.REQUEST_ID_METADATA_KEY,
+}
+
+// Create the mux of the HTTP gateway
+func newGatewayMux() *runtime.ServeMux {
+	return runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(headerMatcher),
+		runtime.WithForwardResponseOption(setETag),
+		runtime.WithErrorHandler(errorHandler),
+		runtime.WithMetadata(metrics.RouteAnnotator),
+		runtime.WithMetadata(tracing.RouteAnnotator),
+	)
+}
+
+func headerMatcher(key string) (string, bool) {
+	if metadataKey, ok := forwardedHeaders[http.CanonicalHeaderKey(key)]; ok {
+		return metadataKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// Responses carrying the version of a vote send it as ETag, to be used in If-Match
+func setETag(ctx context.Context, w http.ResponseWriter, message proto.Message) error {
+	var version int64
+	switch response := message.(type) {
+	case *pb.GetResponse:
+		version = response.GetVote().GetVersion()
+	case *pb.UpdateOneResponse:
+		version = response.GetVersion()
+	}
+	if version > 0 {
+		w.Header().Set("ETag", rpc.ETag(version))
+	}
+	return nil
+}
+
+// Writes a different status code than the default one
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(int) {
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+// Same as the default error handler, except that writes to a vote which doesn't match the
+// If-Match header or the expected version answer 412 Precondition Failed
+func errorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if status.Code(err) == codes.FailedPrecondition {
+		w = &statusWriter{ResponseWriter: w, code: http.StatusPreconditionFailed}
+	}
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHeaderMatcher(t *testing.T) {
+	for header, expected := range map[string]string{
+		"X-Tenant-Id":     "x-tenant-id",
+		"idempotency-key": "idempotency-key",
+		"If-Match":        "if-match",
+		"X-Request-Id":    "x-request-id",
+	} {
+		key, ok := headerMatcher(header)
+		assert.True(t, ok, "%s should be forwarded", header)
+		assert.Equal(t, expected, key)
+	}
+	_, ok := headerMatcher("X-Not-Forwarded")
+	assert.False(t, ok)
+}
+
+func TestSetETag(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := setETag(context.Background(), w, &pb.GetResponse{Vote: &pb.VoteStruct{Version: 3}}); err != nil {
+		t.Fatalf("Error in setETag. %v", err)
+	}
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	if err := setETag(context.Background(), w, &pb.InsertResponse{Id: "id"}); err != nil {
+		t.Fatalf("Error in setETag. %v", err)
+	}
+	assert.Equal(t, "", w.Header().Get("ETag"), "Responses without version should not have an ETag")
+}
+
+func TestErrorHandler(t *testing.T) {
+	mux := runtime.NewServeMux()
+	r := httptest.NewRequest(http.MethodPut, "/v1", nil)
+	w := httptest.NewRecorder()
+	errorHandler(context.Background(), mux, &runtime.JSONPb{}, w, r, status.Error(codes.FailedPrecondition, "mismatch"))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = httptest.NewRecorder()
+	errorHandler(context.Background(), mux, &runtime.JSONPb{}, w, r, status.Error(codes.NotFound, "not found"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
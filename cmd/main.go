@@ -2,52 +2,189 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	"github.com/IsaqueB/ps-klever/pkg/auth"
+	"github.com/IsaqueB/ps-klever/pkg/cache"
+	"github.com/IsaqueB/ps-klever/pkg/chaos"
 	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/health"
+	"github.com/IsaqueB/ps-klever/pkg/logging"
+	"github.com/IsaqueB/ps-klever/pkg/metrics"
+	"github.com/IsaqueB/ps-klever/pkg/migrations"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"github.com/IsaqueB/ps-klever/pkg/tracing"
+	"github.com/IsaqueB/ps-klever/pkg/wal"
 	pb "github.com/IsaqueB/ps-klever/proto"
-	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.mongodb.org/mongo-driver/event"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 )
 
+const (
+	// Time between reporting the server as not ready and stopping it, for load balancers to notice
+	DEFAULT_SHUTDOWN_DRAIN = 5 * time.Second
+	// Time the requests being handled have to finish once the server stops
+	DEFAULT_SHUTDOWN_TIMEOUT = 30 * time.Second
+	// Shortest time allowed between the keepalive pings of a client, less than the default of
+	// the Go client. Clients pinging more often are disconnected
+	KEEPALIVE_MIN_TIME = 20 * time.Second
+	// Prefix of the routes of the Admin service in the gateway
+	ADMIN_PATH = "/v1/admin/"
+)
+
+// Logger of the API, injected into the servers
+var logger = zap.NewNop()
+
 func main() {
 	errors := make(chan error)
+	var err error
+	logger, err = logging.NewFromEnv()
+	if err != nil {
+		panic("Error creating logger. Error: " + err.Error())
+	}
+	defer logger.Sync()
+	// libraries logging with the standard logger write JSON lines too
+	zap.RedirectStdLog(logger)
+	tenants, err := tenant.ConfigFromEnv()
+	if err != nil {
+		logger.Fatal("Error reading tenant configuration", zap.Error(err))
+	}
+	traces, err := tracing.ConfigFromEnv()
+	if err != nil {
+		logger.Fatal("Error reading tracing configuration", zap.Error(err))
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), traces)
+	if err != nil {
+		logger.Fatal("Error setting up tracing", zap.Error(err))
+	}
+	// both servers share the cache, so the writes of one invalidate what the other read
+	voteCache := newVoteCache()
+	// and the cache of bans, so banning through the admin server blocks the votes at once
+	banCache := newBanCache()
+	// both servers buffer their writes in the same log
+	writeBehind := newWriteBehind(tenants)
+	// both admin servers toggle the faults of the gRPC server
+	faults := newFaultInjector()
+	// both servers only let admins call the Admin service
+	authenticator := newAuthenticator(tenants)
+	// cancelled by SIGINT or SIGTERM, which starts the graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	drain := durationFromEnv("SHUTDOWN_DRAIN", DEFAULT_SHUTDOWN_DRAIN)
+	shutdownTimeout := durationFromEnv("SHUTDOWN_TIMEOUT", DEFAULT_SHUTDOWN_TIMEOUT)
+	var stopped sync.WaitGroup
+	stopped.Add(2)
+	// both servers stopped handling requests, so no write is buffered anymore
+	var serving sync.WaitGroup
+	serving.Add(2)
 	//Setup and Run HTTP Server
 	go func() {
-		mux := runtime.NewServeMux()
+		defer stopped.Done()
+		mux := newGatewayMux()
 		client := database.NewMongoClient()
+		client.SetMonitors(newCommandMonitor(), metrics.PoolMonitor())
 		if err := client.Connect(); err != nil {
-			log.Fatalf("Error connecting to database. Error: %v", err)
+			logger.Fatal("Error connecting to database", zap.Error(err))
 		}
 		defer client.Disconnect()
 
-		s := rpc.NewGrpcServer(&client)
-		grpcServer := grpc.NewServer()
-		defer grpcServer.GracefulStop()
+		s, admin := newServers(&client, tenants, voteCache, banCache, writeBehind, faults)
 		pb.RegisterVoteHandlerServer(context.Background(), mux, s)
+		pb.RegisterAdminHandlerServer(context.Background(), mux, admin)
+		checker := newChecker(ctx, s.GetRepository())
+		if err := mux.HandlePath(http.MethodGet, "/healthz", health.Liveness); err != nil {
+			logger.Fatal("Error registering liveness endpoint", zap.Error(err))
+		}
+		if err := mux.HandlePath(http.MethodGet, "/readyz", checker.Readiness); err != nil {
+			logger.Fatal("Error registering readiness endpoint", zap.Error(err))
+		}
+		if err := mux.HandlePath(http.MethodGet, "/openapi.json", serveOpenAPI); err != nil {
+			logger.Fatal("Error registering OpenAPI endpoint", zap.Error(err))
+		}
+		if err := mux.HandlePath(http.MethodGet, "/docs", serveDocs); err != nil {
+			logger.Fatal("Error registering docs endpoint", zap.Error(err))
+		}
+		if err := mux.HandlePath(http.MethodGet, EXPORT_PATH, exportHandler(mux, s)); err != nil {
+			logger.Fatal("Error registering export endpoint", zap.Error(err))
+		}
+		// Hard delete votes whose tombstone is older than the retention period
+		go rpc.RunPurgeJob(ctx, s.GetRepository(),
+			durationFromEnv("VOTE_RETENTION", rpc.DEFAULT_RETENTION),
+			positiveDurationFromEnv("VOTE_PURGE_INTERVAL", rpc.DEFAULT_PURGE_INTERVAL), logger)
+		// Resume the moderation jobs of servers which stopped before finishing them
+		go admin.ResumeModerationJobs(ctx)
+		// Apply the buffered writes, starting by the ones left by a previous run
+		applied := make(chan struct{})
+		if writeBehind != nil {
+			go func() {
+				writeBehind.Run(ctx, s.GetRepository())
+				close(applied)
+			}()
+		}
 		port := ":" + os.Getenv("PORT")
 		if port == ":" {
 			port = ":9000"
 		}
+		server := &http.Server{
+			Addr:    port,
+			Handler: logging.HTTPMiddleware(logger, tracing.HTTPMiddleware(metrics.HTTPMiddleware(authenticator.HTTPMiddleware(mux)))),
+		}
+		go func() {
+			<-ctx.Done()
+			drainAndStop(checker, drain, func() {
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				defer cancel()
+				if err := server.Shutdown(shutdownCtx); err != nil {
+					logger.Error("Error shutting down HTTP server", zap.Error(err))
+				}
+			})
+			serving.Done()
+		}()
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			errors <- err
+			return
+		}
+		if writeBehind != nil {
+			serving.Wait()
+			<-applied
+			closeWriteBehind(writeBehind, s.GetRepository(), shutdownTimeout)
+		}
+	}()
+	//Setup and Run the admin HTTP Server, kept apart from the API so it is not exposed with it
+	go func() {
+		port := ":" + os.Getenv("METRICS_PORT")
+		if port == ":" {
+			port = ":9090"
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
 		errors <- http.ListenAndServe(port, mux)
 	}()
 	//Setup and Run gRPC Server
 	// Not used since heroku doesn't support HTTP/2
 	go func() {
+		defer stopped.Done()
 		client := database.NewMongoClient()
+		client.SetMonitors(newCommandMonitor(), metrics.PoolMonitor())
 		if err := client.Connect(); err != nil {
-			log.Fatalf("Error connecting to database. Error: %v", err)
+			logger.Fatal("Error connecting to database", zap.Error(err))
 		}
 		defer client.Disconnect()
 
-		s := rpc.NewGrpcServer(&client)
-		grpcServer := grpc.NewServer()
-		defer grpcServer.GracefulStop()
+		s, admin := newServers(&client, tenants, voteCache, banCache, writeBehind, faults)
+		grpcServer := newGrpcServer(authenticator, faults)
 
 		port := ":" + os.Getenv("PORT_GRPC")
 		if port == ":" {
@@ -55,18 +192,295 @@ func main() {
 		}
 		lis, err := net.Listen("tcp", port)
 		if err != nil {
-			log.Fatalf("Error starting listener to grpc server. Error: %v", err)
+			logger.Fatal("Error starting listener to grpc server", zap.Error(err))
 		}
 
 		pb.RegisterVoteServer(grpcServer, s)
+		pb.RegisterAdminServer(grpcServer, admin)
+		checker := newChecker(ctx, s.GetRepository(), pb.Vote_ServiceDesc.ServiceName, pb.Admin_ServiceDesc.ServiceName)
+		healthpb.RegisterHealthServer(grpcServer, checker.Server())
+		// lets tools such as grpcurl list and call the services without the proto files
+		reflection.Register(grpcServer)
+		go func() {
+			<-ctx.Done()
+			drainAndStop(checker, drain, func() {
+				stopGrpcServer(grpcServer, shutdownTimeout)
+			})
+			serving.Done()
+		}()
+		logger.Info("Starting gRPC server", zap.String("port", port))
 		err = grpcServer.Serve(lis)
 		if err != nil {
-			log.Fatalf("Error serving to grpc server. Error: %v", err)
+			logger.Fatal("Error serving to grpc server", zap.Error(err))
 		}
-		fmt.Printf("Successfully started gRFC server in %v", port)
 	}()
-	for err := range errors {
-		log.Fatal(err)
-		return
+	done := make(chan struct{})
+	go func() {
+		stopped.Wait()
+		close(done)
+	}()
+	select {
+	case err := <-errors:
+		// export the spans still buffered before exiting
+		shutdownTracing(context.Background())
+		logger.Fatal("Error serving", zap.Error(err))
+	case <-done:
+		shutdownTracing(context.Background())
+		logger.Info("Stopped gracefully")
+	}
+}
+
+// Create the checker of the health of a server, which pings the database until ctx is cancelled
+func newChecker(ctx context.Context, repository database.VoteRepository, services ...string) *health.Checker {
+	checker := health.NewChecker(repository.Ping,
+		durationFromEnv("HEALTH_CHECK_TIMEOUT", health.DEFAULT_CHECK_TIMEOUT), services...)
+	go checker.Run(ctx, positiveDurationFromEnv("HEALTH_CHECK_INTERVAL", health.DEFAULT_CHECK_INTERVAL))
+	return checker
+}
+
+// Applies the writes still buffered, which would be lost with WAL_SYNC=rotate, and closes the log
+func closeWriteBehind(writeBehind *database.WriteBehind, repository database.VoteRepository, timeout time.Duration) {
+	flushCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := writeBehind.Flush(flushCtx, repository); err != nil {
+		logger.Error("Error applying buffered writes", zap.Error(err))
+	}
+	if err := writeBehind.Close(); err != nil {
+		logger.Error("Error closing write-ahead log", zap.Error(err))
+	}
+}
+
+// Reports the server as not ready, waits for load balancers to stop sending requests to it, and stops it
+func drainAndStop(checker *health.Checker, drain time.Duration, stop func()) {
+	checker.Shutdown()
+	logger.Info("Shutting down, draining", zap.Duration("drain", drain))
+	time.Sleep(drain)
+	stop()
+}
+
+// Waits for the RPCs being handled to finish, and cancels them once timeout passes
+func stopGrpcServer(server *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		server.Stop()
+	}
+}
+
+// Create a gRPC server logging, tracing, measuring and authenticating every RPC, which accepts the
+// keepalive pings of idle clients. The faults are injected last, so they are logged and measured
+// as errors, and only into calls which were authenticated
+func newGrpcServer(authenticator *auth.Authenticator, faults *chaos.Injector) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{logging.UnaryServerInterceptor(logger), tracing.UnaryServerInterceptor(), metrics.UnaryServerInterceptor, authenticator.UnaryServerInterceptor}
+	stream := []grpc.StreamServerInterceptor{logging.StreamServerInterceptor(logger), tracing.StreamServerInterceptor(), metrics.StreamServerInterceptor, authenticator.StreamServerInterceptor}
+	if faults != nil {
+		unary = append(unary, faults.UnaryServerInterceptor)
+		stream = append(stream, faults.StreamServerInterceptor)
+	}
+	return grpc.NewServer(
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: KEEPALIVE_MIN_TIME, PermitWithoutStream: true}),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+}
+
+// Create the authenticator of the calls to the API, which only lets admins call the Admin service
+// over both gRPC and HTTP, and takes the tenant of the calls from their tokens. Without AUTH_SECRET
+// every admin call is refused
+func newAuthenticator(tenants tenant.Config) *auth.Authenticator {
+	config := auth.ConfigFromEnv()
+	if len(config.Secret) == 0 {
+		logger.Warn("AUTH_SECRET is not set, the Admin service refuses every call")
+	}
+	return auth.NewAuthenticator(config, tenants,
+		auth.Scope{Services: []string{pb.Vote_ServiceDesc.ServiceName}, Paths: []string{"/v1"}},
+		auth.Scope{Services: []string{pb.Admin_ServiceDesc.ServiceName}, Paths: []string{ADMIN_PATH}})
+}
+
+// Create the injector of faults into the Vote service if FAULT_INJECTION is true, or else nil.
+// The faults start disabled, until set through the Admin service
+func newFaultInjector() *chaos.Injector {
+	enabled, err := chaos.EnabledFromEnv()
+	if err != nil {
+		logger.Fatal("Error reading fault injection configuration", zap.Error(err))
+	}
+	if !enabled {
+		return nil
+	}
+	logger.Warn("Fault injection is enabled")
+	return chaos.NewInjector(pb.Vote_ServiceDesc.ServiceName)
+}
+
+// Create the monitor of the commands sent to MongoDB, which traces and measures them
+func newCommandMonitor() *event.CommandMonitor {
+	return database.CombineCommandMonitors(tracing.CommandMonitor(), metrics.CommandMonitor())
+}
+
+// Create the servers of both the HTTP and gRPC APIs, configured by the environment
+func newServers(client *database.MongoClient, tenants tenant.Config, voteCache *database.VoteCache, banCache *database.BanCache, writeBehind *database.WriteBehind, faults *chaos.Injector) (rpc.Server, rpc.AdminServer) {
+	s := rpc.NewGrpcServer(client)
+	s.SetLogger(logger)
+	s.SetTenantConfig(tenants)
+	if voteCache != nil {
+		s.SetCache(voteCache)
+	}
+	if banCache != nil {
+		s.SetBanCache(banCache)
+	}
+	s.SetIdempotencyTTL(durationFromEnv("IDEMPOTENCY_TTL", rpc.DEFAULT_IDEMPOTENCY_TTL))
+	if err := s.GetIdempotencyStore().EnsureIndexes(context.Background()); err != nil {
+		logger.Fatal("Error creating idempotency indexes", zap.Error(err))
+	}
+	if os.Getenv("MIGRATE_ON_START") != "false" {
+		migrator := migrate(client, tenants)
+		// tenants which appear later are migrated before their first write
+		s.SetTenantProvisioner(migrator.UpTenant)
+	}
+	s.SetBatchLimit(positiveIntFromEnv("BATCH_LIMIT", rpc.DEFAULT_BATCH_LIMIT))
+	s.SetIngestFlush(intFromEnv("INGEST_FLUSH_SIZE", rpc.DEFAULT_INGEST_FLUSH_SIZE),
+		positiveDurationFromEnv("INGEST_FLUSH_INTERVAL", rpc.DEFAULT_INGEST_FLUSH_INTERVAL))
+	admin := rpc.NewAdminServer(client)
+	admin.SetLogger(logger)
+	admin.SetTenantConfig(tenants)
+	if err := admin.GetModerationStore().EnsureIndexes(context.Background()); err != nil {
+		logger.Fatal("Error creating audit indexes", zap.Error(err))
+	}
+	if banCache != nil {
+		admin.SetBanCache(banCache)
+	}
+	if err := admin.GetBanStore().EnsureIndexes(context.Background()); err != nil {
+		logger.Fatal("Error creating ban indexes", zap.Error(err))
+	}
+	admin.SetModerationSyncLimit(int64(intFromEnv("MODERATION_SYNC_LIMIT", rpc.DEFAULT_MODERATION_SYNC_LIMIT)))
+	admin.SetModerationJobLease(durationFromEnv("MODERATION_JOB_LEASE", rpc.DEFAULT_MODERATION_JOB_LEASE))
+	if voteCache != nil {
+		admin.SetCache(voteCache)
+	}
+	if writeBehind != nil {
+		s.SetWriteBehind(writeBehind)
+		admin.SetWriteBehind(writeBehind)
+	}
+	if faults != nil {
+		admin.SetFaultInjector(faults)
+	}
+	return s, admin
+}
+
+// Apply the pending migrations of the votes. Instances starting together wait for the one
+// holding the lock, then find nothing left to apply
+func migrate(client *database.MongoClient, tenants tenant.Config) migrations.Migrator {
+	migrator := migrations.NewMigrator(client, rpc.DatabaseName(rpc.MAIN_DB), tenants, migrations.Votes)
+	migrator.SetLogger(logger)
+	migrator.SetLockTimeout(durationFromEnv("MIGRATION_LOCK_TIMEOUT", migrations.DEFAULT_LOCK_TIMEOUT))
+	if err := migrator.Up(context.Background()); err != nil {
+		logger.Fatal("Error migrating the database", zap.Error(err))
+	}
+	return migrator
+}
+
+// Create the in-process cache of votes and tallies, or nil if CACHE_SIZE is 0
+func newVoteCache() *database.VoteCache {
+	size := nonNegativeIntFromEnv("CACHE_SIZE", cache.DEFAULT_LRU_SIZE)
+	if size == 0 {
+		return nil
+	}
+	voteCache := database.NewVoteCache(cache.NewLRU(size),
+		durationFromEnv("CACHE_VOTE_TTL", database.DEFAULT_CACHE_VOTE_TTL),
+		durationFromEnv("CACHE_TALLY_TTL", database.DEFAULT_CACHE_TALLY_TTL))
+	voteCache.SetLogger(logger)
+	return voteCache
+}
+
+// Create the in-process cache of bans, or nil if BAN_CACHE_SIZE is 0
+func newBanCache() *database.BanCache {
+	size := nonNegativeIntFromEnv("BAN_CACHE_SIZE", cache.DEFAULT_LRU_SIZE)
+	if size == 0 {
+		return nil
+	}
+	banCache := database.NewBanCache(cache.NewLRU(size), durationFromEnv("BAN_CACHE_TTL", database.DEFAULT_BAN_CACHE_TTL))
+	banCache.SetLogger(logger)
+	return banCache
+}
+
+// Create the write-behind buffer if WRITE_BEHIND is true, or else nil
+func newWriteBehind(tenants tenant.Config) *database.WriteBehind {
+	if os.Getenv("WRITE_BEHIND") != "true" {
+		return nil
+	}
+	dir := os.Getenv("WAL_DIR")
+	if dir == "" {
+		dir = "wal"
+	}
+	syncMode := os.Getenv("WAL_SYNC")
+	if syncMode == "" {
+		syncMode = wal.SYNC_ALWAYS
+	}
+	writeLog, err := wal.Open(dir, syncMode)
+	if err != nil {
+		logger.Fatal("Error opening write-ahead log", zap.Error(err))
+	}
+	writeBehind := database.NewWriteBehind(writeLog, tenants,
+		intFromEnv("WRITE_BEHIND_FLUSH_SIZE", database.DEFAULT_WRITE_BEHIND_FLUSH_SIZE),
+		positiveDurationFromEnv("WRITE_BEHIND_FLUSH_INTERVAL", database.DEFAULT_WRITE_BEHIND_FLUSH_INTERVAL))
+	writeBehind.SetLogger(logger)
+	return writeBehind
+}
+
+// Reads a duration such as "720h" from the environment, using fallback if it is not set
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Fatal("Invalid duration", zap.String("variable", name), zap.Error(err))
+	}
+	return duration
+}
+
+// Reads a duration from the environment like durationFromEnv, refusing the ones which aren't
+// positive, such as the intervals of tickers
+func positiveDurationFromEnv(name string, fallback time.Duration) time.Duration {
+	duration := durationFromEnv(name, fallback)
+	if duration <= 0 {
+		logger.Fatal("Duration must be positive", zap.String("variable", name), zap.Duration("value", duration))
+	}
+	return duration
+}
+
+// Reads an integer from the environment, using fallback if it is not set
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Fatal("Invalid number", zap.String("variable", name), zap.Error(err))
+	}
+	return number
+}
+
+// Reads an integer from the environment like intFromEnv, refusing the negative ones
+func nonNegativeIntFromEnv(name string, fallback int) int {
+	number := intFromEnv(name, fallback)
+	if number < 0 {
+		logger.Fatal("Number must not be negative", zap.String("variable", name), zap.Int("value", number))
+	}
+	return number
+}
+
+// Reads an integer from the environment like intFromEnv, refusing the ones which aren't positive
+func positiveIntFromEnv(name string, fallback int) int {
+	number := intFromEnv(name, fallback)
+	if number <= 0 {
+		logger.Fatal("Number must be positive", zap.String("variable", name), zap.Int("value", number))
 	}
+	return number
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/logging"
+	"github.com/IsaqueB/ps-klever/pkg/migrations"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  up               apply the pending migrations
+  down <version>   revert the migrations after version, 0 reverts all of them
+  status           list the migrations of every tenant and when they were applied
+`
+
+// Runs the migrations of the votes against the database the API uses, configured by the same environment
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	logger, err := logging.NewFromEnv()
+	if err != nil {
+		fail(err)
+	}
+	defer logger.Sync()
+	tenants, err := tenant.ConfigFromEnv()
+	if err != nil {
+		fail(err)
+	}
+	client := database.NewMongoClient()
+	if err := client.Connect(); err != nil {
+		fail(err)
+	}
+	defer client.Disconnect()
+	migrator := migrations.NewMigrator(&client, rpc.DatabaseName(rpc.MAIN_DB), tenants, migrations.Votes)
+	migrator.SetLogger(logger)
+	ctx := context.Background()
+	switch os.Args[1] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		if len(os.Args) < 3 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		version, convErr := strconv.Atoi(os.Args[2])
+		if convErr != nil {
+			fail(fmt.Errorf("invalid version %q", os.Args[2]))
+		}
+		err = migrator.Down(ctx, version)
+	case "status":
+		err = printStatus(ctx, migrator)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func printStatus(ctx context.Context, migrator migrations.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TENANT\tVERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		tenantId := status.Tenant
+		if tenantId == "" {
+			tenantId = "(default)"
+		}
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", tenantId, status.Version, status.Name, appliedAt)
+	}
+	return w.Flush()
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	// embeds the documentation page
+	_ "embed"
+	"net/http"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+)
+
+// Page exploring the OpenAPI document with Swagger UI
+//
+//go:embed docs.html
+var docsPage []byte
+
+// Serves the OpenAPI document of the HTTP routes
+func serveOpenAPI(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(pb.OpenAPI)
+}
+
+func serveDocs(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeOpenAPI(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveOpenAPI(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil), nil)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, pb.OpenAPI, w.Body.Bytes())
+}
+
+func TestServeDocs(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveDocs(w, httptest.NewRequest(http.MethodGet, "/docs", nil), nil)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `url: "/openapi.json"`, "The page should load the document served")
+}
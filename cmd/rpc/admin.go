@@ -0,0 +1,175 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/auth"
+	"github.com/IsaqueB/ps-klever/pkg/chaos"
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type AdminServer interface {
+	RestoreVote(ctx context.Context, req *pb.RestoreVoteRequest) (*pb.RestoreVoteResponse, error)
+	ListVotes(ctx context.Context, req *pb.ListVotesRequest) (*pb.ListVotesResponse, error)
+	GetCacheStats(ctx context.Context, req *pb.GetCacheStatsRequest) (*pb.GetCacheStatsResponse, error)
+	GetClient() *database.MongoClient
+	SetDatabase(index int)
+	SetTenantConfig(config tenant.Config)
+	SetCache(voteCache *database.VoteCache)
+	GetWriteBehindStats(ctx context.Context, req *pb.GetWriteBehindStatsRequest) (*pb.GetWriteBehindStatsResponse, error)
+	SetWriteBehind(writeBehind *database.WriteBehind)
+	SetLogger(logger *zap.Logger)
+	GetFaultInjection(ctx context.Context, req *pb.GetFaultInjectionRequest) (*pb.GetFaultInjectionResponse, error)
+	SetFaultInjection(ctx context.Context, req *pb.SetFaultInjectionRequest) (*pb.SetFaultInjectionResponse, error)
+	SetFaultInjector(injector *chaos.Injector)
+	ModerateVotes(ctx context.Context, req *pb.ModerateVotesRequest) (*pb.ModerateVotesResponse, error)
+	GetModerationJob(ctx context.Context, req *pb.GetModerationJobRequest) (*pb.GetModerationJobResponse, error)
+	ListAuditEntries(ctx context.Context, req *pb.ListAuditEntriesRequest) (*pb.ListAuditEntriesResponse, error)
+	SetModerationSyncLimit(limit int64)
+	SetModerationJobLease(lease time.Duration)
+	ResumeModerationJobs(ctx context.Context)
+	GetModerationStore() database.ModerationStore
+	BanUser(ctx context.Context, req *pb.BanUserRequest) (*pb.BanUserResponse, error)
+	UnbanUser(ctx context.Context, req *pb.UnbanUserRequest) (*pb.UnbanUserResponse, error)
+	ListBans(ctx context.Context, req *pb.ListBansRequest) (*pb.ListBansResponse, error)
+	SetBanCache(banCache *database.BanCache)
+	GetBanStore() database.BanStore
+	pb.UnsafeAdminServer
+}
+
+type adminServer struct {
+	client     *database.MongoClient
+	database   string
+	tenants    tenant.Config
+	repository database.VoteRepository
+	cache      *database.VoteCache
+	// jobs and audit entries of the moderations
+	moderation          database.ModerationStore
+	moderationSyncLimit int64
+	moderationLease     time.Duration
+	// identifies the server as the owner of the jobs it runs
+	owner    string
+	bans     database.BanStore
+	banCache *database.BanCache
+	// the one used by the vote server
+	writeBehind *database.WriteBehind
+	logger      *zap.Logger
+	// nil in production
+	faults *chaos.Injector
+	pb.UnimplementedAdminServer
+}
+
+// Create a new admin server using the same client of the vote server
+func NewAdminServer(client *database.MongoClient) AdminServer {
+	adminServer := adminServer{
+		client:              client,
+		tenants:             tenant.Config{Strategy: tenant.PREFIX_STRATEGY},
+		moderationSyncLimit: DEFAULT_MODERATION_SYNC_LIMIT,
+		moderationLease:     DEFAULT_MODERATION_JOB_LEASE,
+		owner:               serverOwner(),
+		logger:              zap.NewNop(),
+	}
+	adminServer.SetDatabase(MAIN_DB)
+	return &adminServer
+}
+
+func (s *adminServer) GetClient() *database.MongoClient {
+	return s.client
+}
+
+func (s *adminServer) SetDatabase(index int) {
+	s.database = db_string[index]
+	s.setStores()
+}
+
+func (s *adminServer) setStores() {
+	// admins don't create votes, so tenants are never provisioned by them
+	s.repository = newRepository(s.client, s.database, s.tenants, s.cache, nil)
+	s.moderation = database.NewModerationStore(s.client, s.database, s.tenants)
+	s.bans = newBanStore(s.client, s.database, s.tenants, s.banCache)
+}
+
+// Unique among the servers running, as hostname, process and start time
+func serverOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
+// Subject of the admin calling, taken from its token by the authentication, which is recorded as
+// the actor of the admin actions. Fails unless the caller is an admin
+func adminActor(ctx context.Context) (string, error) {
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "An admin token is required")
+	}
+	if !identity.HasRole(auth.ADMIN_ROLE) {
+		return "", status.Error(codes.PermissionDenied, "The token is not of an admin")
+	}
+	return identity.Subject, nil
+}
+
+// Admins only manage the votes of their own tenant
+func (s *adminServer) SetTenantConfig(config tenant.Config) {
+	s.tenants = config
+	s.setStores()
+}
+
+// Undo the deletion of a vote that was not purged yet
+func (s *adminServer) RestoreVote(ctx context.Context, req *pb.RestoreVoteRequest) (*pb.RestoreVoteResponse, error) {
+	s.requestLogger(ctx).Debug("restore vote", zap.String("id", req.Id))
+	// convert string from request to objectId
+	voteId, err := primitive.ObjectIDFromHex(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	restored, err := s.repository.Restore(ctx, voteId)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	if restored == 0 {
+		return nil, status.Errorf(5, "Could not find a deleted vote with the id requested")
+	}
+	return &pb.RestoreVoteResponse{
+		Restored: int32(restored),
+	}, nil
+}
+
+// List votes filtering by VIDEO and/or USER. Deleted votes are only listed if requested
+func (s *adminServer) ListVotes(ctx context.Context, req *pb.ListVotesRequest) (*pb.ListVotesResponse, error) {
+	s.requestLogger(ctx).Debug("list votes", zap.String("video", req.Video), zap.String("user", req.User), zap.Bool("include_deleted", req.IncludeDeleted))
+	filter := database.VoteFilter{IncludeDeleted: req.IncludeDeleted}
+	// converting strings from request to objectId, empty ones are not filtered
+	if req.Video != "" {
+		videoId, err := primitive.ObjectIDFromHex(req.Video)
+		if err != nil {
+			return nil, err
+		}
+		filter.Video = &videoId
+	}
+	if req.User != "" {
+		userId, err := primitive.ObjectIDFromHex(req.User)
+		if err != nil {
+			return nil, err
+		}
+		filter.User = &userId
+	}
+	votes, err := s.repository.Find(ctx, filter)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	return &pb.ListVotesResponse{
+		Vote: toVoteStructs(votes),
+	}, nil
+}
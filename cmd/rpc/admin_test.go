@@ -0,0 +1,123 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func initAnAdminServer(s rpc.Server) rpc.AdminServer {
+	admin := rpc.NewAdminServer(s.GetClient())
+	admin.SetDatabase(rpc.TEST_DB)
+	return admin
+}
+
+func TestNewAdminServer(t *testing.T) {
+	client := database.NewMongoClient()
+	s := rpc.NewAdminServer(&client)
+	assert.Equal(t, *s.GetClient(), client, "admin server's client and the created should be the same")
+}
+
+func TestRestoreVote(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_id := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	admin := initAnAdminServer(s)
+	res_insert, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true}})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	if _, err = s.DeleteOne(mock_ctx, &pb.DeleteOneRequest{Id: res_insert.Id}); err != nil {
+		t.Fatalf("Error inside Delete: %v", err)
+	}
+	// deleted votes can't be read
+	if _, err = s.Get(mock_ctx, &pb.GetRequest{Id: res_insert.Id}); err == nil {
+		t.Errorf("Deleted vote should not be found")
+	}
+	res_restore, err := admin.RestoreVote(mock_ctx, &pb.RestoreVoteRequest{Id: res_insert.Id})
+	if err != nil {
+		t.Fatalf("Error inside RestoreVote: %v", err)
+	}
+	assert.Equal(t, int32(1), res_restore.GetRestored(), "The amount of documents restored should be one")
+	res_get, err := s.Get(mock_ctx, &pb.GetRequest{Id: res_insert.Id})
+	if err != nil {
+		t.Fatalf("Error inside Get: %v", err)
+	}
+	assert.Equal(t, res_insert.Id, res_get.GetVote().GetId())
+	// restoring a vote that is not deleted fails
+	if _, err = admin.RestoreVote(mock_ctx, &pb.RestoreVoteRequest{Id: res_insert.Id}); err == nil {
+		t.Errorf("Restoring a vote that is not deleted should fail")
+	}
+}
+
+func TestListVotesIncludeDeleted(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	admin := initAnAdminServer(s)
+	res_0, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true}})
+	if err != nil {
+		t.Fatalf("Error in Insert. %v", err)
+	}
+	res_1, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: false}})
+	if err != nil {
+		t.Fatalf("Error in Insert. %v", err)
+	}
+	if _, err = s.DeleteOne(mock_ctx, &pb.DeleteOneRequest{Id: res_1.Id}); err != nil {
+		t.Fatalf("Error inside Delete: %v", err)
+	}
+	res_video, err := s.ListVotesInVideo(mock_ctx, &pb.ListVotesInVideoRequest{Id: mock_video})
+	if err != nil {
+		t.Fatalf("Error in ListVotesInVideo. %v", err)
+	}
+	assert.Len(t, res_video.Vote, 1, "Deleted votes should not be listed")
+	assert.Equal(t, res_0.Id, res_video.Vote[0].GetId())
+	res_admin, err := admin.ListVotes(mock_ctx, &pb.ListVotesRequest{Video: mock_video, IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("Error in ListVotes. %v", err)
+	}
+	assert.Len(t, res_admin.Vote, 2, "Deleted votes should be listed when requested")
+	assert.Nil(t, res_admin.Vote[0].GetDeletedAt())
+	assert.NotNil(t, res_admin.Vote[1].GetDeletedAt())
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_id := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	admin := initAnAdminServer(s)
+	res_insert, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true}})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	if _, err = s.DeleteOne(mock_ctx, &pb.DeleteOneRequest{Id: res_insert.Id}); err != nil {
+		t.Fatalf("Error inside Delete: %v", err)
+	}
+	purged, err := s.GetRepository().PurgeDeleted(mock_ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("Error inside PurgeDeleted: %v", err)
+	}
+	assert.GreaterOrEqual(t, purged, int64(1), "The deleted vote should be purged")
+	// purged votes can't be restored
+	if _, err = admin.RestoreVote(mock_ctx, &pb.RestoreVoteRequest{Id: res_insert.Id}); err == nil {
+		t.Errorf("Purged votes should not be restored")
+	}
+}
@@ -0,0 +1,203 @@
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Names of the ban actions in the audit entries
+const (
+	AUDIT_BAN_USER   = "ban_user"
+	AUDIT_UNBAN_USER = "unban_user"
+)
+
+// Creates the ban store of a server, reading through the cache if there is one
+func newBanStore(client *database.MongoClient, databaseName string, tenants tenant.Config, banCache *database.BanCache) database.BanStore {
+	store := database.NewBanStore(client, databaseName, tenants)
+	if banCache == nil {
+		return store
+	}
+	return database.NewCachedBanStore(store, banCache, tenants)
+}
+
+// Set the cache bans are read through. The vote and admin servers must share the same cache, so
+// banning a user invalidates the entry checked by the votes
+func (s *server) SetBanCache(banCache *database.BanCache) {
+	s.banCache = banCache
+	s.setStores()
+}
+
+func (s *adminServer) SetBanCache(banCache *database.BanCache) {
+	s.banCache = banCache
+	s.setStores()
+}
+
+func (s *adminServer) GetBanStore() database.BanStore {
+	return s.bans
+}
+
+// Returns PermissionDenied with the reason if the user is banned
+func (s *server) checkBan(ctx context.Context, user primitive.ObjectID) error {
+	ban, err := s.bans.Find(ctx, user)
+	if err != nil {
+		return repositoryError(err)
+	}
+	if ban == nil {
+		return nil
+	}
+	return banError(ban)
+}
+
+// Returns the PermissionDenied of each user of the votes who is banned, looking up the distinct
+// users at once. Used by BatchInsert and the streams, which check their votes a batch at a time
+func (s *server) checkBans(ctx context.Context, votes []database.VoteModel) (map[primitive.ObjectID]error, error) {
+	seen := make(map[primitive.ObjectID]bool, len(votes))
+	var users []primitive.ObjectID
+	for _, vote := range votes {
+		if !seen[vote.User] {
+			seen[vote.User] = true
+			users = append(users, vote.User)
+		}
+	}
+	bans, err := s.bans.FindMany(ctx, users)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	errs := make(map[primitive.ObjectID]error, len(bans))
+	for user, ban := range bans {
+		errs[user] = banError(ban)
+	}
+	return errs, nil
+}
+
+func banError(ban *database.Ban) error {
+	if ban.ExpiresAt != nil {
+		return status.Errorf(codes.PermissionDenied, "The user is banned until %s: %s", ban.ExpiresAt.Format(time.RFC3339), ban.Reason)
+	}
+	return status.Errorf(codes.PermissionDenied, "The user is banned: %s", ban.Reason)
+}
+
+// Returns the user of each vote found among the ids, which are checked for bans before being
+// updated. Invalid ids are skipped, they fail when validated
+func (s *server) voteOwners(ctx context.Context, updates []*pb.UpdateOneRequest) (map[primitive.ObjectID]primitive.ObjectID, error) {
+	var ids []primitive.ObjectID
+	for _, update := range updates {
+		if id, err := primitive.ObjectIDFromHex(update.GetId()); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	owners := make(map[primitive.ObjectID]primitive.ObjectID, len(ids))
+	if len(ids) == 0 {
+		return owners, nil
+	}
+	votes, err := s.repository.Find(ctx, database.VoteFilter{IDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	for _, vote := range votes {
+		owners[vote.ID] = vote.User
+	}
+	return owners, nil
+}
+
+func toBan(ban *database.Ban) *pb.Ban {
+	result := &pb.Ban{
+		User:      ban.User.Hex(),
+		Reason:    ban.Reason,
+		Actor:     ban.Actor,
+		CreatedAt: timestamppb.New(ban.CreatedAt),
+	}
+	if ban.ExpiresAt != nil {
+		result.ExpiresAt = timestamppb.New(*ban.ExpiresAt)
+	}
+	return result
+}
+
+// Prevent an USER from voting, permanently or for the duration requested, replacing the ban it
+// already has. Every ban is recorded in the audit log
+func (s *adminServer) BanUser(ctx context.Context, req *pb.BanUserRequest) (*pb.BanUserResponse, error) {
+	actor, err := adminActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logger := s.requestLogger(ctx)
+	logger.Debug("ban user", zap.String("user", req.User), zap.String("actor", actor))
+	userId, err := primitive.ObjectIDFromHex(req.User)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.Reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "The reason is required")
+	}
+	ban := database.Ban{User: userId, Reason: req.Reason, Actor: actor}
+	if req.Duration != nil {
+		if err := req.Duration.CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if req.Duration.AsDuration() <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "The duration must be positive")
+		}
+		expiresAt := time.Now().UTC().Add(req.Duration.AsDuration())
+		ban.ExpiresAt = &expiresAt
+	}
+	ban, err = s.bans.Ban(ctx, ban)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	entry := database.AuditEntry{Actor: actor, Action: AUDIT_BAN_USER, Reason: req.Reason, Filter: database.ModerationFilter{User: &userId}}
+	if err := s.moderation.Audit(ctx, entry); err != nil {
+		logger.Error("could not audit ban", zap.Any("entry", entry), zap.Error(err))
+	}
+	logger.Info("user banned", zap.String("user", req.User), zap.String("actor", actor), zap.Timep("expires_at", ban.ExpiresAt))
+	return &pb.BanUserResponse{Ban: toBan(&ban)}, nil
+}
+
+// Lift the ban of an USER, recording it in the audit log
+func (s *adminServer) UnbanUser(ctx context.Context, req *pb.UnbanUserRequest) (*pb.UnbanUserResponse, error) {
+	actor, err := adminActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logger := s.requestLogger(ctx)
+	logger.Debug("unban user", zap.String("user", req.User), zap.String("actor", actor))
+	userId, err := primitive.ObjectIDFromHex(req.User)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	unbanned, err := s.bans.Unban(ctx, userId)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	if !unbanned {
+		return nil, status.Error(codes.NotFound, "The user is not banned")
+	}
+	entry := database.AuditEntry{Actor: actor, Action: AUDIT_UNBAN_USER, Reason: req.Reason, Filter: database.ModerationFilter{User: &userId}}
+	if err := s.moderation.Audit(ctx, entry); err != nil {
+		logger.Error("could not audit unban", zap.Any("entry", entry), zap.Error(err))
+	}
+	logger.Info("user unbanned", zap.String("user", req.User), zap.String("actor", actor))
+	return &pb.UnbanUserResponse{}, nil
+}
+
+// List the bans of the tenant which didn't expire, newest first
+func (s *adminServer) ListBans(ctx context.Context, req *pb.ListBansRequest) (*pb.ListBansResponse, error) {
+	s.requestLogger(ctx).Debug("list bans")
+	bans, err := s.bans.List(ctx)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	response := &pb.ListBansResponse{}
+	for i := range bans {
+		response.Ban = append(response.Ban, toBan(&bans[i]))
+	}
+	return response, nil
+}
@@ -0,0 +1,182 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	"github.com/IsaqueB/ps-klever/pkg/auth"
+	"github.com/IsaqueB/ps-klever/pkg/cache"
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func initABannedServer() (rpc.Server, rpc.AdminServer, error) {
+	s, err := initAServer()
+	if err != nil {
+		return nil, nil, err
+	}
+	banCache := database.NewBanCache(cache.NewLRU(100), time.Minute)
+	s.SetBanCache(banCache)
+	admin := initAnAdminServer(s)
+	admin.SetBanCache(banCache)
+	return s, admin, nil
+}
+
+// Context of a call of the admin given, as set by the authentication
+func adminContext(actor string) context.Context {
+	return auth.NewContext(context.Background(), auth.Identity{Subject: actor, Roles: []string{auth.ADMIN_ROLE}})
+}
+
+func TestBanUser(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_user := primitive.NewObjectID().Hex()
+	mock_admin_ctx := adminContext("moderator-" + mock_user)
+	mock_video := primitive.NewObjectID().Hex()
+	s, admin, err := initABannedServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res_insert, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: mock_user, Upvote: true}})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	// the cache holds that the user isn't banned, which banning invalidates
+	res_ban, err := admin.BanUser(mock_admin_ctx, &pb.BanUserRequest{User: mock_user, Reason: "spam"})
+	if err != nil {
+		t.Fatalf("Error inside BanUser: %v", err)
+	}
+	assert.Nil(t, res_ban.Ban.ExpiresAt, "The ban should be permanent")
+	_, err = s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: primitive.NewObjectID().Hex(), User: mock_user, Upvote: true}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "spam", "The reason of the ban should be returned")
+	_, err = s.UpdateOne(mock_ctx, &pb.UpdateOneRequest{Id: res_insert.Id, NewValue: false})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = s.CastVote(mock_ctx, &pb.CastVoteRequest{Video: mock_video, User: mock_user, Direction: pb.Direction_DIRECTION_DOWN})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	res_batch, err := s.BatchInsert(mock_ctx, &pb.BatchInsertRequest{Vote: []*pb.VoteStruct{
+		{Video: primitive.NewObjectID().Hex(), User: mock_user},
+		{Video: primitive.NewObjectID().Hex(), User: primitive.NewObjectID().Hex()},
+	}})
+	if err != nil {
+		t.Fatalf("Error inside BatchInsert: %v", err)
+	}
+	assert.Equal(t, int32(codes.PermissionDenied), res_batch.Result[0].Code)
+	assert.Equal(t, int32(codes.OK), res_batch.Result[1].Code, "Users who aren't banned should still vote")
+	res_update, err := s.BatchUpdate(mock_ctx, &pb.BatchUpdateRequest{Vote: []*pb.UpdateOneRequest{{Id: res_insert.Id}}})
+	if err != nil {
+		t.Fatalf("Error inside BatchUpdate: %v", err)
+	}
+	assert.Equal(t, int32(codes.PermissionDenied), res_update.Result[0].Code)
+	res_list, err := admin.ListBans(mock_ctx, &pb.ListBansRequest{})
+	if err != nil {
+		t.Fatalf("Error inside ListBans: %v", err)
+	}
+	var users []string
+	for _, ban := range res_list.Ban {
+		users = append(users, ban.User)
+	}
+	assert.Contains(t, users, mock_user)
+	// banned users can still retract their votes
+	if _, err := s.CastVote(mock_ctx, &pb.CastVoteRequest{Video: mock_video, User: mock_user, Direction: pb.Direction_DIRECTION_NONE}); err != nil {
+		t.Fatalf("Error inside CastVote: %v", err)
+	}
+	if _, err := admin.UnbanUser(mock_admin_ctx, &pb.UnbanUserRequest{User: mock_user}); err != nil {
+		t.Fatalf("Error inside UnbanUser: %v", err)
+	}
+	if _, err := s.CastVote(mock_ctx, &pb.CastVoteRequest{Video: mock_video, User: mock_user, Direction: pb.Direction_DIRECTION_UP}); err != nil {
+		t.Fatalf("Error inside CastVote: %v", err)
+	}
+	_, err = admin.UnbanUser(mock_admin_ctx, &pb.UnbanUserRequest{User: mock_user})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	res_audit, err := admin.ListAuditEntries(mock_ctx, &pb.ListAuditEntriesRequest{Actor: "moderator-" + mock_user})
+	if err != nil {
+		t.Fatalf("Error inside ListAuditEntries: %v", err)
+	}
+	if assert.Len(t, res_audit.Entry, 2) {
+		assert.Equal(t, rpc.AUDIT_UNBAN_USER, res_audit.Entry[0].Action)
+		assert.Equal(t, rpc.AUDIT_BAN_USER, res_audit.Entry[1].Action)
+		assert.Equal(t, mock_user, res_audit.Entry[1].Filter.User)
+	}
+}
+
+func TestTemporaryBan(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_user := primitive.NewObjectID().Hex()
+	s, admin, err := initABannedServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res_ban, err := admin.BanUser(adminContext("moderator"), &pb.BanUserRequest{User: mock_user, Reason: "spam", Duration: durationpb.New(time.Second)})
+	if err != nil {
+		t.Fatalf("Error inside BanUser: %v", err)
+	}
+	assert.NotNil(t, res_ban.Ban.ExpiresAt, "The ban should expire")
+	vote := &pb.VoteStruct{Video: primitive.NewObjectID().Hex(), User: mock_user, Upvote: true}
+	_, err = s.Insert(mock_ctx, &pb.InsertRequest{Vote: vote})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	// the ban cached lapses with it
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: vote}); err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+}
+
+func TestBanUserInvalid(t *testing.T) {
+	mock_ctx := adminContext("moderator")
+	mock_user := primitive.NewObjectID().Hex()
+	client := database.NewMongoClient()
+	admin := rpc.NewAdminServer(&client)
+	for _, req := range []*pb.BanUserRequest{
+		{User: "invalid", Reason: "spam"},
+		{User: mock_user},
+		{User: mock_user, Reason: "spam", Duration: durationpb.New(-time.Hour)},
+	} {
+		_, err := admin.BanUser(mock_ctx, req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	_, err := admin.UnbanUser(mock_ctx, &pb.UnbanUserRequest{User: "invalid"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	// the actor is the admin calling
+	_, err = admin.BanUser(context.Background(), &pb.BanUserRequest{User: mock_user, Reason: "spam"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = admin.UnbanUser(auth.NewContext(context.Background(), auth.Identity{Subject: "app"}), &pb.UnbanUserRequest{User: mock_user})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestIngestVotesBanned(t *testing.T) {
+	mock_user := primitive.NewObjectID().Hex()
+	mock_video := primitive.NewObjectID().Hex()
+	s, admin, err := initABannedServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	if _, err := admin.BanUser(adminContext("moderator"), &pb.BanUserRequest{User: mock_user, Reason: "spam"}); err != nil {
+		t.Fatalf("Error inside BanUser: %v", err)
+	}
+	// the bans of the users of each flush are looked up together
+	s.SetIngestFlush(3, time.Minute)
+	stream := mockVoteIngestVotesServer{Votes: []*pb.VoteStruct{
+		{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true},
+		{Video: mock_video, User: mock_user, Upvote: true},
+		{Video: primitive.NewObjectID().Hex(), User: mock_user, Upvote: false},
+		{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true},
+	}}
+	if err = s.IngestVotes(&stream); err != nil {
+		t.Fatalf("Error in IngestVotes. %v", err)
+	}
+	assert.Equal(t, int32(2), stream.Response.GetInserted())
+	assert.Equal(t, int32(2), stream.Response.GetFailed())
+	for _, failure := range stream.Response.GetFailure() {
+		assert.Equal(t, int32(codes.PermissionDenied), failure.GetCode())
+	}
+}
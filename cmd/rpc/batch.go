@@ -0,0 +1,230 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const DEFAULT_BATCH_LIMIT = 500
+
+// Set the maximum amount of items accepted by the batch RPCs. A non-positive limit keeps the
+// current one
+func (s *server) SetBatchLimit(limit int) {
+	if limit > 0 {
+		s.batchLimit = limit
+	}
+}
+
+func (s *server) checkBatchSize(size int) error {
+	if size == 0 {
+		return status.Error(codes.InvalidArgument, "The batch is empty")
+	}
+	if size > s.batchLimit {
+		return status.Errorf(codes.InvalidArgument, "The batch has %d items, the limit is %d", size, s.batchLimit)
+	}
+	return nil
+}
+
+// Validates every item of a batch. Returns the error of each item and the indexes of the valid
+// ones, which are sent to the database. When ordered, the validation stops at the first invalid item.
+// Errors without a status code are invalid arguments
+func validateBatch(size int, ordered bool, validate func(i int) error) ([]error, []int) {
+	errs := make([]error, size)
+	var indexes []int
+	for i := 0; i < size; i++ {
+		if err := validate(i); err != nil {
+			errs[i] = err
+			if _, ok := status.FromError(err); !ok {
+				errs[i] = status.Error(codes.InvalidArgument, err.Error())
+			}
+			if ordered {
+				for j := i + 1; j < size; j++ {
+					errs[j] = database.ErrNotExecuted
+				}
+				break
+			}
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return errs, indexes
+}
+
+// Every write of a vote repeated in a batch would be reported, though only one of them is applied
+func checkUniqueIDs(ids []string) error {
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		id = strings.ToLower(id)
+		if seen[id] {
+			return status.Errorf(codes.InvalidArgument, "The vote %s is repeated in the batch", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// Converts the error of each item to its result
+func batchResults(ids []string, errs []error) []*pb.BatchItemResult {
+	results := make([]*pb.BatchItemResult, len(errs))
+	for i, err := range errs {
+		results[i] = itemResult(i, ids[i], err)
+	}
+	return results
+}
+
+func itemResult(index int, id string, err error) *pb.BatchItemResult {
+	result := &pb.BatchItemResult{Index: int32(index), Id: id}
+	if err == nil {
+		return result
+	}
+	switch err {
+	case mongo.ErrNoDocuments:
+		err = status.Error(codes.NotFound, "Could not find the vote requested")
+	case database.ErrNotExecuted:
+		err = status.Error(codes.Aborted, err.Error())
+	default:
+		err = repositoryError(err)
+	}
+	st := status.Convert(err)
+	result.Code = int32(st.Code())
+	result.Message = st.Message()
+	return result
+}
+
+// Insert many votes at once. Every vote gets its own result, so partial failures are visible
+func (s *server) BatchInsert(ctx context.Context, req *pb.BatchInsertRequest) (*pb.BatchInsertResponse, error) {
+	s.requestLogger(ctx).Debug("batch insert votes", zap.Int("items", len(req.Vote)), zap.Bool("ordered", req.Ordered))
+	if err := s.checkBatchSize(len(req.Vote)); err != nil {
+		return nil, err
+	}
+	votes := make([]database.VoteModel, len(req.Vote))
+	invalid := make([]error, len(req.Vote))
+	var parsed []database.VoteModel
+	for i := range req.Vote {
+		if votes[i], invalid[i] = newVoteModel(req.Vote[i]); invalid[i] == nil {
+			parsed = append(parsed, votes[i])
+		}
+	}
+	// the bans of every user are looked up at once
+	banned, err := s.checkBans(ctx, parsed)
+	if err != nil {
+		return nil, err
+	}
+	errs, indexes := validateBatch(len(req.Vote), req.Ordered, func(i int) error {
+		if invalid[i] != nil {
+			return invalid[i]
+		}
+		return banned[votes[i].User]
+	})
+	if len(indexes) > 0 {
+		var valid []database.VoteModel
+		for _, i := range indexes {
+			valid = append(valid, votes[i])
+		}
+		written, err := s.repository.BulkInsert(ctx, valid, req.Ordered)
+		if err != nil {
+			return nil, repositoryError(err)
+		}
+		for j, i := range indexes {
+			errs[i] = written[j]
+			if written[j] == nil {
+				countVote(voteDirection(&votes[i]), "inserted")
+			}
+		}
+	}
+	// only the votes inserted have an id
+	ids := make([]string, len(req.Vote))
+	for i := range ids {
+		if errs[i] == nil {
+			ids[i] = votes[i].ID.Hex()
+		}
+	}
+	return &pb.BatchInsertResponse{Result: batchResults(ids, errs)}, nil
+}
+
+// Modify the UPVOTE value of many votes at once
+func (s *server) BatchUpdate(ctx context.Context, req *pb.BatchUpdateRequest) (*pb.BatchUpdateResponse, error) {
+	s.requestLogger(ctx).Debug("batch update votes", zap.Int("items", len(req.Vote)), zap.Bool("ordered", req.Ordered))
+	if err := s.checkBatchSize(len(req.Vote)); err != nil {
+		return nil, err
+	}
+	voteIds := make([]string, len(req.Vote))
+	for i, vote := range req.Vote {
+		voteIds[i] = vote.GetId()
+	}
+	if err := checkUniqueIDs(voteIds); err != nil {
+		return nil, err
+	}
+	owners, err := s.voteOwners(ctx, req.Vote)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	updates := make([]database.UpvoteUpdate, len(req.Vote))
+	ids := make([]string, len(req.Vote))
+	errs, indexes := validateBatch(len(req.Vote), req.Ordered, func(i int) (err error) {
+		ids[i] = req.Vote[i].GetId()
+		updates[i].ID, err = primitive.ObjectIDFromHex(ids[i])
+		updates[i].Upvote = req.Vote[i].GetNewValue()
+		updates[i].ExpectedVersion = req.Vote[i].GetExpectedVersion()
+		if err != nil {
+			return err
+		}
+		// votes not found fail when updated
+		if owner, ok := owners[updates[i].ID]; ok {
+			return s.checkBan(ctx, owner)
+		}
+		return nil
+	})
+	if len(indexes) > 0 {
+		var valid []database.UpvoteUpdate
+		for _, i := range indexes {
+			valid = append(valid, updates[i])
+		}
+		written, err := s.repository.BulkUpdateUpvote(ctx, valid, req.Ordered)
+		if err != nil {
+			return nil, repositoryError(err)
+		}
+		for j, i := range indexes {
+			errs[i] = written[j]
+		}
+	}
+	return &pb.BatchUpdateResponse{Result: batchResults(ids, errs)}, nil
+}
+
+// Remove many votes at once. As in DeleteOne, the votes are only marked as deleted
+func (s *server) BatchDelete(ctx context.Context, req *pb.BatchDeleteRequest) (*pb.BatchDeleteResponse, error) {
+	s.requestLogger(ctx).Debug("batch delete votes", zap.Int("items", len(req.Id)), zap.Bool("ordered", req.Ordered))
+	if err := s.checkBatchSize(len(req.Id)); err != nil {
+		return nil, err
+	}
+	if err := checkUniqueIDs(req.Id); err != nil {
+		return nil, err
+	}
+	voteIds := make([]primitive.ObjectID, len(req.Id))
+	errs, indexes := validateBatch(len(req.Id), req.Ordered, func(i int) (err error) {
+		voteIds[i], err = primitive.ObjectIDFromHex(req.Id[i])
+		return err
+	})
+	if len(indexes) > 0 {
+		var valid []primitive.ObjectID
+		for _, i := range indexes {
+			valid = append(valid, voteIds[i])
+		}
+		written, err := s.repository.BulkSoftDelete(ctx, valid, req.Ordered)
+		if err != nil {
+			return nil, repositoryError(err)
+		}
+		for j, i := range indexes {
+			errs[i] = written[j]
+		}
+	}
+	return &pb.BatchDeleteResponse{Result: batchResults(req.Id, errs)}, nil
+}
@@ -0,0 +1,125 @@
+package rpc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBatchInsert(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_id := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res, err := s.BatchInsert(mock_ctx, &pb.BatchInsertRequest{Vote: []*pb.VoteStruct{
+		{Video: mock_id, User: mock_id, Upvote: true},
+		{Video: "invalid", User: mock_id, Upvote: true},
+		{Video: mock_id, User: primitive.NewObjectID().Hex(), Upvote: false},
+	}})
+	if err != nil {
+		t.Fatalf("Error inside BatchInsert: %v", err)
+	}
+	assert.Len(t, res.Result, 3)
+	assert.Equal(t, int32(codes.OK), res.Result[0].GetCode())
+	assert.Equal(t, int32(codes.InvalidArgument), res.Result[1].GetCode())
+	assert.Equal(t, "", res.Result[1].GetId(), "Votes not inserted should not have an id")
+	assert.Equal(t, int32(codes.OK), res.Result[2].GetCode())
+	res_get, err := s.Get(mock_ctx, &pb.GetRequest{Id: res.Result[2].GetId()})
+	if err != nil {
+		t.Fatalf("Error inside Get: %v", err)
+	}
+	assert.Equal(t, false, res_get.GetVote().GetUpvote())
+}
+
+func TestBatchInsertOrdered(t *testing.T) {
+	mock_id := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res, err := s.BatchInsert(context.Background(), &pb.BatchInsertRequest{Ordered: true, Vote: []*pb.VoteStruct{
+		{Video: mock_id, User: mock_id, Upvote: true},
+		{Video: "invalid", User: mock_id, Upvote: true},
+		{Video: mock_id, User: primitive.NewObjectID().Hex(), Upvote: false},
+	}})
+	if err != nil {
+		t.Fatalf("Error inside BatchInsert: %v", err)
+	}
+	assert.Equal(t, int32(codes.OK), res.Result[0].GetCode())
+	assert.Equal(t, int32(codes.InvalidArgument), res.Result[1].GetCode())
+	assert.Equal(t, int32(codes.Aborted), res.Result[2].GetCode(), "Items after a failure should not be executed")
+}
+
+func TestBatchLimit(t *testing.T) {
+	mock_id := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	s.SetBatchLimit(1)
+	_, err = s.BatchDelete(context.Background(), &pb.BatchDeleteRequest{Id: []string{mock_id, mock_id}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "Batches over the limit should be refused")
+}
+
+func TestBatchRepeatedIDs(t *testing.T) {
+	mock_id := primitive.NewObjectID().Hex()
+	client := database.NewMongoClient()
+	s := rpc.NewGrpcServer(&client)
+	_, err := s.BatchUpdate(context.Background(), &pb.BatchUpdateRequest{Vote: []*pb.UpdateOneRequest{{Id: mock_id}, {Id: strings.ToUpper(mock_id)}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "Repeated votes should be refused")
+	_, err = s.BatchDelete(context.Background(), &pb.BatchDeleteRequest{Id: []string{mock_id, primitive.NewObjectID().Hex(), mock_id}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "Repeated votes should be refused")
+}
+
+func TestBatchUpdateAndDelete(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_id := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res_insert, err := s.BatchInsert(mock_ctx, &pb.BatchInsertRequest{Vote: []*pb.VoteStruct{
+		{Video: mock_id, User: mock_id, Upvote: true},
+		{Video: mock_id, User: primitive.NewObjectID().Hex(), Upvote: true},
+	}})
+	if err != nil {
+		t.Fatalf("Error inside BatchInsert: %v", err)
+	}
+	id_0, id_1 := res_insert.Result[0].GetId(), res_insert.Result[1].GetId()
+	missing := primitive.NewObjectID().Hex()
+	res_update, err := s.BatchUpdate(mock_ctx, &pb.BatchUpdateRequest{Vote: []*pb.UpdateOneRequest{
+		{Id: id_0, NewValue: false},
+		{Id: missing, NewValue: false},
+	}})
+	if err != nil {
+		t.Fatalf("Error inside BatchUpdate: %v", err)
+	}
+	assert.Equal(t, int32(codes.OK), res_update.Result[0].GetCode())
+	assert.Equal(t, int32(codes.NotFound), res_update.Result[1].GetCode())
+	res_delete, err := s.BatchDelete(mock_ctx, &pb.BatchDeleteRequest{Id: []string{id_0, id_1, missing}})
+	if err != nil {
+		t.Fatalf("Error inside BatchDelete: %v", err)
+	}
+	assert.Equal(t, int32(codes.OK), res_delete.Result[0].GetCode())
+	assert.Equal(t, int32(codes.OK), res_delete.Result[1].GetCode())
+	assert.Equal(t, int32(codes.NotFound), res_delete.Result[2].GetCode())
+	res_list, err := s.ListVotesInVideo(mock_ctx, &pb.ListVotesInVideoRequest{Id: mock_id})
+	if err != nil {
+		t.Fatalf("Error in ListVotesInVideo. %v", err)
+	}
+	assert.Len(t, res_list.Vote, 0, "Deleted votes should not be listed")
+}
@@ -0,0 +1,44 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Creates the repository of a server, reading through the cache if there is one
+func newRepository(client *database.MongoClient, databaseName string, tenants tenant.Config, voteCache *database.VoteCache, provision database.TenantProvisioner) database.VoteRepository {
+	repository := database.NewProvisionedVoteRepository(client, databaseName, tenants, provision)
+	if voteCache == nil {
+		return repository
+	}
+	return database.NewCachedVoteRepository(repository, voteCache, tenants)
+}
+
+// Set the cache votes and tallies are read through. Every server writing votes must share the same
+// cache, so their writes invalidate the entries read by the others
+func (s *server) SetCache(voteCache *database.VoteCache) {
+	s.cache = voteCache
+	s.setStores()
+}
+
+func (s *adminServer) SetCache(voteCache *database.VoteCache) {
+	s.cache = voteCache
+	s.setStores()
+}
+
+// Get the hits and misses of the cache of votes and tallies since the server started
+func (s *adminServer) GetCacheStats(ctx context.Context, req *pb.GetCacheStatsRequest) (*pb.GetCacheStatsResponse, error) {
+	if s.cache == nil {
+		return nil, status.Error(codes.FailedPrecondition, "The cache is disabled")
+	}
+	stats := s.cache.Stats()
+	return &pb.GetCacheStatsResponse{
+		Votes:   &pb.CacheCounts{Hits: stats.Votes.Hits, Misses: stats.Votes.Misses},
+		Tallies: &pb.CacheCounts{Hits: stats.Tallies.Hits, Misses: stats.Tallies.Misses},
+	}, nil
+}
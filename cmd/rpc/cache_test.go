@@ -0,0 +1,95 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	"github.com/IsaqueB/ps-klever/pkg/cache"
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func initACachedServer() (rpc.Server, rpc.AdminServer, error) {
+	s, err := initAServer()
+	if err != nil {
+		return nil, nil, err
+	}
+	voteCache := database.NewVoteCache(cache.NewLRU(100), time.Minute, time.Minute)
+	s.SetCache(voteCache)
+	admin := rpc.NewAdminServer(s.GetClient())
+	admin.SetDatabase(rpc.TEST_DB)
+	admin.SetCache(voteCache)
+	return s, admin, nil
+}
+
+func TestCachedGet(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_id := primitive.NewObjectID().Hex()
+	s, admin, err := initACachedServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res_insert, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true}})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.Get(mock_ctx, &pb.GetRequest{Id: res_insert.Id}); err != nil {
+			t.Fatalf("Error inside Get: %v", err)
+		}
+	}
+	stats, err := admin.GetCacheStats(mock_ctx, &pb.GetCacheStatsRequest{})
+	if err != nil {
+		t.Fatalf("Error inside GetCacheStats: %v", err)
+	}
+	assert.Equal(t, uint64(1), stats.Votes.Misses, "The first Get should miss the cache")
+	assert.Equal(t, uint64(1), stats.Votes.Hits, "The second Get should hit the cache")
+	// writes invalidate the vote cached
+	if _, err := s.UpdateOne(mock_ctx, &pb.UpdateOneRequest{Id: res_insert.Id, NewValue: false}); err != nil {
+		t.Fatalf("Error inside UpdateOne: %v", err)
+	}
+	res_get, err := s.Get(mock_ctx, &pb.GetRequest{Id: res_insert.Id})
+	if err != nil {
+		t.Fatalf("Error inside Get: %v", err)
+	}
+	assert.False(t, res_get.Vote.Upvote, "Get should not return the vote cached before the update")
+	if _, err := s.DeleteOne(mock_ctx, &pb.DeleteOneRequest{Id: res_insert.Id}); err != nil {
+		t.Fatalf("Error inside DeleteOne: %v", err)
+	}
+	_, err = s.Get(mock_ctx, &pb.GetRequest{Id: res_insert.Id})
+	assert.Error(t, err, "Deleted votes should not be returned from the cache")
+	// restoring through the admin server invalidates the cache shared with the vote server
+	if _, err := admin.RestoreVote(mock_ctx, &pb.RestoreVoteRequest{Id: res_insert.Id}); err != nil {
+		t.Fatalf("Error inside RestoreVote: %v", err)
+	}
+	if _, err := s.Get(mock_ctx, &pb.GetRequest{Id: res_insert.Id}); err != nil {
+		t.Fatalf("Error inside Get: %v", err)
+	}
+}
+
+func TestCachedTallies(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	s, _, err := initACachedServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	tally := func() *pb.VideoTally {
+		res, err := s.BatchGetVideoTallies(mock_ctx, &pb.BatchGetVideoTalliesRequest{Video: []string{mock_video}})
+		if err != nil {
+			t.Fatalf("Error inside BatchGetVideoTallies: %v", err)
+		}
+		return res.Tallies[mock_video]
+	}
+	assert.Equal(t, int64(0), tally().Upvotes)
+	if _, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true}}); err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	assert.Equal(t, int64(1), tally().Upvotes, "Inserting should invalidate the tally of the video")
+}
@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/metrics"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Direction of a vote, DIRECTION_NONE if it was retracted
+func voteDirection(vote *database.VoteModel) pb.Direction {
+	if vote == nil || vote.DeletedAt != nil {
+		return pb.Direction_DIRECTION_NONE
+	}
+	if vote.Upvote {
+		return pb.Direction_DIRECTION_UP
+	}
+	return pb.Direction_DIRECTION_DOWN
+}
+
+// Counts a vote written by direction and by what was done to it, such as "inserted" or "pending"
+func countVote(direction pb.Direction, action string) {
+	metrics.VoteCast(strings.ToLower(strings.TrimPrefix(direction.String(), "DIRECTION_")), action)
+}
+
+func castActionName(action database.CastAction) string {
+	// the actions are declared in the same order in both packages
+	return strings.ToLower(strings.TrimPrefix(pb.CastAction(action).String(), "CAST_"))
+}
+
+// Set the vote of an USER on a VIDEO to the direction requested in a single atomic write, inserting,
+// flipping or retracting it. Casting the direction the vote already has changes nothing, so
+// retrying is safe. Answers with the resulting state and the tally of the VIDEO
+func (s *server) CastVote(ctx context.Context, req *pb.CastVoteRequest) (*pb.CastVoteResponse, error) {
+	s.requestLogger(ctx).Debug("cast vote", zap.String("video", req.Video), zap.String("user", req.User), zap.Stringer("direction", req.Direction))
+	videoId, err := primitive.ObjectIDFromHex(req.Video)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	userId, err := primitive.ObjectIDFromHex(req.User)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var direction database.Direction
+	switch req.Direction {
+	case pb.Direction_DIRECTION_NONE:
+		direction = database.DIRECTION_NONE
+	case pb.Direction_DIRECTION_UP:
+		direction = database.DIRECTION_UP
+	case pb.Direction_DIRECTION_DOWN:
+		direction = database.DIRECTION_DOWN
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown direction %d", req.Direction)
+	}
+	// banned users can still retract their votes, as they can delete them
+	if direction != database.DIRECTION_NONE {
+		if err := s.checkBan(ctx, userId); err != nil {
+			return nil, err
+		}
+	}
+	if s.writeBehind != nil {
+		return s.castVoteBehind(ctx, videoId, userId, direction, req.Direction)
+	}
+	vote, action, err := s.repository.CastVote(ctx, videoId, userId, direction)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	countVote(req.Direction, castActionName(action))
+	tally, err := s.repository.Tally(ctx, videoId)
+	if err != nil {
+		return nil, err
+	}
+	response := &pb.CastVoteResponse{
+		Direction: voteDirection(vote),
+		// the actions are declared in the same order in both packages
+		Action: pb.CastAction(action),
+		Tally:  toVideoTally(tally),
+	}
+	if vote != nil {
+		response.Vote = toVoteStruct(vote)
+	}
+	return response, nil
+}
@@ -0,0 +1,95 @@
+package rpc_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCastVote(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	mock_user := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	cast := func(direction pb.Direction) *pb.CastVoteResponse {
+		res, err := s.CastVote(mock_ctx, &pb.CastVoteRequest{Video: mock_video, User: mock_user, Direction: direction})
+		if err != nil {
+			t.Fatalf("Error inside CastVote: %v", err)
+		}
+		return res
+	}
+	res := cast(pb.Direction_DIRECTION_UP)
+	assert.Equal(t, pb.CastAction_CAST_INSERTED, res.Action)
+	assert.Equal(t, pb.Direction_DIRECTION_UP, res.Direction)
+	assert.Equal(t, int64(1), res.Tally.Upvotes)
+	assert.Equal(t, int64(0), res.Tally.Downvotes)
+	vote_id := res.Vote.Id
+
+	res = cast(pb.Direction_DIRECTION_UP)
+	assert.Equal(t, pb.CastAction_CAST_UNCHANGED, res.Action, "Casting the same direction again should change nothing")
+	assert.Equal(t, int64(1), res.Vote.Version)
+
+	res = cast(pb.Direction_DIRECTION_DOWN)
+	assert.Equal(t, pb.CastAction_CAST_FLIPPED, res.Action)
+	assert.Equal(t, vote_id, res.Vote.Id, "Flipping should keep the same vote")
+	assert.Equal(t, int64(0), res.Tally.Upvotes)
+	assert.Equal(t, int64(1), res.Tally.Downvotes)
+
+	res = cast(pb.Direction_DIRECTION_NONE)
+	assert.Equal(t, pb.CastAction_CAST_RETRACTED, res.Action)
+	assert.Equal(t, pb.Direction_DIRECTION_NONE, res.Direction)
+	assert.Equal(t, int64(0), res.Tally.Downvotes)
+
+	res = cast(pb.Direction_DIRECTION_NONE)
+	assert.Equal(t, pb.CastAction_CAST_UNCHANGED, res.Action)
+	assert.Nil(t, res.Vote, "There should be no vote after retracting")
+
+	res = cast(pb.Direction_DIRECTION_UP)
+	assert.Equal(t, pb.CastAction_CAST_INSERTED, res.Action)
+	assert.Equal(t, int64(1), res.Tally.Upvotes)
+}
+
+func TestCastVoteConcurrent(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	mock_user := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.CastVote(mock_ctx, &pb.CastVoteRequest{Video: mock_video, User: mock_user, Direction: pb.Direction_DIRECTION_UP}); err != nil {
+				t.Errorf("Error inside CastVote: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	res, err := s.ListVotesInVideo(mock_ctx, &pb.ListVotesInVideoRequest{Id: mock_video})
+	if err != nil {
+		t.Fatalf("Error inside ListVotesInVideo: %v", err)
+	}
+	assert.Len(t, res.Vote, 1, "Concurrent casts should create a single vote")
+}
+
+func TestCastVoteInvalid(t *testing.T) {
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	_, err = s.CastVote(context.Background(), &pb.CastVoteRequest{Video: "invalid", User: primitive.NewObjectID().Hex()})
+	assert.Error(t, err)
+}
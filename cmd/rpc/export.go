@@ -0,0 +1,157 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Amount of votes sent in each chunk of an export
+const EXPORT_CHUNK_SIZE = 500
+
+// Columns of the CSV exports
+var exportHeader = []string{"id", "video", "user", "upvote", "version", "created_at", "updated_at"}
+
+func formatTimestamp(timestamp *timestamppb.Timestamp) string {
+	if timestamp == nil {
+		return ""
+	}
+	return timestamp.AsTime().Format(time.RFC3339Nano)
+}
+
+// Appends the line of a vote to an export
+func writeExportLine(buffer *bytes.Buffer, format pb.ExportFormat, vote *pb.VoteStruct) error {
+	if format == pb.ExportFormat_EXPORT_FORMAT_NDJSON {
+		line, err := protojson.Marshal(vote)
+		if err != nil {
+			return err
+		}
+		buffer.Write(line)
+		return buffer.WriteByte('\n')
+	}
+	writer := csv.NewWriter(buffer)
+	writer.Write([]string{
+		vote.GetId(),
+		vote.GetVideo(),
+		vote.GetUser(),
+		strconv.FormatBool(vote.GetUpvote()),
+		strconv.FormatInt(vote.GetVersion(), 10),
+		formatTimestamp(vote.GetCreatedAt()),
+		formatTimestamp(vote.GetUpdatedAt()),
+	})
+	writer.Flush()
+	return writer.Error()
+}
+
+// Converts the filters of an export request, and its cursor to the id the export resumes after
+func exportFilter(req *pb.ExportVotesRequest) (database.VoteFilter, primitive.ObjectID, error) {
+	var filter database.VoteFilter
+	if req.Video != "" {
+		videoId, err := primitive.ObjectIDFromHex(req.Video)
+		if err != nil {
+			return filter, primitive.NilObjectID, err
+		}
+		filter.Video = &videoId
+	}
+	if req.User != "" {
+		userId, err := primitive.ObjectIDFromHex(req.User)
+		if err != nil {
+			return filter, primitive.NilObjectID, err
+		}
+		filter.User = &userId
+	}
+	if req.CreatedFrom != nil {
+		if err := req.CreatedFrom.CheckValid(); err != nil {
+			return filter, primitive.NilObjectID, err
+		}
+		from := req.CreatedFrom.AsTime()
+		filter.CreatedFrom = &from
+	}
+	if req.CreatedTo != nil {
+		if err := req.CreatedTo.CheckValid(); err != nil {
+			return filter, primitive.NilObjectID, err
+		}
+		to := req.CreatedTo.AsTime()
+		filter.CreatedTo = &to
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedTo.After(*filter.CreatedFrom) {
+		return filter, primitive.NilObjectID, errors.New("created_to must be after created_from")
+	}
+	switch req.Direction {
+	case pb.Direction_DIRECTION_NONE:
+	case pb.Direction_DIRECTION_UP, pb.Direction_DIRECTION_DOWN:
+		upvote := req.Direction == pb.Direction_DIRECTION_UP
+		filter.Upvote = &upvote
+	default:
+		return filter, primitive.NilObjectID, fmt.Errorf("Unknown direction %d", req.Direction)
+	}
+	if req.Format != pb.ExportFormat_EXPORT_FORMAT_CSV && req.Format != pb.ExportFormat_EXPORT_FORMAT_NDJSON {
+		return filter, primitive.NilObjectID, fmt.Errorf("Unknown format %d", req.Format)
+	}
+	after := primitive.NilObjectID
+	if req.Cursor != "" {
+		var err error
+		if after, err = primitive.ObjectIDFromHex(req.Cursor); err != nil {
+			return filter, primitive.NilObjectID, errors.New("Invalid cursor")
+		}
+	}
+	return filter, after, nil
+}
+
+// Streams the votes matching the filters in chunks of CSV or NDJSON lines, in the order of their
+// ids. Each chunk carries the cursor which resumes the export after it, so a client whose stream
+// broke requests the rest with the cursor of the last chunk it received
+func (s *server) ExportVotes(req *pb.ExportVotesRequest, stream pb.Vote_ExportVotesServer) error {
+	ctx := stream.Context()
+	s.requestLogger(ctx).Debug("export votes", zap.String("video", req.Video), zap.String("user", req.User),
+		zap.Stringer("direction", req.Direction), zap.Stringer("format", req.Format), zap.String("cursor", req.Cursor))
+	filter, after, err := exportFilter(req)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	var buffer bytes.Buffer
+	if req.Format == pb.ExportFormat_EXPORT_FORMAT_CSV && req.Cursor == "" {
+		writer := csv.NewWriter(&buffer)
+		writer.Write(exportHeader)
+		writer.Flush()
+	}
+	chunk := &pb.ExportVotesResponse{Cursor: req.Cursor}
+	send := func() error {
+		if chunk.Votes == 0 && buffer.Len() == 0 {
+			return nil
+		}
+		chunk.Data = buffer.Bytes()
+		// the message is serialized by Send, so the buffer can be reused once it returns
+		err := stream.Send(chunk)
+		buffer.Reset()
+		chunk.Votes = 0
+		return err
+	}
+	err = s.repository.Scan(ctx, filter, after, func(vote database.VoteModel) error {
+		if err := writeExportLine(&buffer, req.Format, toVoteStruct(&vote)); err != nil {
+			return err
+		}
+		chunk.Votes++
+		chunk.Cursor = vote.ID.Hex()
+		if chunk.Votes == EXPORT_CHUNK_SIZE {
+			return send()
+		}
+		return nil
+	})
+	if err != nil {
+		return repositoryError(err)
+	}
+	return send()
+}
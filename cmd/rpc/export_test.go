@@ -0,0 +1,74 @@
+package rpc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type mockVoteExportVotesServer struct {
+	grpc.ServerStream
+	Chunks []*pb.ExportVotesResponse
+}
+
+func (x *mockVoteExportVotesServer) Context() context.Context {
+	return context.Background()
+}
+
+func (x *mockVoteExportVotesServer) Send(m *pb.ExportVotesResponse) error {
+	// the server reuses the buffer of the data once Send returns
+	m.Data = append([]byte(nil), m.Data...)
+	x.Chunks = append(x.Chunks, m)
+	return nil
+}
+
+func TestExportVotes(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	var mock_ids []string
+	for _, upvote := range []bool{true, false, true} {
+		res, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: upvote}})
+		if err != nil {
+			t.Fatalf("Error inserting vote. %v", err)
+		}
+		mock_ids = append(mock_ids, res.GetId())
+	}
+
+	stream := mockVoteExportVotesServer{}
+	if err = s.ExportVotes(&pb.ExportVotesRequest{Video: mock_video, Direction: pb.Direction_DIRECTION_UP}, &stream); err != nil {
+		t.Fatalf("Error in ExportVotes. %v", err)
+	}
+	assert.Len(t, stream.Chunks, 1)
+	lines := strings.Split(strings.TrimSuffix(string(stream.Chunks[0].Data), "\n"), "\n")
+	assert.Len(t, lines, 3, "The header and the upvotes should be exported")
+	assert.Equal(t, "id,video,user,upvote,version,created_at,updated_at", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], mock_ids[0]+","+mock_video+","))
+	assert.True(t, strings.HasPrefix(lines[2], mock_ids[2]+","+mock_video+","))
+	assert.Equal(t, int32(2), stream.Chunks[0].Votes)
+	assert.Equal(t, mock_ids[2], stream.Chunks[0].Cursor)
+
+	// resumes after the first vote, without the header
+	stream = mockVoteExportVotesServer{}
+	req := &pb.ExportVotesRequest{Video: mock_video, Format: pb.ExportFormat_EXPORT_FORMAT_NDJSON, Cursor: mock_ids[0]}
+	if err = s.ExportVotes(req, &stream); err != nil {
+		t.Fatalf("Error in ExportVotes. %v", err)
+	}
+	assert.Len(t, stream.Chunks, 1)
+	assert.Equal(t, int32(2), stream.Chunks[0].Votes)
+	assert.True(t, strings.HasPrefix(string(stream.Chunks[0].Data), `{"id":"`+mock_ids[1]+`"`))
+
+	err = s.ExportVotes(&pb.ExportVotesRequest{Cursor: "invalid"}, &mockVoteExportVotesServer{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/IsaqueB/ps-klever/pkg/chaos"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var distributions = map[pb.LatencyDistribution]string{
+	pb.LatencyDistribution_LATENCY_DISTRIBUTION_UNIFORM: chaos.UNIFORM_DISTRIBUTION,
+	pb.LatencyDistribution_LATENCY_DISTRIBUTION_NORMAL:  chaos.NORMAL_DISTRIBUTION,
+}
+
+// Set the injector of faults into the gRPC server, only given outside production
+func (s *adminServer) SetFaultInjector(injector *chaos.Injector) {
+	s.faults = injector
+}
+
+func toFaultConfig(config *pb.FaultInjection) chaos.Config {
+	result := chaos.Config{Enabled: config.GetEnabled(), Seed: config.GetSeed()}
+	for _, rule := range config.GetRule() {
+		r := chaos.Rule{Method: rule.Method, DropProbability: rule.DropProbability, DropAfter: int(rule.DropAfter)}
+		for _, e := range rule.Error {
+			r.Errors = append(r.Errors, chaos.Error{Code: codes.Code(e.Code), Probability: e.Probability})
+		}
+		if latency := rule.Latency; latency != nil {
+			distribution, ok := distributions[latency.Distribution]
+			if !ok {
+				distribution = latency.Distribution.String()
+			}
+			r.Latency = &chaos.Latency{
+				Probability:  latency.Probability,
+				Distribution: distribution,
+				Min:          latency.Min.AsDuration(),
+				Max:          latency.Max.AsDuration(),
+			}
+		}
+		result.Rules = append(result.Rules, r)
+	}
+	return result
+}
+
+func toFaultInjection(config chaos.Config) *pb.FaultInjection {
+	result := &pb.FaultInjection{Enabled: config.Enabled, Seed: config.Seed}
+	for _, rule := range config.Rules {
+		r := &pb.FaultRule{Method: rule.Method, DropProbability: rule.DropProbability, DropAfter: int32(rule.DropAfter)}
+		for _, e := range rule.Errors {
+			r.Error = append(r.Error, &pb.FaultError{Code: int32(e.Code), Probability: e.Probability})
+		}
+		if latency := rule.Latency; latency != nil {
+			r.Latency = &pb.FaultLatency{
+				Probability: latency.Probability,
+				Min:         durationpb.New(latency.Min),
+				Max:         durationpb.New(latency.Max),
+			}
+			for distribution, name := range distributions {
+				if name == latency.Distribution {
+					r.Latency.Distribution = distribution
+				}
+			}
+		}
+		result.Rule = append(result.Rule, r)
+	}
+	return result
+}
+
+// Get the faults being injected into the calls of the Vote service
+func (s *adminServer) GetFaultInjection(ctx context.Context, req *pb.GetFaultInjectionRequest) (*pb.GetFaultInjectionResponse, error) {
+	if s.faults == nil {
+		return nil, status.Error(codes.FailedPrecondition, "Fault injection is disabled")
+	}
+	return &pb.GetFaultInjectionResponse{Config: toFaultInjection(s.faults.Config())}, nil
+}
+
+// Replace the faults injected into the calls of the Vote service over gRPC, the HTTP API is not
+// affected. Setting the same seed again replays the same faults
+func (s *adminServer) SetFaultInjection(ctx context.Context, req *pb.SetFaultInjectionRequest) (*pb.SetFaultInjectionResponse, error) {
+	actor, err := adminActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.faults == nil {
+		return nil, status.Error(codes.FailedPrecondition, "Fault injection is disabled")
+	}
+	config := toFaultConfig(req.GetConfig())
+	if err = s.faults.Set(config); err != nil {
+		if errors.Is(err, chaos.ErrInvalidConfig) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, err
+	}
+	s.requestLogger(ctx).Warn("fault injection set", zap.String("actor", actor), zap.Bool("enabled", config.Enabled), zap.Int64("seed", config.Seed), zap.Int("rules", len(config.Rules)))
+	return &pb.SetFaultInjectionResponse{Config: toFaultInjection(config)}, nil
+}
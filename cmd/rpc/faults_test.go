@@ -0,0 +1,57 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	"github.com/IsaqueB/ps-klever/pkg/auth"
+	"github.com/IsaqueB/ps-klever/pkg/chaos"
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestFaultInjection(t *testing.T) {
+	mock_ctx := auth.NewContext(context.Background(), auth.Identity{Subject: "moderator", Roles: []string{auth.ADMIN_ROLE}})
+	client := database.NewMongoClient()
+	admin := rpc.NewAdminServer(&client)
+	_, err := admin.SetFaultInjection(context.Background(), &pb.SetFaultInjectionRequest{Config: &pb.FaultInjection{Enabled: true}})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "Faults should only be set by admins")
+	_, err = admin.SetFaultInjection(auth.NewContext(context.Background(), auth.Identity{Subject: "app"}), &pb.SetFaultInjectionRequest{Config: &pb.FaultInjection{Enabled: true}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = admin.SetFaultInjection(mock_ctx, &pb.SetFaultInjectionRequest{Config: &pb.FaultInjection{Enabled: true}})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "Faults should only be injected when the injector is set")
+
+	injector := chaos.NewInjector(pb.Vote_ServiceDesc.ServiceName)
+	admin.SetFaultInjector(injector)
+	config := &pb.FaultInjection{Enabled: true, Seed: 3, Rule: []*pb.FaultRule{{
+		Method:          "Get",
+		Error:           []*pb.FaultError{{Code: int32(codes.Unavailable), Probability: 0.5}},
+		Latency:         &pb.FaultLatency{Probability: 0.1, Distribution: pb.LatencyDistribution_LATENCY_DISTRIBUTION_NORMAL, Min: durationpb.New(time.Millisecond), Max: durationpb.New(10 * time.Millisecond)},
+		DropProbability: 0.2,
+		DropAfter:       4,
+	}}}
+	res_set, err := admin.SetFaultInjection(mock_ctx, &pb.SetFaultInjectionRequest{Config: config})
+	if err != nil {
+		t.Fatalf("Error inside SetFaultInjection: %v", err)
+	}
+	assert.True(t, proto.Equal(config, res_set.GetConfig()))
+	assert.Equal(t, int64(3), injector.Config().Seed)
+	assert.Equal(t, chaos.NORMAL_DISTRIBUTION, injector.Config().Rules[0].Latency.Distribution)
+	res_get, err := admin.GetFaultInjection(mock_ctx, &pb.GetFaultInjectionRequest{})
+	if err != nil {
+		t.Fatalf("Error inside GetFaultInjection: %v", err)
+	}
+	assert.True(t, proto.Equal(config, res_get.GetConfig()))
+
+	config.Rule[0].Error[0].Probability = 2
+	_, err = admin.SetFaultInjection(mock_ctx, &pb.SetFaultInjectionRequest{Config: config})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, int64(3), injector.Config().Seed, "An invalid config should not replace the current one")
+}
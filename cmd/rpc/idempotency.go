@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// Metadata key of the idempotency key. The HTTP gateway forwards the Idempotency-Key header to it
+	IDEMPOTENCY_METADATA_KEY = "idempotency-key"
+	DEFAULT_IDEMPOTENCY_TTL  = 24 * time.Hour
+	// how long a key stays reserved by a request that didn't finish, in case the server stops
+	idempotencyTimeout = time.Minute
+	// attempts to store the response of a request whose write is done, and how long each one takes
+	idempotencyCompleteAttempts = 3
+	idempotencyStoreTimeout     = 5 * time.Second
+)
+
+// Keeps the values of the request, such as its tenant and caller, but not its deadline or
+// cancellation, to update the key once the write is done even if the caller went away
+type detachedContext struct{ context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// Set for how long the responses of requests with an idempotency key are replayed
+func (s *server) SetIdempotencyTTL(ttl time.Duration) {
+	s.idempotencyTTL = ttl
+}
+
+func idempotencyKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(IDEMPOTENCY_METADATA_KEY); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Hash of the request, including its type so a key can't be reused by another RPC
+func requestHash(req proto.Message) (string, error) {
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(proto.MessageName(req)))
+	hash.Write(payload)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Runs handler only once for each idempotency key sent by the caller, writing its response in
+// response. Requests repeating a key get the stored response instead. Only successful responses
+// are stored, so failed requests can be retried with the same key
+func (s *server) idempotent(ctx context.Context, req proto.Message, response proto.Message, handler func() (proto.Message, error)) error {
+	key := idempotencyKey(ctx)
+	if key == "" {
+		result, err := handler()
+		if err != nil {
+			return err
+		}
+		proto.Merge(response, result)
+		return nil
+	}
+	hash, err := requestHash(req)
+	if err != nil {
+		return err
+	}
+	record, err := s.idempotency.Reserve(ctx, key, hash, idempotencyTimeout)
+	if err != nil {
+		return repositoryError(err)
+	}
+	if record != nil {
+		if record.Hash != hash {
+			return status.Error(codes.AlreadyExists, "The idempotency key was already used by a different request")
+		}
+		if !record.Done {
+			return status.Error(codes.Aborted, "A request with the same idempotency key is in progress")
+		}
+		return proto.Unmarshal(record.Response, response)
+	}
+	result, err := handler()
+	if err != nil {
+		releaseCtx, cancel := context.WithTimeout(detachedContext{ctx}, idempotencyStoreTimeout)
+		defer cancel()
+		// a key that can't be released is freed once it times out
+		if releaseErr := s.idempotency.Release(releaseCtx, key); releaseErr != nil {
+			s.requestLogger(ctx).Error("could not release idempotency key", zap.Error(releaseErr))
+		}
+		return err
+	}
+	proto.Merge(response, result)
+	// the write is done, so the request succeeds even if its response can't be stored
+	stored, err := proto.Marshal(response)
+	if err != nil {
+		s.requestLogger(ctx).Error("could not store idempotent response", zap.Error(err))
+		return nil
+	}
+	for attempt := 1; attempt <= idempotencyCompleteAttempts; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(detachedContext{ctx}, idempotencyStoreTimeout)
+		err = s.idempotency.Complete(attemptCtx, key, stored, s.idempotencyTTL)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	s.requestLogger(ctx).Error("could not store idempotent response", zap.Int("attempts", idempotencyCompleteAttempts), zap.Error(err))
+	return nil
+}
@@ -0,0 +1,110 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	"github.com/IsaqueB/ps-klever/pkg/auth"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func withIdempotencyKey(key string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(rpc.IDEMPOTENCY_METADATA_KEY, key))
+}
+
+func TestInsertIdempotent(t *testing.T) {
+	mock_id := primitive.NewObjectID().Hex()
+	mock_ctx := withIdempotencyKey(primitive.NewObjectID().Hex())
+	mock_req := &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true}}
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res_0, err := s.Insert(mock_ctx, mock_req)
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	// the retry gets the same response and no new vote is created
+	res_1, err := s.Insert(mock_ctx, mock_req)
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	assert.Equal(t, res_0.GetId(), res_1.GetId())
+	res_list, err := s.ListVotesInVideo(context.Background(), &pb.ListVotesInVideoRequest{Id: mock_id})
+	if err != nil {
+		t.Fatalf("Error in ListVotesInVideo. %v", err)
+	}
+	assert.Len(t, res_list.Vote, 1, "Retries should not create votes")
+	// reusing the key for another request is a conflict
+	_, err = s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_id, User: primitive.NewObjectID().Hex(), Upvote: false}})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = s.DeleteOne(mock_ctx, &pb.DeleteOneRequest{Id: res_0.GetId()})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestDeleteOneIdempotent(t *testing.T) {
+	mock_id := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res_insert, err := s.Insert(context.Background(), &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true}})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	mock_ctx := withIdempotencyKey(primitive.NewObjectID().Hex())
+	mock_req := &pb.DeleteOneRequest{Id: res_insert.GetId()}
+	res_0, err := s.DeleteOne(mock_ctx, mock_req)
+	if err != nil {
+		t.Fatalf("Error inside Delete: %v", err)
+	}
+	// without the key the second delete would not find the vote
+	res_1, err := s.DeleteOne(mock_ctx, mock_req)
+	if err != nil {
+		t.Fatalf("Error inside Delete: %v", err)
+	}
+	assert.Equal(t, res_0.GetDeleted(), res_1.GetDeleted())
+}
+
+func TestFailedRequestsAreNotStored(t *testing.T) {
+	mock_ctx := withIdempotencyKey(primitive.NewObjectID().Hex())
+	mock_req := &pb.UpdateOneRequest{Id: primitive.NewObjectID().Hex(), NewValue: true}
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	_, err = s.UpdateOne(mock_ctx, mock_req)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	// the key was released, so the retry runs again instead of conflicting
+	_, err = s.UpdateOne(mock_ctx, mock_req)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestIdempotencyKeysOfCallers(t *testing.T) {
+	mock_video := primitive.NewObjectID().Hex()
+	mock_key := withIdempotencyKey(primitive.NewObjectID().Hex())
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res_0, err := s.Insert(auth.NewContext(mock_key, auth.Identity{Subject: "alice"}), &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true}})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	// another caller using the same key neither gets the response of the first one nor conflicts
+	res_1, err := s.Insert(auth.NewContext(mock_key, auth.Identity{Subject: "bob"}), &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true}})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	assert.NotEqual(t, res_0.GetId(), res_1.GetId())
+}
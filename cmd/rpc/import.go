@@ -0,0 +1,288 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Amount of votes of an import written in each bulk write
+const IMPORT_BATCH_SIZE = DEFAULT_BATCH_LIMIT
+
+// Columns an imported CSV file must have
+var importColumns = []string{"video", "user", "upvote"}
+
+// Reads the data of the messages of an import as a single file
+type importReader struct {
+	stream pb.Vote_ImportVotesServer
+	data   []byte
+}
+
+func (r *importReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.data = req.GetData()
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// Error of a line of the file, which doesn't stop the import
+type lineError struct {
+	err error
+}
+
+func (e lineError) Error() string {
+	return e.err.Error()
+}
+
+// Reads the votes of a file line by line. next returns the number of the line read and its vote,
+// a lineError if the line is invalid, and io.EOF at the end of the file
+type voteParser interface {
+	next() (int, *pb.VoteStruct, error)
+}
+
+type csvParser struct {
+	reader  *csv.Reader
+	columns []int
+}
+
+func newCSVParser(r io.Reader) (*csvParser, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("The file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	parser := &csvParser{reader: reader, columns: make([]int, len(importColumns))}
+	for i, name := range importColumns {
+		parser.columns[i] = -1
+		for j, column := range header {
+			if strings.TrimSpace(column) == name {
+				parser.columns[i] = j
+			}
+		}
+		if parser.columns[i] == -1 {
+			return nil, fmt.Errorf("The header of the file has no %s column", name)
+		}
+	}
+	return parser, nil
+}
+
+func (p *csvParser) next() (int, *pb.VoteStruct, error) {
+	record, err := p.reader.Read()
+	if err == io.EOF {
+		return 0, nil, err
+	}
+	var parseError *csv.ParseError
+	if errors.As(err, &parseError) {
+		return parseError.StartLine, nil, lineError{err}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	line, _ := p.reader.FieldPos(0)
+	fields := make([]string, len(p.columns))
+	for i, column := range p.columns {
+		if column >= len(record) {
+			return line, nil, lineError{fmt.Errorf("The line has no %s column", importColumns[i])}
+		}
+		fields[i] = strings.TrimSpace(record[column])
+	}
+	upvote, err := strconv.ParseBool(fields[2])
+	if err != nil {
+		return line, nil, lineError{fmt.Errorf("Invalid upvote %q", fields[2])}
+	}
+	return line, &pb.VoteStruct{Video: fields[0], User: fields[1], Upvote: upvote}, nil
+}
+
+type ndjsonParser struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func (p *ndjsonParser) next() (int, *pb.VoteStruct, error) {
+	for {
+		content, err := p.reader.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(content) == 0) {
+			return 0, nil, err
+		}
+		p.line++
+		content = bytes.TrimSpace(content)
+		if len(content) == 0 {
+			continue
+		}
+		vote := &pb.VoteStruct{}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(content, vote); err != nil {
+			return p.line, nil, lineError{err}
+		}
+		return p.line, vote, nil
+	}
+}
+
+// Votes of an import waiting to be written, with the number of their lines
+type importBatch struct {
+	votes []database.VoteModel
+	lines []int
+}
+
+// Receives a file of votes and imports them in bulk, one vote per user on a video: votes are
+// inserted, updated when the value differs or left unchanged, so importing the same file again
+// changes nothing. Lines which are invalid, or repeat a video and user of a previous line, fail
+// without stopping the import. Answers with the failures as they happen, then with the summary.
+// With dry_run nothing is written and the summary tells what would change
+func (s *server) ImportVotes(stream pb.Vote_ImportVotesServer) error {
+	ctx := stream.Context()
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "The file is empty")
+	}
+	if err != nil {
+		return err
+	}
+	s.requestLogger(ctx).Debug("import votes", zap.Stringer("format", first.Format), zap.Bool("dry_run", first.DryRun))
+	reader := &importReader{stream: stream, data: first.GetData()}
+	var parser voteParser
+	switch first.Format {
+	case pb.ExportFormat_EXPORT_FORMAT_CSV:
+		if parser, err = newCSVParser(reader); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	case pb.ExportFormat_EXPORT_FORMAT_NDJSON:
+		parser = &ndjsonParser{reader: bufio.NewReader(reader)}
+	default:
+		return status.Errorf(codes.InvalidArgument, "Unknown format %d", first.Format)
+	}
+	summary := &pb.ImportVotesSummary{DryRun: first.DryRun}
+	response := &pb.ImportVotesResponse{}
+	fail := func(line int, err error) {
+		summary.Failed++
+		response.Failure = append(response.Failure, itemResult(line, "", err))
+	}
+	// sends the failures so far, so the report of a file with many failures isn't held in memory
+	report := func() error {
+		if len(response.Failure) == 0 {
+			return nil
+		}
+		err := stream.Send(response)
+		response = &pb.ImportVotesResponse{}
+		return err
+	}
+	// line of the vote of each user on a video, to reject the lines repeating it. Kept for the
+	// whole file, since the repeated lines may be far apart
+	seen := map[[2]primitive.ObjectID]int{}
+	var batch importBatch
+	flush := func() error {
+		if len(batch.votes) > 0 {
+			banned, err := s.checkBans(ctx, batch.votes)
+			if err != nil {
+				return err
+			}
+			var allowed importBatch
+			for i, vote := range batch.votes {
+				if err := banned[vote.User]; err != nil {
+					fail(batch.lines[i], err)
+					continue
+				}
+				allowed.votes = append(allowed.votes, vote)
+				allowed.lines = append(allowed.lines, batch.lines[i])
+			}
+			batch = allowed
+		}
+		if len(batch.votes) > 0 {
+			actions, errs, err := s.repository.BulkImport(ctx, batch.votes, first.DryRun)
+			if err != nil {
+				return repositoryError(err)
+			}
+			for i, action := range actions {
+				if errs[i] != nil {
+					fail(batch.lines[i], errs[i])
+					continue
+				}
+				switch action {
+				case database.IMPORT_INSERTED:
+					summary.Inserted++
+				case database.IMPORT_UPDATED:
+					summary.Updated++
+				default:
+					summary.Unchanged++
+				}
+				if !first.DryRun && action != database.IMPORT_UNCHANGED {
+					countVote(voteDirection(&batch.votes[i]), "imported")
+				}
+			}
+			batch = importBatch{}
+		}
+		return report()
+	}
+	for {
+		line, vote, err := parser.next()
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(lineError); ok {
+			summary.Lines++
+			fail(line, status.Error(codes.InvalidArgument, err.Error()))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		summary.Lines++
+		model, err := newVoteModel(vote)
+		if err != nil {
+			fail(line, status.Error(codes.InvalidArgument, err.Error()))
+			continue
+		}
+		key := [2]primitive.ObjectID{model.Video, model.User}
+		if previous, ok := seen[key]; ok {
+			fail(line, status.Errorf(codes.AlreadyExists, "The user already has a vote on the video in line %d", previous))
+			continue
+		}
+		seen[key] = line
+		batch.votes = append(batch.votes, model)
+		batch.lines = append(batch.lines, line)
+		if len(batch.votes) >= IMPORT_BATCH_SIZE {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if len(response.Failure) >= IMPORT_BATCH_SIZE {
+			if err := report(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	s.requestLogger(ctx).Info("imported votes",
+		zap.Bool("dry_run", summary.DryRun),
+		zap.Int32("lines", summary.Lines),
+		zap.Int32("inserted", summary.Inserted),
+		zap.Int32("updated", summary.Updated),
+		zap.Int32("unchanged", summary.Unchanged),
+		zap.Int32("failed", summary.Failed))
+	return stream.Send(&pb.ImportVotesResponse{Summary: summary})
+}
@@ -0,0 +1,97 @@
+package rpc_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type mockVoteImportVotesServer struct {
+	grpc.ServerStream
+	Requests  []*pb.ImportVotesRequest
+	Responses []*pb.ImportVotesResponse
+}
+
+func (x *mockVoteImportVotesServer) Context() context.Context {
+	return context.Background()
+}
+
+func (x *mockVoteImportVotesServer) Recv() (*pb.ImportVotesRequest, error) {
+	if len(x.Requests) == 0 {
+		return nil, io.EOF
+	}
+	req := x.Requests[0]
+	x.Requests = x.Requests[1:]
+	return req, nil
+}
+
+func (x *mockVoteImportVotesServer) Send(m *pb.ImportVotesResponse) error {
+	x.Responses = append(x.Responses, m)
+	return nil
+}
+
+// Sends the file split in two messages, and returns the failures and the summary
+func importFile(t *testing.T, s interface {
+	ImportVotes(pb.Vote_ImportVotesServer) error
+}, format pb.ExportFormat, dryRun bool, file string) ([]*pb.BatchItemResult, *pb.ImportVotesSummary) {
+	half := len(file) / 2
+	stream := mockVoteImportVotesServer{Requests: []*pb.ImportVotesRequest{
+		{Format: format, DryRun: dryRun, Data: []byte(file[:half])},
+		{Data: []byte(file[half:])},
+	}}
+	if err := s.ImportVotes(&stream); err != nil {
+		t.Fatalf("Error in ImportVotes. %v", err)
+	}
+	var failures []*pb.BatchItemResult
+	for _, response := range stream.Responses {
+		failures = append(failures, response.Failure...)
+	}
+	return failures, stream.Responses[len(stream.Responses)-1].Summary
+}
+
+func TestImportVotes(t *testing.T) {
+	mock_video := primitive.NewObjectID().Hex()
+	mock_user_0 := primitive.NewObjectID().Hex()
+	mock_user_1 := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	file := "id,video,user,upvote\n" +
+		"," + mock_video + "," + mock_user_0 + ",true\n" +
+		"," + mock_video + ",invalid,true\n" +
+		"," + mock_video + "," + mock_user_1 + ",false\n" +
+		"," + mock_video + "," + mock_user_0 + ",false\n"
+
+	failures, summary := importFile(t, s, pb.ExportFormat_EXPORT_FORMAT_CSV, true, file)
+	assert.Equal(t, &pb.ImportVotesSummary{DryRun: true, Lines: 4, Inserted: 2, Failed: 2}, summary)
+	assert.Len(t, failures, 2)
+	assert.Equal(t, int32(3), failures[0].Index)
+	assert.Equal(t, int32(codes.InvalidArgument), failures[0].Code)
+	assert.Equal(t, int32(5), failures[1].Index, "A second vote of the user on the video should fail")
+	assert.Equal(t, int32(codes.AlreadyExists), failures[1].Code)
+	votes, err := s.ListVotesInVideo(context.Background(), &pb.ListVotesInVideoRequest{Id: mock_video})
+	assert.Nil(t, err)
+	assert.Empty(t, votes.GetVote(), "A dry run should write nothing")
+
+	_, summary = importFile(t, s, pb.ExportFormat_EXPORT_FORMAT_CSV, false, file)
+	assert.Equal(t, &pb.ImportVotesSummary{Lines: 4, Inserted: 2, Failed: 2}, summary)
+	_, summary = importFile(t, s, pb.ExportFormat_EXPORT_FORMAT_CSV, false, file)
+	assert.Equal(t, &pb.ImportVotesSummary{Lines: 4, Unchanged: 2, Failed: 2}, summary, "Importing the same file again should change nothing")
+
+	ndjson := `{"video":"` + mock_video + `","user":"` + mock_user_0 + `","upvote":false}` + "\n\nnot json\n"
+	failures, summary = importFile(t, s, pb.ExportFormat_EXPORT_FORMAT_NDJSON, false, ndjson)
+	assert.Equal(t, &pb.ImportVotesSummary{Lines: 2, Updated: 1, Failed: 1}, summary)
+	assert.Equal(t, int32(3), failures[0].Index)
+
+	stream := mockVoteImportVotesServer{Requests: []*pb.ImportVotesRequest{{Data: []byte("video,upvote\n")}}}
+	assert.Equal(t, codes.InvalidArgument, status.Code(s.ImportVotes(&stream)), "The header should have the user column")
+}
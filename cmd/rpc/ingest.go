@@ -0,0 +1,141 @@
+package rpc
+
+import (
+	"io"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DEFAULT_INGEST_FLUSH_SIZE     = DEFAULT_BATCH_LIMIT
+	DEFAULT_INGEST_FLUSH_INTERVAL = time.Second
+	// maximum amount of failures sent back in the summary of an ingestion
+	INGEST_FAILURES_SAMPLE = 100
+)
+
+// Set when the votes buffered by IngestVotes are written: once size votes are buffered or
+// interval passed since the last write, whichever comes first. A non-positive interval keeps the
+// current one
+func (s *server) SetIngestFlush(size int, interval time.Duration) {
+	s.ingestFlushSize = size
+	if interval > 0 {
+		s.ingestFlushInterval = interval
+	}
+}
+
+// Summary of an ingestion, updated on each flush
+type ingestion struct {
+	response *pb.IngestVotesResponse
+	votes    []database.VoteModel
+	indexes  []int
+}
+
+func (i *ingestion) fail(index int, err error) {
+	i.response.Failed++
+	if len(i.response.Failure) < INGEST_FAILURES_SAMPLE {
+		i.response.Failure = append(i.response.Failure, itemResult(index, "", err))
+	}
+}
+
+// Receives a stream of votes and inserts them in bulk, applying the same rules as Insert.
+// Answers with how many votes were inserted and a sample of the failures once the client closes the stream
+func (s *server) IngestVotes(stream pb.Vote_IngestVotesServer) error {
+	ctx := stream.Context()
+	s.requestLogger(ctx).Debug("ingest votes")
+	// receive in another goroutine, so the buffer can be flushed while waiting for votes
+	received := make(chan *pb.VoteStruct)
+	finished := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				finished <- err
+				return
+			}
+			select {
+			case received <- req.GetVote():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(s.ingestFlushInterval)
+	defer ticker.Stop()
+	summary := ingestion{response: &pb.IngestVotesResponse{}}
+	flush := func() error {
+		if len(summary.votes) == 0 {
+			return nil
+		}
+		banned, err := s.checkBans(ctx, summary.votes)
+		if err != nil {
+			return err
+		}
+		var votes []database.VoteModel
+		var indexes []int
+		for j, vote := range summary.votes {
+			if err := banned[vote.User]; err != nil {
+				summary.fail(summary.indexes[j], err)
+				continue
+			}
+			votes = append(votes, vote)
+			indexes = append(indexes, summary.indexes[j])
+		}
+		summary.votes, summary.indexes = nil, nil
+		if len(votes) == 0 {
+			return nil
+		}
+		written, err := s.repository.BulkInsert(ctx, votes, false)
+		if err != nil {
+			return repositoryError(err)
+		}
+		for j, err := range written {
+			if err != nil {
+				summary.fail(indexes[j], err)
+			} else {
+				summary.response.Inserted++
+				countVote(voteDirection(&votes[j]), "inserted")
+			}
+		}
+		return nil
+	}
+	for {
+		select {
+		case vote := <-received:
+			index := int(summary.response.Received)
+			summary.response.Received++
+			model, err := newVoteModel(vote)
+			if err != nil {
+				summary.fail(index, status.Error(codes.InvalidArgument, err.Error()))
+				continue
+			}
+			summary.votes = append(summary.votes, model)
+			summary.indexes = append(summary.indexes, index)
+			if len(summary.votes) >= s.ingestFlushSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case err := <-finished:
+			if err != io.EOF {
+				return err
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			s.requestLogger(ctx).Info("ingested votes",
+				zap.Int32("received", summary.response.Received),
+				zap.Int32("inserted", summary.response.Inserted),
+				zap.Int32("failed", summary.response.Failed))
+			return stream.SendAndClose(summary.response)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package rpc_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+type mockVoteIngestVotesServer struct {
+	grpc.ServerStream
+	Votes    []*pb.VoteStruct
+	Response *pb.IngestVotesResponse
+}
+
+func (x *mockVoteIngestVotesServer) Context() context.Context {
+	return context.Background()
+}
+
+func (x *mockVoteIngestVotesServer) Recv() (*pb.IngestVotesRequest, error) {
+	if len(x.Votes) == 0 {
+		return nil, io.EOF
+	}
+	vote := x.Votes[0]
+	x.Votes = x.Votes[1:]
+	return &pb.IngestVotesRequest{Vote: vote}, nil
+}
+
+func (x *mockVoteIngestVotesServer) SendAndClose(m *pb.IngestVotesResponse) error {
+	x.Response = m
+	return nil
+}
+
+func TestIngestVotes(t *testing.T) {
+	mock_video := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	// flushes in the middle of the stream and when it ends
+	s.SetIngestFlush(2, time.Minute)
+	stream := mockVoteIngestVotesServer{Votes: []*pb.VoteStruct{
+		{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true},
+		{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: false},
+		{Video: mock_video, User: "invalid", Upvote: true},
+		{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true},
+	}}
+	if err = s.IngestVotes(&stream); err != nil {
+		t.Fatalf("Error in IngestVotes. %v", err)
+	}
+	assert.Equal(t, int32(4), stream.Response.GetReceived())
+	assert.Equal(t, int32(3), stream.Response.GetInserted())
+	assert.Equal(t, int32(1), stream.Response.GetFailed())
+	assert.Equal(t, int32(2), stream.Response.GetFailure()[0].GetIndex())
+	assert.Equal(t, int32(codes.InvalidArgument), stream.Response.GetFailure()[0].GetCode())
+	res, err := s.ListVotesInVideo(context.Background(), &pb.ListVotesInVideoRequest{Id: mock_video})
+	if err != nil {
+		t.Fatalf("Error in ListVotesInVideo. %v", err)
+	}
+	assert.Len(t, res.Vote, 3)
+}
@@ -0,0 +1,26 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/IsaqueB/ps-klever/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Set the logger of the server. Nothing is logged until it is set
+func (s *server) SetLogger(logger *zap.Logger) {
+	s.logger = logger
+}
+
+// Logger whose lines carry the id of the request being handled
+func (s *server) requestLogger(ctx context.Context) *zap.Logger {
+	return logging.WithRequest(ctx, s.logger)
+}
+
+func (s *adminServer) SetLogger(logger *zap.Logger) {
+	s.logger = logger
+}
+
+func (s *adminServer) requestLogger(ctx context.Context) *zap.Logger {
+	return logging.WithRequest(ctx, s.logger)
+}
@@ -0,0 +1,354 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// Votes moderated by each write, and between the updates of the progress of a job
+	MODERATION_BATCH_SIZE = 500
+	// Moderations matching more votes run as jobs
+	DEFAULT_MODERATION_SYNC_LIMIT = 1000
+	// Audit entries listed when no limit is requested
+	DEFAULT_AUDIT_LIMIT = 100
+	// How long a job is held by the server running it without renewing it, after which another
+	// server resumes it
+	DEFAULT_MODERATION_JOB_LEASE = time.Minute
+)
+
+var moderationActions = map[pb.ModerationAction]database.ModerationAction{
+	pb.ModerationAction_MODERATION_DELETE:     database.MODERATION_DELETE,
+	pb.ModerationAction_MODERATION_INVALIDATE: database.MODERATION_INVALIDATE,
+}
+
+// Names of the actions in the audit entries
+var moderationAudits = map[database.ModerationAction]string{
+	database.MODERATION_DELETE:     "delete_votes",
+	database.MODERATION_INVALIDATE: "invalidate_votes",
+}
+
+// Set how many votes a moderation may match before it runs as a job
+func (s *adminServer) SetModerationSyncLimit(limit int64) {
+	s.moderationSyncLimit = limit
+}
+
+// Set how long a job is held by the server running it without renewing it. Non-positive leases
+// keep the current one
+func (s *adminServer) SetModerationJobLease(lease time.Duration) {
+	if lease > 0 {
+		s.moderationLease = lease
+	}
+}
+
+func (s *adminServer) GetModerationStore() database.ModerationStore {
+	return s.moderation
+}
+
+// Converts the filter of a moderation request, which must have at least one condition
+func moderationFilter(req *pb.ModerationFilter) (database.ModerationFilter, error) {
+	filter, _, err := exportFilter(&pb.ExportVotesRequest{
+		Video:       req.GetVideo(),
+		User:        req.GetUser(),
+		CreatedFrom: req.GetCreatedFrom(),
+		CreatedTo:   req.GetCreatedTo(),
+		Direction:   req.GetDirection(),
+	})
+	if err != nil {
+		return database.ModerationFilter{}, err
+	}
+	result := database.ModerationFilter{
+		Video:       filter.Video,
+		User:        filter.User,
+		Upvote:      filter.Upvote,
+		CreatedFrom: filter.CreatedFrom,
+		CreatedTo:   filter.CreatedTo,
+	}
+	if result.Empty() {
+		return result, errors.New("The filter must have at least one condition")
+	}
+	return result, nil
+}
+
+func toModerationFilter(filter database.ModerationFilter) *pb.ModerationFilter {
+	result := &pb.ModerationFilter{}
+	if filter.Video != nil {
+		result.Video = filter.Video.Hex()
+	}
+	if filter.User != nil {
+		result.User = filter.User.Hex()
+	}
+	if filter.CreatedFrom != nil {
+		result.CreatedFrom = timestamppb.New(*filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		result.CreatedTo = timestamppb.New(*filter.CreatedTo)
+	}
+	if filter.Upvote != nil {
+		result.Direction = pb.Direction_DIRECTION_DOWN
+		if *filter.Upvote {
+			result.Direction = pb.Direction_DIRECTION_UP
+		}
+	}
+	return result
+}
+
+func toModerationJob(job *database.ModerationJob) *pb.ModerationJob {
+	result := &pb.ModerationJob{
+		Id:        job.ID.Hex(),
+		Filter:    toModerationFilter(job.Filter),
+		Actor:     job.Actor,
+		Reason:    job.Reason,
+		Status:    pb.ModerationJobStatus(job.Status),
+		Matched:   job.Matched,
+		Modified:  job.Modified,
+		Error:     job.Error,
+		CreatedAt: timestamppb.New(job.CreatedAt),
+		UpdatedAt: timestamppb.New(job.UpdatedAt),
+	}
+	for action, value := range moderationActions {
+		if value == job.Action {
+			result.Action = action
+		}
+	}
+	if job.FinishedAt != nil {
+		result.FinishedAt = timestamppb.New(*job.FinishedAt)
+	}
+	return result
+}
+
+func toAuditEntry(entry *database.AuditEntry) *pb.AuditEntry {
+	result := &pb.AuditEntry{
+		Id:        entry.ID.Hex(),
+		Actor:     entry.Actor,
+		Action:    entry.Action,
+		Reason:    entry.Reason,
+		Filter:    toModerationFilter(entry.Filter),
+		DryRun:    entry.DryRun,
+		Matched:   entry.Matched,
+		Modified:  entry.Modified,
+		CreatedAt: timestamppb.New(entry.CreatedAt),
+	}
+	if entry.Job != nil {
+		result.JobId = entry.Job.Hex()
+	}
+	return result
+}
+
+// Moderates the votes matching the filter in batches, calling progress with the votes moderated
+// after each of them
+func (s *adminServer) moderate(ctx context.Context, filter database.ModerationFilter, action database.ModerationAction, progress func(modified int64)) (int64, error) {
+	var modified int64
+	ids := make([]primitive.ObjectID, 0, MODERATION_BATCH_SIZE)
+	flush := func() error {
+		changed, err := s.repository.Moderate(ctx, ids, action)
+		if err != nil {
+			return err
+		}
+		modified += changed
+		ids = ids[:0]
+		if progress != nil {
+			progress(modified)
+		}
+		return nil
+	}
+	err := s.repository.Scan(ctx, filter.VoteFilter(), primitive.NilObjectID, func(vote database.VoteModel) error {
+		ids = append(ids, vote.ID)
+		if len(ids) == MODERATION_BATCH_SIZE {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && len(ids) > 0 {
+		err = flush()
+	}
+	return modified, err
+}
+
+// Runs a moderation job held by the server until it finishes, storing its progress and renewing
+// its lease. Resumed jobs start over, which skips the votes already moderated
+func (s *adminServer) runModerationJob(ctx context.Context, job *database.ModerationJob, logger *zap.Logger) {
+	renewed := make(chan struct{})
+	defer close(renewed)
+	go func() {
+		ticker := time.NewTicker(s.moderationLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-renewed:
+				return
+			case <-ticker.C:
+				if err := s.moderation.RenewJob(ctx, job.ID, job.Owner, s.moderationLease); err != nil {
+					logger.Error("could not renew the lease of moderation job", zap.String("job", job.ID.Hex()), zap.Error(err))
+				}
+			}
+		}
+	}()
+	job.Status = database.JOB_RUNNING
+	if err := s.moderation.UpdateJob(ctx, job); err != nil {
+		logger.Error("could not update moderation job", zap.String("job", job.ID.Hex()), zap.Error(err))
+	}
+	previous := job.Modified
+	modified, err := s.moderate(ctx, job.Filter, job.Action, func(modified int64) {
+		job.Modified = previous + modified
+		if err := s.moderation.UpdateJob(ctx, job); err != nil {
+			logger.Error("could not update moderation job", zap.String("job", job.ID.Hex()), zap.Error(err))
+		}
+	})
+	now := time.Now().UTC()
+	job.Modified = previous + modified
+	job.FinishedAt = &now
+	job.Status = database.JOB_DONE
+	if err != nil {
+		job.Status = database.JOB_FAILED
+		job.Error = err.Error()
+		logger.Error("moderation job failed", zap.String("job", job.ID.Hex()), zap.Int64("modified", modified), zap.Error(err))
+	} else {
+		logger.Info("moderation job done", zap.String("job", job.ID.Hex()), zap.Int64("modified", modified))
+	}
+	if err := s.moderation.UpdateJob(ctx, job); err != nil {
+		logger.Error("could not update moderation job", zap.String("job", job.ID.Hex()), zap.Error(err))
+	}
+}
+
+// Resumes the jobs whose server stopped before finishing them, once their lease expired, checking
+// every lease until ctx is done
+func (s *adminServer) ResumeModerationJobs(ctx context.Context) {
+	resume := func() {
+		for {
+			job, err := s.moderation.ClaimJob(ctx, s.owner, s.moderationLease)
+			if err == mongo.ErrNoDocuments {
+				return
+			}
+			if err != nil {
+				s.logger.Error("could not claim moderation job", zap.Error(err))
+				return
+			}
+			s.logger.Info("resuming moderation job", zap.String("job", job.ID.Hex()), zap.String("tenant", job.Tenant), zap.Int64("modified", job.Modified))
+			// the job outlives ctx like the ones of requests, keeping only its tenant
+			go s.runModerationJob(tenant.NewContext(context.Background(), job.Tenant), job, s.logger)
+		}
+	}
+	resume()
+	ticker := time.NewTicker(s.moderationLease)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			resume()
+		}
+	}
+}
+
+// Delete or invalidate the votes matching a filter, such as every vote of an user or the votes
+// on a video within a time window. Dry runs only count them. Moderations matching many votes,
+// or requested as async, run as a job whose progress is polled with GetModerationJob. Every
+// request is recorded in the audit log
+func (s *adminServer) ModerateVotes(ctx context.Context, req *pb.ModerateVotesRequest) (*pb.ModerateVotesResponse, error) {
+	actor, err := adminActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logger := s.requestLogger(ctx)
+	logger.Debug("moderate votes", zap.Stringer("action", req.Action), zap.String("actor", actor), zap.Bool("dry_run", req.DryRun))
+	action, ok := moderationActions[req.Action]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown action %d", req.Action)
+	}
+	filter, err := moderationFilter(req.Filter)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	matched, err := s.repository.Count(ctx, filter.VoteFilter())
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	entry := database.AuditEntry{Actor: actor, Action: moderationAudits[action], Reason: req.Reason, Filter: filter, DryRun: req.DryRun, Matched: matched}
+	response := &pb.ModerateVotesResponse{Matched: matched, DryRun: req.DryRun}
+	switch {
+	case req.DryRun:
+	case req.Async || matched > s.moderationSyncLimit:
+		leaseExpiresAt := time.Now().UTC().Add(s.moderationLease)
+		job := &database.ModerationJob{Action: action, Filter: filter, Actor: actor, Reason: req.Reason, Matched: matched, Owner: s.owner, LeaseExpiresAt: &leaseExpiresAt}
+		if err := s.moderation.CreateJob(ctx, job); err != nil {
+			return nil, repositoryError(err)
+		}
+		entry.Job = &job.ID
+		response.JobId = job.ID.Hex()
+		// the job outlives the request, keeping only its tenant
+		tenantId, err := s.tenants.FromContext(ctx)
+		if err != nil {
+			return nil, repositoryError(err)
+		}
+		go s.runModerationJob(tenant.NewContext(context.Background(), tenantId), job, logger)
+	default:
+		modified, err := s.moderate(ctx, filter, action, nil)
+		entry.Modified = modified
+		if err != nil {
+			// the votes already moderated are still audited
+			if auditErr := s.moderation.Audit(ctx, entry); auditErr != nil {
+				logger.Error("could not audit moderation", zap.Any("entry", entry), zap.Error(auditErr))
+			}
+			return nil, repositoryError(err)
+		}
+		response.Modified = modified
+	}
+	if err := s.moderation.Audit(ctx, entry); err != nil {
+		// the action was taken, so it is still answered and logged in place of the entry
+		logger.Error("could not audit moderation", zap.Any("entry", entry), zap.Error(err))
+	}
+	logger.Info("votes moderated", zap.String("action", entry.Action), zap.String("actor", actor),
+		zap.Bool("dry_run", req.DryRun), zap.Int64("matched", matched), zap.Int64("modified", response.Modified), zap.String("job", response.JobId))
+	return response, nil
+}
+
+// Get the status and progress of a moderation job of the tenant
+func (s *adminServer) GetModerationJob(ctx context.Context, req *pb.GetModerationJobRequest) (*pb.GetModerationJobResponse, error) {
+	s.requestLogger(ctx).Debug("get moderation job", zap.String("id", req.Id))
+	jobId, err := primitive.ObjectIDFromHex(req.Id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	job, err := s.moderation.FindJob(ctx, jobId)
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Errorf(codes.NotFound, "Could not find a moderation job with the id requested")
+	}
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	return &pb.GetModerationJobResponse{Job: toModerationJob(job)}, nil
+}
+
+// List the audit entries of the tenant, newest first
+func (s *adminServer) ListAuditEntries(ctx context.Context, req *pb.ListAuditEntriesRequest) (*pb.ListAuditEntriesResponse, error) {
+	s.requestLogger(ctx).Debug("list audit entries", zap.String("actor", req.Actor), zap.String("action", req.Action))
+	if req.Limit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid limit %d", req.Limit)
+	}
+	limit := int64(req.Limit)
+	if limit == 0 {
+		limit = DEFAULT_AUDIT_LIMIT
+	}
+	entries, err := s.moderation.ListAudit(ctx, database.AuditFilter{Actor: req.Actor, Action: req.Action, Limit: limit})
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	response := &pb.ListAuditEntriesResponse{}
+	for i := range entries {
+		response.Entry = append(response.Entry, toAuditEntry(&entries[i]))
+	}
+	return response, nil
+}
@@ -0,0 +1,190 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/cmd/rpc"
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestModerateVotes(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_user := primitive.NewObjectID().Hex()
+	mock_video := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	admin := initAnAdminServer(s)
+	for _, video := range []string{mock_video, primitive.NewObjectID().Hex()} {
+		if _, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: video, User: mock_user, Upvote: true}}); err != nil {
+			t.Fatalf("Error inside Insert: %v", err)
+		}
+	}
+	if _, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true}}); err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	req := &pb.ModerateVotesRequest{
+		Action: pb.ModerationAction_MODERATION_INVALIDATE,
+		Filter: &pb.ModerationFilter{User: mock_user},
+		Reason: "campaign",
+		DryRun: true,
+	}
+	mock_admin_ctx := adminContext("moderator-" + mock_user)
+	res_dry, err := admin.ModerateVotes(mock_admin_ctx, req)
+	if err != nil {
+		t.Fatalf("Error inside ModerateVotes: %v", err)
+	}
+	assert.Equal(t, int64(2), res_dry.GetMatched())
+	assert.Equal(t, int64(0), res_dry.GetModified(), "Dry runs should not change votes")
+	req.DryRun = false
+	res_moderate, err := admin.ModerateVotes(mock_admin_ctx, req)
+	if err != nil {
+		t.Fatalf("Error inside ModerateVotes: %v", err)
+	}
+	assert.Equal(t, int64(2), res_moderate.GetModified())
+	assert.Empty(t, res_moderate.GetJobId(), "Few votes should be moderated right away")
+	// invalidated votes are still read, but not counted
+	res_votes, err := admin.ListVotes(mock_ctx, &pb.ListVotesRequest{User: mock_user})
+	if err != nil {
+		t.Fatalf("Error inside ListVotes: %v", err)
+	}
+	assert.Len(t, res_votes.Vote, 2)
+	assert.NotNil(t, res_votes.Vote[0].GetInvalidatedAt())
+	res_tallies, err := s.BatchGetVideoTallies(mock_ctx, &pb.BatchGetVideoTalliesRequest{Video: []string{mock_video}})
+	if err != nil {
+		t.Fatalf("Error inside BatchGetVideoTallies: %v", err)
+	}
+	assert.Equal(t, int64(1), res_tallies.GetTallies()[mock_video].GetUpvotes(), "Invalidated votes should not be counted")
+	// votes already invalidated are not changed again
+	res_again, err := admin.ModerateVotes(mock_admin_ctx, req)
+	if err != nil {
+		t.Fatalf("Error inside ModerateVotes: %v", err)
+	}
+	assert.Equal(t, int64(0), res_again.GetModified())
+
+	res_audit, err := admin.ListAuditEntries(mock_ctx, &pb.ListAuditEntriesRequest{Actor: "moderator-" + mock_user})
+	if err != nil {
+		t.Fatalf("Error inside ListAuditEntries: %v", err)
+	}
+	assert.Len(t, res_audit.Entry, 3, "Every moderation should be audited")
+	assert.Equal(t, "invalidate_votes", res_audit.Entry[2].GetAction())
+	assert.True(t, res_audit.Entry[2].GetDryRun())
+	assert.Equal(t, mock_user, res_audit.Entry[2].GetFilter().GetUser())
+	assert.Equal(t, int64(2), res_audit.Entry[1].GetModified())
+}
+
+func TestModerateVotesJob(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	admin := initAnAdminServer(s)
+	admin.SetModerationSyncLimit(1)
+	from := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: i%2 == 0}}); err != nil {
+			t.Fatalf("Error inside Insert: %v", err)
+		}
+	}
+	res_moderate, err := admin.ModerateVotes(adminContext("moderator"), &pb.ModerateVotesRequest{
+		Action: pb.ModerationAction_MODERATION_DELETE,
+		Filter: &pb.ModerationFilter{Video: mock_video, CreatedFrom: timestamppb.New(from.Add(-time.Second)), CreatedTo: timestamppb.New(time.Now().Add(time.Second))},
+	})
+	if err != nil {
+		t.Fatalf("Error inside ModerateVotes: %v", err)
+	}
+	assert.Equal(t, int64(3), res_moderate.GetMatched())
+	if res_moderate.GetJobId() == "" {
+		t.Fatalf("Moderations over the limit should run as jobs")
+	}
+	var job *pb.ModerationJob
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		res_job, err := admin.GetModerationJob(mock_ctx, &pb.GetModerationJobRequest{Id: res_moderate.GetJobId()})
+		if err != nil {
+			t.Fatalf("Error inside GetModerationJob: %v", err)
+		}
+		job = res_job.GetJob()
+		if job.GetStatus() == pb.ModerationJobStatus_MODERATION_JOB_DONE || job.GetStatus() == pb.ModerationJobStatus_MODERATION_JOB_FAILED {
+			break
+		}
+	}
+	assert.Equal(t, pb.ModerationJobStatus_MODERATION_JOB_DONE, job.GetStatus())
+	assert.Equal(t, int64(3), job.GetModified())
+	assert.NotNil(t, job.GetFinishedAt())
+	res_video, err := s.ListVotesInVideo(mock_ctx, &pb.ListVotesInVideoRequest{Id: mock_video})
+	if err != nil {
+		t.Fatalf("Error inside ListVotesInVideo: %v", err)
+	}
+	assert.Empty(t, res_video.Vote, "The votes should be deleted")
+	_, err = admin.GetModerationJob(mock_ctx, &pb.GetModerationJobRequest{Id: primitive.NewObjectID().Hex()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestResumeModerationJobs(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	admin := initAnAdminServer(s)
+	for i := 0; i < 3; i++ {
+		if _, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true}}); err != nil {
+			t.Fatalf("Error inside Insert: %v", err)
+		}
+	}
+	// left running by a server which stopped, without lease
+	videoId, _ := primitive.ObjectIDFromHex(mock_video)
+	job := &database.ModerationJob{Action: database.MODERATION_DELETE, Filter: database.ModerationFilter{Video: &videoId}, Actor: "moderator", Matched: 3, Status: database.JOB_RUNNING}
+	if err := admin.GetModerationStore().CreateJob(mock_ctx, job); err != nil {
+		t.Fatalf("Error creating job: %v", err)
+	}
+	ctx, cancel := context.WithCancel(mock_ctx)
+	defer cancel()
+	go admin.ResumeModerationJobs(ctx)
+	var resumed *pb.ModerationJob
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		res_job, err := admin.GetModerationJob(mock_ctx, &pb.GetModerationJobRequest{Id: job.ID.Hex()})
+		if err != nil {
+			t.Fatalf("Error inside GetModerationJob: %v", err)
+		}
+		resumed = res_job.GetJob()
+		if resumed.GetStatus() == pb.ModerationJobStatus_MODERATION_JOB_DONE {
+			break
+		}
+	}
+	assert.Equal(t, pb.ModerationJobStatus_MODERATION_JOB_DONE, resumed.GetStatus(), "Jobs left running should be resumed")
+	assert.Equal(t, int64(3), resumed.GetModified())
+}
+
+func TestModerateVotesInvalid(t *testing.T) {
+	mock_ctx := adminContext("moderator")
+	client := database.NewMongoClient()
+	admin := rpc.NewAdminServer(&client)
+	for _, req := range []*pb.ModerateVotesRequest{
+		{},
+		{Filter: &pb.ModerationFilter{Video: "invalid"}},
+		{Action: 9, Filter: &pb.ModerationFilter{User: primitive.NewObjectID().Hex()}},
+		{Filter: &pb.ModerationFilter{Video: primitive.NewObjectID().Hex(), CreatedFrom: timestamppb.Now(), CreatedTo: timestamppb.New(time.Now().Add(-time.Hour))}},
+	} {
+		_, err := admin.ModerateVotes(mock_ctx, req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	// the actor is the admin calling
+	_, err := admin.ModerateVotes(context.Background(), &pb.ModerateVotesRequest{Filter: &pb.ModerationFilter{User: primitive.NewObjectID().Hex()}})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
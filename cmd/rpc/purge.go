@@ -0,0 +1,58 @@
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"go.uber.org/zap"
+)
+
+const (
+	DEFAULT_RETENTION      = 30 * 24 * time.Hour
+	DEFAULT_PURGE_INTERVAL = time.Hour
+)
+
+// Every interval, physically removes the votes which were deleted longer than retention ago.
+// Runs until the context is cancelled
+func RunPurgeJob(ctx context.Context, repository database.VoteRepository, retention time.Duration, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purgeDeleted(ctx, repository, time.Now().UTC().Add(-retention), logger)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Returns a context for the default tenant and for every other tenant found. If the tenants
+// can't be listed, the error is returned with the context of the default tenant
+func tenantContexts(ctx context.Context, repository database.VoteRepository) ([]context.Context, error) {
+	contexts := []context.Context{ctx}
+	tenants, err := repository.Tenants(ctx)
+	for _, tenantId := range tenants {
+		contexts = append(contexts, tenant.NewContext(ctx, tenantId))
+	}
+	return contexts, err
+}
+
+// Purges the default tenant and then every other tenant found
+func purgeDeleted(ctx context.Context, repository database.VoteRepository, before time.Time, logger *zap.Logger) {
+	contexts, err := tenantContexts(ctx, repository)
+	if err != nil {
+		logger.Error("could not list tenants to purge", zap.Error(err))
+	}
+	for _, tenantCtx := range contexts {
+		tenantId, _ := tenant.Config{}.FromContext(tenantCtx)
+		purged, err := repository.PurgeDeleted(tenantCtx, before)
+		if err != nil {
+			logger.Error("could not purge deleted votes", zap.String("tenant", tenantId), zap.Error(err))
+		} else if purged > 0 {
+			logger.Info("purged deleted votes", zap.String("tenant", tenantId), zap.Int64("purged", purged))
+		}
+	}
+}
@@ -2,13 +2,18 @@ package rpc
 
 import (
 	"context"
-	"log"
+	"time"
 
 	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
 	pb "github.com/IsaqueB/ps-klever/proto"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const (
@@ -23,6 +28,11 @@ var (
 	}
 )
 
+// Name of the database of the index given, MAIN_DB or TEST_DB
+func DatabaseName(index int) string {
+	return db_string[index]
+}
+
 type Server interface {
 	Insert(ctx context.Context, message *pb.InsertRequest) (*pb.InsertResponse, error)
 	Get(ctx context.Context, message *pb.GetRequest) (*pb.GetResponse, error)
@@ -30,20 +40,67 @@ type Server interface {
 	DeleteOne(ctx context.Context, message *pb.DeleteOneRequest) (*pb.DeleteOneResponse, error)
 	ListVotesInVideo(ctx context.Context, req *pb.ListVotesInVideoRequest) (*pb.ListVotesInVideoResponse, error)
 	ListVotesOfUser(ctx context.Context, req *pb.ListVotesOfUserRequest) (*pb.ListVotesOfUserResponse, error)
+	BatchInsert(ctx context.Context, req *pb.BatchInsertRequest) (*pb.BatchInsertResponse, error)
+	BatchUpdate(ctx context.Context, req *pb.BatchUpdateRequest) (*pb.BatchUpdateResponse, error)
+	BatchDelete(ctx context.Context, req *pb.BatchDeleteRequest) (*pb.BatchDeleteResponse, error)
+	IngestVotes(stream pb.Vote_IngestVotesServer) error
+	ExportVotes(req *pb.ExportVotesRequest, stream pb.Vote_ExportVotesServer) error
+	ImportVotes(stream pb.Vote_ImportVotesServer) error
+	CastVote(ctx context.Context, req *pb.CastVoteRequest) (*pb.CastVoteResponse, error)
+	GetUserVoteOnVideo(ctx context.Context, req *pb.GetUserVoteOnVideoRequest) (*pb.GetUserVoteOnVideoResponse, error)
+	GetUserVotesOnVideos(ctx context.Context, req *pb.GetUserVotesOnVideosRequest) (*pb.GetUserVotesOnVideosResponse, error)
+	BatchGetVideoTallies(ctx context.Context, req *pb.BatchGetVideoTalliesRequest) (*pb.BatchGetVideoTalliesResponse, error)
 	GetClient() *database.MongoClient
+	GetRepository() database.VoteRepository
+	GetIdempotencyStore() database.IdempotencyStore
 	SetDatabase(index int)
+	SetTenantConfig(config tenant.Config)
+	SetTenantProvisioner(provision database.TenantProvisioner)
+	SetBatchLimit(limit int)
+	SetIngestFlush(size int, interval time.Duration)
+	SetIdempotencyTTL(ttl time.Duration)
+	SetCache(voteCache *database.VoteCache)
+	SetBanCache(banCache *database.BanCache)
+	SetWriteBehind(writeBehind *database.WriteBehind)
+	SetLogger(logger *zap.Logger)
 	pb.UnsafeVoteServer
 }
 
 type server struct {
 	client   *database.MongoClient
 	database string
+	tenants  tenant.Config
+	// prepares the tenants before their first write when set
+	provision  database.TenantProvisioner
+	repository database.VoteRepository
+	// votes and tallies read through it when set
+	cache *database.VoteCache
+	// users who can't vote, read through banCache when set
+	bans     database.BanStore
+	banCache *database.BanCache
+	// inserts and casts are buffered in it when set
+	writeBehind *database.WriteBehind
+	// responses of requests sent with an idempotency key
+	idempotency    database.IdempotencyStore
+	idempotencyTTL time.Duration
+	batchLimit     int
+	// votes buffered by IngestVotes are written when either is reached
+	ingestFlushSize     int
+	ingestFlushInterval time.Duration
+	logger              *zap.Logger
 	pb.UnimplementedVoteServer
 }
 
 // Create a new struct and sets it's client to the one in the function params
 func NewGrpcServer(client *database.MongoClient) Server {
-	grpcServer := server{}
+	grpcServer := server{
+		tenants:             tenant.Config{Strategy: tenant.PREFIX_STRATEGY},
+		idempotencyTTL:      DEFAULT_IDEMPOTENCY_TTL,
+		batchLimit:          DEFAULT_BATCH_LIMIT,
+		ingestFlushSize:     DEFAULT_INGEST_FLUSH_SIZE,
+		ingestFlushInterval: DEFAULT_INGEST_FLUSH_INTERVAL,
+		logger:              zap.NewNop(),
+	}
 	grpcServer.setClient(client)
 	grpcServer.SetDatabase(MAIN_DB)
 	return &grpcServer
@@ -59,178 +116,274 @@ func (s *server) GetClient() *database.MongoClient {
 	return s.client
 }
 
+func (s *server) GetRepository() database.VoteRepository {
+	return s.repository
+}
+
 func (s *server) SetDatabase(index int) {
 	s.database = db_string[index]
+	s.setStores()
 }
 
-// Create a new Vote from an USER to a VIDEO testar com o struct do pbbuf
-func (s *server) Insert(ctx context.Context, req *pb.InsertRequest) (*pb.InsertResponse, error) {
-	log.Println("INSERT VOTE - Recieved")
-	// selecting collection
-	voteCollection := (*s.client).GetClient().Database(s.database).Collection("vote")
+// Set how votes of each tenant are stored and their quotas
+func (s *server) SetTenantConfig(config tenant.Config) {
+	s.tenants = config
+	s.setStores()
+}
+
+// Set what prepares the votes of each tenant before its first write, such as migrating them
+func (s *server) SetTenantProvisioner(provision database.TenantProvisioner) {
+	s.provision = provision
+	s.setStores()
+}
+
+// Recreate what accesses the database once its name or the tenants change
+func (s *server) setStores() {
+	s.repository = newRepository(s.client, s.database, s.tenants, s.cache, s.provision)
+	s.idempotency = database.NewIdempotencyStore(s.client, s.database, s.tenants)
+	s.bans = newBanStore(s.client, s.database, s.tenants, s.banCache)
+}
+
+func (s *server) GetIdempotencyStore() database.IdempotencyStore {
+	return s.idempotency
+}
+
+// Converts errors of the repository which the client can act upon to gRPC status
+func repositoryError(err error) error {
+	switch err {
+	case database.ErrQuotaExceeded:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case tenant.ErrInvalidTenant:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case database.ErrVersionMismatch:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	return err
+}
+
+// Converts the document stored in the database to the struct sent to clients
+func toVoteStruct(vote *database.VoteModel) *pb.VoteStruct {
+	voteStruct := &pb.VoteStruct{
+		Id:      vote.ID.Hex(),
+		Video:   vote.Video.Hex(),
+		User:    vote.User.Hex(),
+		Upvote:  vote.Upvote,
+		Version: vote.Version,
+	}
+	if vote.DeletedAt != nil {
+		voteStruct.DeletedAt = timestamppb.New(*vote.DeletedAt)
+	}
+	if vote.InvalidatedAt != nil {
+		voteStruct.InvalidatedAt = timestamppb.New(*vote.InvalidatedAt)
+	}
+	if vote.CreatedAt != nil {
+		voteStruct.CreatedAt = timestamppb.New(*vote.CreatedAt)
+	}
+	if vote.UpdatedAt != nil {
+		voteStruct.UpdatedAt = timestamppb.New(*vote.UpdatedAt)
+	}
+	return voteStruct
+}
+
+func toVoteStructs(votes []database.VoteModel) []*pb.VoteStruct {
+	var voteStructs []*pb.VoteStruct
+	for i := range votes {
+		voteStructs = append(voteStructs, toVoteStruct(&votes[i]))
+	}
+	return voteStructs
+}
+
+// Validates a vote sent by a client and creates the document to be inserted
+func newVoteModel(vote *pb.VoteStruct) (database.VoteModel, error) {
 	// converting strings from request to objectId
-	videoId, err := primitive.ObjectIDFromHex(req.Vote.Video)
+	videoId, err := primitive.ObjectIDFromHex(vote.GetVideo())
 	if err != nil {
-		return nil, err
+		return database.VoteModel{}, err
 	}
-	userId, err := primitive.ObjectIDFromHex(req.Vote.User)
+	userId, err := primitive.ObjectIDFromHex(vote.GetUser())
 	if err != nil {
-		return nil, err
+		return database.VoteModel{}, err
 	}
-	// creating new document
-	insertResult, err := voteCollection.InsertOne(ctx, database.VoteModel{
+	return database.VoteModel{
 		ID:     primitive.NewObjectID(),
 		Video:  videoId,
 		User:   userId,
-		Upvote: req.Vote.Upvote,
-	})
+		Upvote: vote.GetUpvote(),
+	}, nil
+}
+
+// Create a new Vote from an USER to a VIDEO testar com o struct do pbbuf
+// Requests with an idempotency key are only executed once
+func (s *server) Insert(ctx context.Context, req *pb.InsertRequest) (*pb.InsertResponse, error) {
+	s.requestLogger(ctx).Debug("insert vote")
+	response := &pb.InsertResponse{}
+	if err := s.idempotent(ctx, req, response, func() (proto.Message, error) { return s.insert(ctx, req) }); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (s *server) insert(ctx context.Context, req *pb.InsertRequest) (*pb.InsertResponse, error) {
+	vote, err := newVoteModel(req.Vote)
 	if err != nil {
 		return nil, err
 	}
-	return &pb.InsertResponse{Id: insertResult.InsertedID.(primitive.ObjectID).Hex()}, nil
+	if err := s.checkBan(ctx, vote.User); err != nil {
+		return nil, err
+	}
+	if s.writeBehind != nil {
+		if err := s.writeBehind.Insert(ctx, vote); err != nil {
+			return nil, repositoryError(err)
+		}
+		countVote(voteDirection(&vote), "pending")
+		return &pb.InsertResponse{Id: vote.ID.Hex(), Pending: true}, nil
+	}
+	// creating new document
+	insertedId, err := s.repository.Insert(ctx, vote)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	countVote(voteDirection(&vote), "inserted")
+	return &pb.InsertResponse{Id: insertedId.Hex()}, nil
 }
 
 // Returns a Vote from an USER to a VIDEO
 func (s *server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
-	log.Printf("GET UPVOTE - Recieved - ID TO BE QUERIED: %s", req.Id)
-	// select collection
-	voteCollection := (*s.client).GetClient().Database(s.database).Collection("vote")
+	s.requestLogger(ctx).Debug("get vote", zap.String("id", req.Id))
 	// convert string from request to objectId
 	voteId, err := primitive.ObjectIDFromHex(req.Id)
 	if err != nil {
 		return nil, err
 	}
-	// query for the document
-	var voteFound bson.M
-	if err = voteCollection.FindOne(ctx, bson.M{"_id": voteId}).Decode(&voteFound); err != nil {
-		return nil, err
+	// query for the document, deleted votes are not found
+	voteFound, err := s.repository.FindByID(ctx, voteId)
+	if err != nil {
+		return nil, repositoryError(err)
 	}
 	// send message
-	return &pb.GetResponse{Vote: &pb.VoteStruct{
-		Id:     voteFound["_id"].(primitive.ObjectID).Hex(),
-		Video:  voteFound["video"].(primitive.ObjectID).Hex(),
-		User:   voteFound["user"].(primitive.ObjectID).Hex(),
-		Upvote: voteFound["upvote"].(bool),
-	}}, nil
+	return &pb.GetResponse{Vote: toVoteStruct(voteFound)}, nil
 }
 
 // Modify vote's UPVOTE value which indicates if it is an UPVOTE or a DOWNVOTE
+// Requests with an idempotency key are only executed once
 func (s *server) UpdateOne(ctx context.Context, req *pb.UpdateOneRequest) (*pb.UpdateOneResponse, error) {
-	log.Printf("UPDATE UPVOTE - Recieved - ID: %s - CHANGE VALUE TO: %v", req.Id, req.NewValue)
-	// select collection
-	voteCollection := (*s.client).GetClient().Database(s.database).Collection("vote")
+	s.requestLogger(ctx).Debug("update vote", zap.String("id", req.Id), zap.Bool("upvote", req.NewValue))
+	response := &pb.UpdateOneResponse{}
+	if err := s.idempotent(ctx, req, response, func() (proto.Message, error) { return s.updateOne(ctx, req) }); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (s *server) updateOne(ctx context.Context, req *pb.UpdateOneRequest) (*pb.UpdateOneResponse, error) {
 	// convert string from request to objectId
 	voteId, err := primitive.ObjectIDFromHex(req.Id)
 	if err != nil {
 		return nil, err
 	}
-	// update document using the id and new upvote value got from request
-	updateResult, err := voteCollection.UpdateByID(ctx, voteId, bson.M{"$set": bson.M{"upvote": req.NewValue}})
+	version, err := expectedVersion(ctx, req.ExpectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	// only the owner of the vote is checked for bans, so it is found first
+	current, err := s.repository.FindByID(ctx, voteId)
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Errorf(5, "Could not find the vote requested")
+	}
 	if err != nil {
+		return nil, repositoryError(err)
+	}
+	if err := s.checkBan(ctx, current.User); err != nil {
 		return nil, err
 	}
+	// update document using the id and new upvote value got from request
+	vote, modified, err := s.repository.UpdateUpvote(ctx, voteId, req.NewValue, version)
 	// check to inform with the ID given does not correspond to a document in the database
-	if updateResult.MatchedCount == 0 {
+	if err == mongo.ErrNoDocuments {
 		return nil, status.Errorf(5, "Could not find the vote requested")
 	}
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	response := &pb.UpdateOneResponse{
+		Matched: 1,
+		Version: vote.Version,
+	}
+	if modified {
+		response.Modified = 1
+	}
 	// send message
-	return &pb.UpdateOneResponse{
-		Matched:  int32(updateResult.MatchedCount),
-		Modified: int32(updateResult.ModifiedCount),
-	}, nil
+	return response, nil
 }
 
-// Remove an USER's vote to a VIDEO
+// Remove an USER's vote to a VIDEO. The vote is only marked as deleted, it can be restored until it is purged
+// Requests with an idempotency key are only executed once
 func (s *server) DeleteOne(ctx context.Context, req *pb.DeleteOneRequest) (*pb.DeleteOneResponse, error) {
-	log.Printf("DELETE UPVOTE - Recieved message from client: %s", req.Id)
-	// select collection
-	voteCollection := (*s.client).GetClient().Database(s.database).Collection("vote")
+	s.requestLogger(ctx).Debug("delete vote", zap.String("id", req.Id))
+	response := &pb.DeleteOneResponse{}
+	if err := s.idempotent(ctx, req, response, func() (proto.Message, error) { return s.deleteOne(ctx, req) }); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (s *server) deleteOne(ctx context.Context, req *pb.DeleteOneRequest) (*pb.DeleteOneResponse, error) {
 	// convert string from request to objectId
 	voteId, err := primitive.ObjectIDFromHex(req.Id)
 	if err != nil {
 		return nil, err
 	}
-	deleteResult, err := voteCollection.DeleteOne(ctx, bson.M{"_id": voteId})
+	version, err := expectedVersion(ctx, req.ExpectedVersion)
 	if err != nil {
 		return nil, err
 	}
-	if deleteResult.DeletedCount == 0 {
+	deleted, err := s.repository.SoftDelete(ctx, voteId, version)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	if deleted == 0 {
 		return nil, status.Errorf(5, "Could not find the vote requested")
 	}
 	return &pb.DeleteOneResponse{
-		Deleted: int32(deleteResult.DeletedCount),
+		Deleted: int32(deleted),
 	}, nil
 }
 
 // Queries all votes to a VIDEO and the UPVOTE count. Negative results to VoteCount means a video is more downvoted than upvoted
 func (s *server) ListVotesInVideo(ctx context.Context, req *pb.ListVotesInVideoRequest) (*pb.ListVotesInVideoResponse, error) {
-	log.Printf("GET VOTES OF VIDEO - Recieved - VIDEO TO BE QUERIED: %s", req.Id)
-	// selecting collection
-	voteCollection := (*s.client).GetClient().Database(s.database).Collection("vote")
+	s.requestLogger(ctx).Debug("list votes of video", zap.String("video", req.Id))
 	// converting string from request to objectId
 	videoId, err := primitive.ObjectIDFromHex(req.Id)
 	if err != nil {
 		return nil, err
 	}
 	// querying for votes of requested video
-	cursor, err := voteCollection.Find(ctx, bson.M{"video": videoId})
+	votes, err := s.repository.Find(ctx, database.VoteFilter{Video: &videoId})
 	if err != nil {
-		return nil, err
-	}
-	// iterate cursor
-	var votes []*pb.VoteStruct
-	for cursor.Next(ctx) {
-		var current bson.M
-		// decode and parse info
-		if err = cursor.Decode(&current); err != nil {
-			return nil, err
-		}
-		vote := &pb.VoteStruct{
-			Id:     current["_id"].(primitive.ObjectID).Hex(),
-			Video:  current["video"].(primitive.ObjectID).Hex(),
-			User:   current["user"].(primitive.ObjectID).Hex(),
-			Upvote: current["upvote"].(bool),
-		}
-		// send document
-		votes = append(votes, vote)
+		return nil, repositoryError(err)
 	}
 	return &pb.ListVotesInVideoResponse{
-		Vote: votes,
+		Vote: toVoteStructs(votes),
 	}, nil
 }
 
 //List all votes an USER made
 func (s *server) ListVotesOfUser(ctx context.Context, req *pb.ListVotesOfUserRequest) (*pb.ListVotesOfUserResponse, error) {
-	// selecting collection
-	voteCollection := (*s.client).GetClient().Database(s.database).Collection("vote")
+	s.requestLogger(ctx).Debug("list votes of user", zap.String("user", req.Id))
 	// converting string from request to objectId
 	userId, err := primitive.ObjectIDFromHex(req.Id)
 	if err != nil {
 		return nil, err
 	}
-	// querying for votes of requested video
-	cursor, err := voteCollection.Find(ctx, bson.M{"user": userId})
+	// querying for votes of requested user
+	votes, err := s.repository.Find(ctx, database.VoteFilter{User: &userId})
 	if err != nil {
-		return nil, err
-	}
-	// iterate cursor
-	var votes []*pb.VoteStruct
-	for cursor.Next(ctx) {
-		var current bson.M
-		// decode and parse info
-		if err = cursor.Decode(&current); err != nil {
-			return nil, err
-		}
-		vote := &pb.VoteStruct{
-			Id:     current["_id"].(primitive.ObjectID).Hex(),
-			Video:  current["video"].(primitive.ObjectID).Hex(),
-			User:   current["user"].(primitive.ObjectID).Hex(),
-			Upvote: current["upvote"].(bool),
-		}
-		// append document to slice
-		votes = append(votes, vote)
+		return nil, repositoryError(err)
 	}
 	return &pb.ListVotesOfUserResponse{
-		Vote: votes,
+		Vote: toVoteStructs(votes),
 	}, nil
 }
@@ -6,11 +6,23 @@ import (
 
 	"github.com/IsaqueB/ps-klever/cmd/rpc"
 	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/migrations"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
 	pb "github.com/IsaqueB/ps-klever/proto"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+func compareVotes(t *testing.T, a *pb.VoteStruct, b *pb.VoteStruct) {
+	assert.Equal(t, a.GetId(), b.GetId())
+	assert.Equal(t, a.GetVideo(), b.GetVideo())
+	assert.Equal(t, a.GetUser(), b.GetUser())
+	assert.Equal(t, a.GetUpvote(), b.GetUpvote())
+}
+
 func TestNewGrpcServer(t *testing.T) {
 	client := database.NewMongoClient()
 	s := rpc.NewGrpcServer(&client)
@@ -24,6 +36,12 @@ func initAServer() (rpc.Server, error) {
 	}
 	s := rpc.NewGrpcServer(&client)
 	s.SetDatabase(rpc.TEST_DB)
+	// the tests run against the indexes of the server, such as the one vote of an user on a video
+	migrator := migrations.NewMigrator(&client, rpc.DatabaseName(rpc.TEST_DB), tenant.Config{Strategy: tenant.PREFIX_STRATEGY}, migrations.Votes)
+	if err := migrator.Up(context.Background()); err != nil {
+		return nil, err
+	}
+	s.SetTenantProvisioner(migrator.UpTenant)
 	return s, nil
 }
 
@@ -156,12 +174,12 @@ func TestListVotesInVideo(t *testing.T) {
 	}
 	mock_Vote_2 := pb.VoteStruct{
 		Video:  mock_id_1,
-		User:   mock_id_2,
+		User:   mock_id_0,
 		Upvote: true,
 	}
 	mock_Vote_3 := pb.VoteStruct{
 		Video:  mock_id_0,
-		User:   mock_id_2,
+		User:   mock_id_1,
 		Upvote: true,
 	}
 	// Setup server
@@ -194,7 +212,13 @@ func TestListVotesInVideo(t *testing.T) {
 	if err != nil {
 		t.Errorf("Error in ListVotesInVideo. %v", err)
 	}
-	assert.Equal(t, []*pb.VoteStruct{&mock_Vote_0, &mock_Vote_3}, res.Vote)
+	// the votes stored also have their version and timestamps
+	if assert.Len(t, res.Vote, 2) {
+		for i, expected := range []*pb.VoteStruct{&mock_Vote_0, &mock_Vote_3} {
+			compareVotes(t, expected, res.Vote[i])
+			assert.Equal(t, int64(1), res.Vote[i].GetVersion(), "Votes just inserted should be at version 1")
+		}
+	}
 }
 
 func ListVotesOfUser(t *testing.T) {
@@ -255,6 +279,56 @@ func ListVotesOfUser(t *testing.T) {
 	assert.Equal(t, []*pb.VoteStruct{&mock_Vote_0, &mock_Vote_3}, res.Vote)
 }
 
+func TestTenantIsolation(t *testing.T) {
+	mock_id := primitive.NewObjectID().Hex()
+	// as set by the authentication from the tenant of the token
+	ctx_a := tenant.NewContext(context.Background(), "tenant-a")
+	ctx_b := tenant.NewContext(context.Background(), "tenant-b")
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res_insert, err := s.Insert(ctx_a, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true}})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	// other tenants can't reach the vote, even knowing its id
+	if _, err = s.Get(ctx_b, &pb.GetRequest{Id: res_insert.Id}); err == nil {
+		t.Errorf("Vote of another tenant should not be found")
+	}
+	if _, err = s.DeleteOne(ctx_b, &pb.DeleteOneRequest{Id: res_insert.Id}); err == nil {
+		t.Errorf("Vote of another tenant should not be deleted")
+	}
+	res_list, err := s.ListVotesInVideo(ctx_b, &pb.ListVotesInVideoRequest{Id: mock_id})
+	if err != nil {
+		t.Fatalf("Error in ListVotesInVideo. %v", err)
+	}
+	assert.Len(t, res_list.Vote, 0, "Votes of other tenants should not be listed")
+	res_get, err := s.Get(ctx_a, &pb.GetRequest{Id: res_insert.Id})
+	if err != nil {
+		t.Fatalf("Error inside Get: %v", err)
+	}
+	assert.Equal(t, res_insert.Id, res_get.GetVote().GetId())
+}
+
+func TestTenantQuota(t *testing.T) {
+	mock_id := primitive.NewObjectID().Hex()
+	mock_tenant := "quota-" + mock_id
+	ctx := tenant.NewContext(context.Background(), mock_tenant)
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	s.SetTenantConfig(tenant.Config{Strategy: tenant.PREFIX_STRATEGY, Quotas: map[string]int64{mock_tenant: 1}})
+	if _, err = s.Insert(ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true}}); err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	_, err = s.Insert(ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_id, User: primitive.NewObjectID().Hex(), Upvote: false}})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "Insert past the quota should fail")
+}
+
 // These were used when protobuf was returning a stream. but since the http handler can't handle them yet
 // I've changed them to returning an array
 // START OF TestListVotesInVideo STRAEM TEST
@@ -415,3 +489,74 @@ func ListVotesOfUser(t *testing.T) {
 // 	assert.Equal(t, mock_Vote_2.Upvote, streamMock.Results[1].GetUpvote(), "Upvote's value should be equal")
 // }
 // END OF TestListVotesOfUser's STREAM TEST
+
+func TestUpdateOneVersion(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_id := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res_insert, err := s.Insert(mock_ctx, &pb.InsertRequest{
+		Vote: &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true},
+	})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	res_get, err := s.Get(mock_ctx, &pb.GetRequest{Id: res_insert.Id})
+	if err != nil {
+		t.Fatalf("Error inside Get: %v", err)
+	}
+	assert.Equal(t, int64(1), res_get.Vote.GetVersion(), "A new vote should have version 1")
+	res_update, err := s.UpdateOne(mock_ctx, &pb.UpdateOneRequest{Id: res_insert.Id, NewValue: false, ExpectedVersion: 1})
+	if err != nil {
+		t.Fatalf("Error inside Update: %v", err)
+	}
+	assert.Equal(t, int64(2), res_update.GetVersion(), "Updating should increment the version")
+	// writing the same value doesn't change the vote
+	res_update, err = s.UpdateOne(mock_ctx, &pb.UpdateOneRequest{Id: res_insert.Id, NewValue: false})
+	if err != nil {
+		t.Fatalf("Error inside Update: %v", err)
+	}
+	assert.Equal(t, int32(0), res_update.GetModified())
+	assert.Equal(t, int64(2), res_update.GetVersion(), "Writing the same value should keep the version")
+	_, err = s.UpdateOne(mock_ctx, &pb.UpdateOneRequest{Id: res_insert.Id, NewValue: true, ExpectedVersion: 1})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "A stale version should be refused")
+	// If-Match works as expected_version
+	stale_ctx := metadata.NewIncomingContext(mock_ctx, metadata.Pairs(rpc.IF_MATCH_METADATA_KEY, rpc.ETag(1)))
+	_, err = s.UpdateOne(stale_ctx, &pb.UpdateOneRequest{Id: res_insert.Id, NewValue: true})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "A stale If-Match should be refused")
+	current_ctx := metadata.NewIncomingContext(mock_ctx, metadata.Pairs(rpc.IF_MATCH_METADATA_KEY, rpc.ETag(2)))
+	res_update, err = s.UpdateOne(current_ctx, &pb.UpdateOneRequest{Id: res_insert.Id, NewValue: true})
+	if err != nil {
+		t.Fatalf("Error inside Update: %v", err)
+	}
+	assert.Equal(t, int64(3), res_update.GetVersion())
+	invalid_ctx := metadata.NewIncomingContext(mock_ctx, metadata.Pairs(rpc.IF_MATCH_METADATA_KEY, "not-a-version"))
+	_, err = s.UpdateOne(invalid_ctx, &pb.UpdateOneRequest{Id: res_insert.Id, NewValue: true})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestDeleteOneVersion(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_id := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res_insert, err := s.Insert(mock_ctx, &pb.InsertRequest{
+		Vote: &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true},
+	})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	_, err = s.DeleteOne(mock_ctx, &pb.DeleteOneRequest{Id: res_insert.Id, ExpectedVersion: 2})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "A wrong version should be refused")
+	res_delete, err := s.DeleteOne(mock_ctx, &pb.DeleteOneRequest{Id: res_insert.Id, ExpectedVersion: 1})
+	if err != nil {
+		t.Fatalf("Error inside Delete: %v", err)
+	}
+	assert.Equal(t, int32(1), res_delete.GetDeleted())
+}
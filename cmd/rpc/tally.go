@@ -0,0 +1,44 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func toVideoTally(tally database.Tally) *pb.VideoTally {
+	return &pb.VideoTally{
+		Video:     tally.Video.Hex(),
+		Upvotes:   tally.Upvotes,
+		Downvotes: tally.Downvotes,
+	}
+}
+
+// Count the upvotes and downvotes of many VIDEOS in a single query. Accepts as many videos as the batch RPCs
+func (s *server) BatchGetVideoTallies(ctx context.Context, req *pb.BatchGetVideoTalliesRequest) (*pb.BatchGetVideoTalliesResponse, error) {
+	s.requestLogger(ctx).Debug("get tallies of videos", zap.Int("videos", len(req.Video)))
+	if err := s.checkBatchSize(len(req.Video)); err != nil {
+		return nil, err
+	}
+	videoIds := make([]primitive.ObjectID, len(req.Video))
+	for i, video := range req.Video {
+		var err error
+		if videoIds[i], err = primitive.ObjectIDFromHex(video); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid video %q: %v", video, err)
+		}
+	}
+	tallies, err := s.repository.Tallies(ctx, videoIds)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	response := &pb.BatchGetVideoTalliesResponse{Tallies: make(map[string]*pb.VideoTally, len(tallies))}
+	for i, video := range req.Video {
+		response.Tallies[video] = toVideoTally(tallies[videoIds[i]])
+	}
+	return response, nil
+}
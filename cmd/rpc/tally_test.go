@@ -0,0 +1,59 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBatchGetVideoTallies(t *testing.T) {
+	mock_ctx := context.Background()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	voted_video := primitive.NewObjectID().Hex()
+	missing_video := primitive.NewObjectID().Hex()
+	for _, upvote := range []bool{true, true, false} {
+		_, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: voted_video, User: primitive.NewObjectID().Hex(), Upvote: upvote}})
+		if err != nil {
+			t.Fatalf("Error inside Insert: %v", err)
+		}
+	}
+	// deleted votes are not counted
+	res_insert, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: voted_video, User: primitive.NewObjectID().Hex(), Upvote: true}})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	if _, err := s.DeleteOne(mock_ctx, &pb.DeleteOneRequest{Id: res_insert.Id}); err != nil {
+		t.Fatalf("Error inside DeleteOne: %v", err)
+	}
+	res, err := s.BatchGetVideoTallies(mock_ctx, &pb.BatchGetVideoTalliesRequest{Video: []string{voted_video, missing_video}})
+	if err != nil {
+		t.Fatalf("Error inside BatchGetVideoTallies: %v", err)
+	}
+	assert.Len(t, res.Tallies, 2)
+	assert.Equal(t, int64(2), res.Tallies[voted_video].Upvotes)
+	assert.Equal(t, int64(1), res.Tallies[voted_video].Downvotes)
+	assert.Equal(t, missing_video, res.Tallies[missing_video].Video, "Videos without votes should be returned")
+	assert.Equal(t, int64(0), res.Tallies[missing_video].Upvotes)
+	assert.Equal(t, int64(0), res.Tallies[missing_video].Downvotes)
+}
+
+func TestBatchGetVideoTalliesInvalid(t *testing.T) {
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	_, err = s.BatchGetVideoTallies(context.Background(), &pb.BatchGetVideoTalliesRequest{Video: []string{"invalid"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = s.BatchGetVideoTallies(context.Background(), &pb.BatchGetVideoTalliesRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "An empty list should be refused")
+}
@@ -0,0 +1,74 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Vote of an USER on a VIDEO, with DIRECTION_NONE and no vote if the USER hasn't voted
+func toUserVote(video string, vote *database.VoteModel) *pb.UserVote {
+	userVote := &pb.UserVote{Video: video, Direction: voteDirection(vote)}
+	if vote != nil {
+		userVote.Vote = toVoteStruct(vote)
+	}
+	return userVote
+}
+
+// Get how an USER voted on a VIDEO, if it did
+func (s *server) GetUserVoteOnVideo(ctx context.Context, req *pb.GetUserVoteOnVideoRequest) (*pb.GetUserVoteOnVideoResponse, error) {
+	s.requestLogger(ctx).Debug("get vote of user on video", zap.String("video", req.Video), zap.String("user", req.User))
+	videoId, err := primitive.ObjectIDFromHex(req.Video)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	userId, err := primitive.ObjectIDFromHex(req.User)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	votes, err := s.repository.Find(ctx, database.VoteFilter{Video: &videoId, User: &userId})
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	var vote *database.VoteModel
+	if len(votes) > 0 {
+		vote = &votes[0]
+	}
+	return &pb.GetUserVoteOnVideoResponse{Vote: toUserVote(req.Video, vote)}, nil
+}
+
+// Get how an USER voted on each of many VIDEOS in a single query. Accepts as many videos as the batch RPCs
+func (s *server) GetUserVotesOnVideos(ctx context.Context, req *pb.GetUserVotesOnVideosRequest) (*pb.GetUserVotesOnVideosResponse, error) {
+	s.requestLogger(ctx).Debug("get votes of user on videos", zap.String("user", req.User), zap.Int("videos", len(req.Video)))
+	if err := s.checkBatchSize(len(req.Video)); err != nil {
+		return nil, err
+	}
+	userId, err := primitive.ObjectIDFromHex(req.User)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	videoIds := make([]primitive.ObjectID, len(req.Video))
+	for i, video := range req.Video {
+		if videoIds[i], err = primitive.ObjectIDFromHex(video); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid video %q: %v", video, err)
+		}
+	}
+	votes, err := s.repository.Find(ctx, database.VoteFilter{Videos: videoIds, User: &userId})
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	byVideo := make(map[primitive.ObjectID]*database.VoteModel, len(votes))
+	for i := range votes {
+		byVideo[votes[i].Video] = &votes[i]
+	}
+	response := &pb.GetUserVotesOnVideosResponse{}
+	for i, video := range req.Video {
+		response.Vote = append(response.Vote, toUserVote(video, byVideo[videoIds[i]]))
+	}
+	return response, nil
+}
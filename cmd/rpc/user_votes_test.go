@@ -0,0 +1,80 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetUserVoteOnVideo(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	mock_user := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	res, err := s.GetUserVoteOnVideo(mock_ctx, &pb.GetUserVoteOnVideoRequest{Video: mock_video, User: mock_user})
+	if err != nil {
+		t.Fatalf("Error inside GetUserVoteOnVideo: %v", err)
+	}
+	assert.Equal(t, pb.Direction_DIRECTION_NONE, res.Vote.Direction)
+	assert.Nil(t, res.Vote.Vote, "There should be no vote before voting")
+	res_insert, err := s.Insert(mock_ctx, &pb.InsertRequest{Vote: &pb.VoteStruct{Video: mock_video, User: mock_user, Upvote: false}})
+	if err != nil {
+		t.Fatalf("Error inside Insert: %v", err)
+	}
+	res, err = s.GetUserVoteOnVideo(mock_ctx, &pb.GetUserVoteOnVideoRequest{Video: mock_video, User: mock_user})
+	if err != nil {
+		t.Fatalf("Error inside GetUserVoteOnVideo: %v", err)
+	}
+	assert.Equal(t, pb.Direction_DIRECTION_DOWN, res.Vote.Direction)
+	assert.Equal(t, res_insert.Id, res.Vote.Vote.Id)
+}
+
+func TestGetUserVotesOnVideos(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_user := primitive.NewObjectID().Hex()
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	videos := make([]string, 50)
+	for i := range videos {
+		videos[i] = primitive.NewObjectID().Hex()
+	}
+	directions := map[int]pb.Direction{3: pb.Direction_DIRECTION_UP, 10: pb.Direction_DIRECTION_DOWN, 49: pb.Direction_DIRECTION_UP}
+	for i, direction := range directions {
+		if _, err := s.CastVote(mock_ctx, &pb.CastVoteRequest{Video: videos[i], User: mock_user, Direction: direction}); err != nil {
+			t.Fatalf("Error inside CastVote: %v", err)
+		}
+	}
+	res, err := s.GetUserVotesOnVideos(mock_ctx, &pb.GetUserVotesOnVideosRequest{User: mock_user, Video: videos})
+	if err != nil {
+		t.Fatalf("Error inside GetUserVotesOnVideos: %v", err)
+	}
+	assert.Len(t, res.Vote, len(videos))
+	for i, vote := range res.Vote {
+		assert.Equal(t, videos[i], vote.Video, "The votes should be in the order of the videos")
+		assert.Equal(t, directions[i], vote.Direction)
+	}
+}
+
+func TestGetUserVotesOnVideosLimit(t *testing.T) {
+	s, err := initAServer()
+	if err != nil {
+		t.Fatalf("Error setting up server. %v", err)
+	}
+	defer (*s.GetClient()).Disconnect()
+	s.SetBatchLimit(2)
+	videos := []string{primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()}
+	_, err = s.GetUserVotesOnVideos(context.Background(), &pb.GetUserVotesOnVideosRequest{User: primitive.NewObjectID().Hex(), Video: videos})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,41 @@
+package rpc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata key of the version expected by a write. The HTTP gateway forwards the If-Match header to it
+const IF_MATCH_METADATA_KEY = "if-match"
+
+// Formats the version of a vote as the ETag sent by the HTTP gateway
+func ETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// Returns the version a write expects: the one in the request, or else the one sent as If-Match.
+// Zero means the write doesn't depend on the version
+func expectedVersion(ctx context.Context, requested int64) (int64, error) {
+	if requested != 0 {
+		return requested, nil
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, nil
+	}
+	values := md.Get(IF_MATCH_METADATA_KEY)
+	if len(values) == 0 || values[0] == "*" {
+		return 0, nil
+	}
+	tag := strings.TrimPrefix(strings.TrimSpace(values[0]), "W/")
+	version, err := strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "Invalid If-Match %q, expected the ETag of the vote", values[0])
+	}
+	return version, nil
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Set the write-behind buffer Insert and CastVote acknowledge writes after appending to. Every
+// server must share the same one, which is flushed by WriteBehind.Run
+func (s *server) SetWriteBehind(writeBehind *database.WriteBehind) {
+	s.writeBehind = writeBehind
+}
+
+// Buffers the cast, answering with the direction requested and the tally before it is applied
+func (s *server) castVoteBehind(ctx context.Context, videoId primitive.ObjectID, userId primitive.ObjectID, direction database.Direction, requested pb.Direction) (*pb.CastVoteResponse, error) {
+	if err := s.writeBehind.CastVote(ctx, videoId, userId, direction); err != nil {
+		return nil, repositoryError(err)
+	}
+	countVote(requested, "pending")
+	tally, err := s.repository.Tally(ctx, videoId)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CastVoteResponse{
+		Direction: requested,
+		Tally:     toVideoTally(tally),
+		Pending:   true,
+	}, nil
+}
+
+func (s *adminServer) SetWriteBehind(writeBehind *database.WriteBehind) {
+	s.writeBehind = writeBehind
+}
+
+// Get how many writes are buffered, how long they have been waiting and how the last flush went
+func (s *adminServer) GetWriteBehindStats(ctx context.Context, req *pb.GetWriteBehindStatsRequest) (*pb.GetWriteBehindStatsResponse, error) {
+	if s.writeBehind == nil {
+		return nil, status.Error(codes.FailedPrecondition, "Write-behind is disabled")
+	}
+	stats := s.writeBehind.Stats()
+	response := &pb.GetWriteBehindStatsResponse{
+		Pending:       stats.Pending,
+		Lag:           durationpb.New(stats.Lag),
+		Applied:       stats.Applied,
+		Failed:        stats.Failed,
+		LastFlushTime: durationpb.New(stats.LastFlushTime),
+		LastFlushLag:  durationpb.New(stats.LastFlushLag),
+	}
+	if !stats.LastFlush.IsZero() {
+		response.LastFlush = timestamppb.New(stats.LastFlush)
+	}
+	return response, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/IsaqueB/ps-klever/pkg/grpc_client"
+	pb "github.com/IsaqueB/ps-klever/proto"
+)
+
+var ErrUsage = errors.New("invalid arguments")
+
+// Subcommand of votectl. Run parses the arguments after the name of the command
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, client grpc_client.Client, args []string) (result, error)
+	// streams votes for as long as it takes, so it has no deadline unless --timeout is set
+	streaming bool
+}
+
+var commands = []command{
+	{name: "insert", args: "--video <id> --user <id> [--upvote=false] [--idempotency-key <key>]", summary: "create a vote", run: insertCommand},
+	{name: "get", args: "<id>", summary: "get a vote", run: getCommand},
+	{name: "update", args: "<id> --upvote=<true|false>", summary: "change the value of a vote", run: updateCommand},
+	{name: "delete", args: "<id>", summary: "delete a vote", run: deleteCommand},
+	{name: "list-by-video", args: "<video>", summary: "list the votes of a video", run: listByVideoCommand},
+	{name: "list-by-user", args: "<user>", summary: "list the votes of an user", run: listByUserCommand},
+	{name: "export", args: "--out <file> [--video <id>] [--user <id>] [--from <time>] [--to <time>] [--direction <up|down>] [--format <csv|ndjson>] [--resume]", summary: "export votes to a file", run: exportCommand, streaming: true},
+	{name: "import", args: "<file> [--format <csv|ndjson>] [--dry-run] [--report <file>]", summary: "import votes from a file", run: importCommand, streaming: true},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// Parses the flags of a command, which may come before or after its positional arguments, and
+// checks exactly positional of them were given
+func parseCommand(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+	fs.SetOutput(ioutil.Discard)
+	var values []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUsage, err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		values = append(values, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(values) != positional {
+		return nil, ErrUsage
+	}
+	return values, nil
+}
+
+func insertCommand(ctx context.Context, client grpc_client.Client, args []string) (result, error) {
+	fs := flag.NewFlagSet("insert", flag.ContinueOnError)
+	video := fs.String("video", "", "")
+	user := fs.String("user", "", "")
+	upvote := fs.Bool("upvote", true, "")
+	key := fs.String("idempotency-key", "", "")
+	if _, err := parseCommand(fs, args, 0); err != nil {
+		return result{}, err
+	}
+	if *video == "" || *user == "" {
+		return result{}, ErrUsage
+	}
+	if *key != "" {
+		ctx = grpc_client.WithIdempotencyKey(ctx, *key)
+	}
+	id, err := client.Insert(ctx, &pb.VoteStruct{Video: *video, User: *user, Upvote: *upvote})
+	if err != nil {
+		return result{}, err
+	}
+	return fieldsResult([]string{"id"}, id), nil
+}
+
+func getCommand(ctx context.Context, client grpc_client.Client, args []string) (result, error) {
+	values, err := parseCommand(flag.NewFlagSet("get", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return result{}, err
+	}
+	vote, err := client.Get(ctx, values[0])
+	if err != nil {
+		return result{}, err
+	}
+	r := votesResult([]*pb.VoteStruct{vote})
+	r.value = vote
+	return r, nil
+}
+
+func updateCommand(ctx context.Context, client grpc_client.Client, args []string) (result, error) {
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	upvote := fs.Bool("upvote", false, "")
+	values, err := parseCommand(fs, args, 1)
+	if err != nil {
+		return result{}, err
+	}
+	upvoteSet := false
+	fs.Visit(func(f *flag.Flag) {
+		upvoteSet = upvoteSet || f.Name == "upvote"
+	})
+	if !upvoteSet {
+		return result{}, ErrUsage
+	}
+	matched, modified, err := client.UpdateOne(ctx, values[0], *upvote)
+	if err != nil {
+		return result{}, err
+	}
+	return fieldsResult([]string{"matched", "modified"}, matched, modified), nil
+}
+
+func deleteCommand(ctx context.Context, client grpc_client.Client, args []string) (result, error) {
+	values, err := parseCommand(flag.NewFlagSet("delete", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return result{}, err
+	}
+	deleted, err := client.DeleteOne(ctx, values[0])
+	if err != nil {
+		return result{}, err
+	}
+	return fieldsResult([]string{"deleted"}, deleted), nil
+}
+
+func listByVideoCommand(ctx context.Context, client grpc_client.Client, args []string) (result, error) {
+	values, err := parseCommand(flag.NewFlagSet("list-by-video", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return result{}, err
+	}
+	votes, err := client.ListVotesInVideo(ctx, values[0])
+	if err != nil {
+		return result{}, err
+	}
+	return votesResult(votes), nil
+}
+
+func listByUserCommand(ctx context.Context, client grpc_client.Client, args []string) (result, error) {
+	values, err := parseCommand(flag.NewFlagSet("list-by-user", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return result{}, err
+	}
+	votes, err := client.ListVotesOfUser(ctx, values[0])
+	if err != nil {
+		return result{}, err
+	}
+	return votesResult(votes), nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	DEFAULT_ADDRESS = "localhost:9001"
+	DEFAULT_TIMEOUT = 10 * time.Second
+)
+
+var ErrUnknownProfile = errors.New("profile is not in the config file")
+
+// Connection settings of a server. Flags override the values of the profile
+type Profile struct {
+	Address string `json:"address,omitempty"`
+	TLS     bool   `json:"tls,omitempty"`
+	// PEM certificates of the authorities to verify the server with, instead of the system ones
+	CAFile             string `json:"ca_file,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	// sent as a bearer token in the authorization metadata
+	Token   string `json:"token,omitempty"`
+	Tenant  string `json:"tenant,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Config file, a JSON object with the profiles by name and the one used when --profile isn't given
+type Config struct {
+	CurrentProfile string             `json:"current_profile,omitempty"`
+	Profiles       map[string]Profile `json:"profiles"`
+}
+
+// Path of the config file: VOTECTL_CONFIG, or else votectl/config.json in the user config directory
+func defaultConfigPath() string {
+	if path := os.Getenv("VOTECTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "votectl", "config.json")
+}
+
+// Reads the config file. A missing file is an empty config
+func loadConfig(path string) (Config, error) {
+	config := Config{Profiles: map[string]Profile{}}
+	if path == "" {
+		return config, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err = json.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Profile named, or the current profile when name is empty. Without profiles, the defaults are used
+func (c Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = c.CurrentProfile
+	}
+	if name == "" {
+		return Profile{}, nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	return profile, nil
+}
+
+// Global flags, which override the profile when set
+type globalFlags struct {
+	config  string
+	profile string
+	flags   Profile
+}
+
+func newGlobalFlags(fs *flag.FlagSet) *globalFlags {
+	g := &globalFlags{}
+	fs.StringVar(&g.config, "config", defaultConfigPath(), "config file with the profiles")
+	fs.StringVar(&g.profile, "profile", "", "profile of the config file to use, instead of the current one")
+	fs.StringVar(&g.flags.Address, "address", "", "address of the gRPC server (default "+DEFAULT_ADDRESS+")")
+	fs.BoolVar(&g.flags.TLS, "tls", false, "connect with TLS")
+	fs.StringVar(&g.flags.CAFile, "ca-file", "", "PEM file with the authorities to verify the server with")
+	fs.StringVar(&g.flags.ServerName, "server-name", "", "name to verify the certificate of the server with")
+	fs.BoolVar(&g.flags.InsecureSkipVerify, "insecure-skip-verify", false, "don't verify the certificate of the server")
+	fs.StringVar(&g.flags.Token, "token", "", "bearer token sent in the authorization metadata (default $VOTECTL_TOKEN)")
+	fs.StringVar(&g.flags.Tenant, "tenant", "", "tenant sent in the x-tenant-id metadata")
+	fs.StringVar(&g.flags.Output, "output", "", "output format: table, json or csv (default table)")
+	fs.StringVar(&g.flags.Timeout, "timeout", "", "deadline of each request, 0 for none (default 10s, none for export and import)")
+	return g
+}
+
+// Profile with the flags set on the command line applied over the one of the config file
+func (g *globalFlags) resolve(fs *flag.FlagSet) (Profile, error) {
+	config, err := loadConfig(g.config)
+	if err != nil {
+		return Profile{}, err
+	}
+	profile, err := config.Profile(g.profile)
+	if err != nil {
+		return Profile{}, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "address":
+			profile.Address = g.flags.Address
+		case "tls":
+			profile.TLS = g.flags.TLS
+		case "ca-file":
+			profile.CAFile = g.flags.CAFile
+		case "server-name":
+			profile.ServerName = g.flags.ServerName
+		case "insecure-skip-verify":
+			profile.InsecureSkipVerify = g.flags.InsecureSkipVerify
+		case "token":
+			profile.Token = g.flags.Token
+		case "tenant":
+			profile.Tenant = g.flags.Tenant
+		case "output":
+			profile.Output = g.flags.Output
+		case "timeout":
+			profile.Timeout = g.flags.Timeout
+		}
+	})
+	if profile.Address == "" {
+		profile.Address = DEFAULT_ADDRESS
+	}
+	if profile.Token == "" {
+		profile.Token = os.Getenv("VOTECTL_TOKEN")
+	}
+	if profile.Output == "" {
+		profile.Output = TABLE_OUTPUT
+	}
+	return profile, nil
+}
+
+func (p Profile) timeout() (time.Duration, error) {
+	if p.Timeout == "" {
+		return DEFAULT_TIMEOUT, nil
+	}
+	timeout, err := time.ParseDuration(p.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q", p.Timeout)
+	}
+	return timeout, nil
+}
+
+// Credentials verifying the server, nil when the profile doesn't use TLS
+func (p Profile) credentials() (credentials.TransportCredentials, error) {
+	if !p.TLS {
+		return nil, nil
+	}
+	config := &tls.Config{ServerName: p.ServerName, InsecureSkipVerify: p.InsecureSkipVerify}
+	if p.CAFile != "" {
+		pem, err := ioutil.ReadFile(p.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", p.CAFile)
+		}
+	}
+	return credentials.NewTLS(config), nil
+}
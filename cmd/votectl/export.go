@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/grpc_client"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The cursor of an export being written to a file is kept next to it, until the export completes
+const CURSOR_SUFFIX = ".cursor"
+
+// Parses the filters of the export command into the request
+func exportRequest(video string, user string, from string, to string, direction string, format string) (*pb.ExportVotesRequest, error) {
+	req := &pb.ExportVotesRequest{Video: video, User: user}
+	for _, bound := range []struct {
+		value  string
+		target **timestamppb.Timestamp
+	}{{from, &req.CreatedFrom}, {to, &req.CreatedTo}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: times must be formatted as RFC 3339, such as 2021-12-01T00:00:00Z", ErrUsage)
+		}
+		*bound.target = timestamppb.New(t)
+	}
+	switch direction {
+	case "":
+	case "up":
+		req.Direction = pb.Direction_DIRECTION_UP
+	case "down":
+		req.Direction = pb.Direction_DIRECTION_DOWN
+	default:
+		return nil, fmt.Errorf("%w: direction must be up or down", ErrUsage)
+	}
+	value, ok := pb.ExportFormat_value["EXPORT_FORMAT_"+strings.ToUpper(format)]
+	if !ok {
+		return nil, fmt.Errorf("%w: format must be csv or ndjson", ErrUsage)
+	}
+	req.Format = pb.ExportFormat(value)
+	return req, nil
+}
+
+// Replaces the cursor file in a single rename, so a crash never leaves it half written
+func saveCursor(path string, cursor string) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(cursor), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Writes an export to a file. Each chunk is synced before its cursor is saved, so an export which
+// broke is resumed with --resume from the last chunk written, appending to the file
+func exportCommand(ctx context.Context, client grpc_client.Client, args []string) (result, error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	video := fs.String("video", "", "")
+	user := fs.String("user", "", "")
+	from := fs.String("from", "", "")
+	to := fs.String("to", "", "")
+	direction := fs.String("direction", "", "")
+	format := fs.String("format", "csv", "")
+	out := fs.String("out", "", "")
+	resume := fs.Bool("resume", false, "")
+	if _, err := parseCommand(fs, args, 0); err != nil {
+		return result{}, err
+	}
+	if *out == "" {
+		return result{}, ErrUsage
+	}
+	req, err := exportRequest(*video, *user, *from, *to, *direction, *format)
+	if err != nil {
+		return result{}, err
+	}
+	cursorPath := *out + CURSOR_SUFFIX
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if *resume {
+		cursor, err := ioutil.ReadFile(cursorPath)
+		if err != nil {
+			return result{}, fmt.Errorf("there is no export to resume: %v", err)
+		}
+		req.Cursor = string(cursor)
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(*out, flags, 0644)
+	if err != nil {
+		return result{}, err
+	}
+	defer file.Close()
+	var votes int64
+	err = client.ExportVotes(ctx, req, func(chunk *pb.ExportVotesResponse) error {
+		if _, err := file.Write(chunk.GetData()); err != nil {
+			return err
+		}
+		if err := file.Sync(); err != nil {
+			return err
+		}
+		votes += int64(chunk.GetVotes())
+		return saveCursor(cursorPath, chunk.GetCursor())
+	})
+	if err != nil {
+		return result{}, fmt.Errorf("%v, run the same command with --resume to continue the export", err)
+	}
+	if err := os.Remove(cursorPath); err != nil && !os.IsNotExist(err) {
+		return result{}, err
+	}
+	return fieldsResult([]string{"file", "votes"}, *out, votes), nil
+}
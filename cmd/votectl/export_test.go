@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	fake, address := startFakeServer(t)
+	out := filepath.Join(t.TempDir(), "votes.csv")
+	fake.breakExport = true
+	code, _, stderr := runVotectl("--address", address, "export", "--out", out)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "--resume")
+	content, _ := ioutil.ReadFile(out)
+	assert.Equal(t, "line 1\n", string(content))
+	cursor, _ := ioutil.ReadFile(out + CURSOR_SUFFIX)
+	assert.Equal(t, "1", string(cursor), "The cursor of the last chunk written should be saved")
+
+	code, stdout, stderr := runVotectl("--address", address, "--output", "csv", "export", "--out", out, "--resume")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "file,votes\n"+out+",2\n", stdout)
+	content, _ = ioutil.ReadFile(out)
+	assert.Equal(t, "line 1\nline 2\nline 3\n", string(content), "The export should continue after the cursor")
+	_, err := os.Stat(out + CURSOR_SUFFIX)
+	assert.True(t, os.IsNotExist(err), "The cursor should be removed once the export completes")
+
+	code, _, _ = runVotectl("--address", address, "export", "--out", out)
+	assert.Equal(t, 0, code)
+	content, _ = ioutil.ReadFile(out)
+	assert.Equal(t, "line 1\nline 2\nline 3\n", string(content), "A new export should replace the file")
+}
+
+func TestExportUsage(t *testing.T) {
+	code, _, _ := runVotectl("export")
+	assert.Equal(t, 2, code, "The file should be required")
+	code, _, _ = runVotectl("export", "--out", "votes.xml", "--format", "xml")
+	assert.Equal(t, 2, code)
+	code, _, _ = runVotectl("export", "--out", "votes.csv", "--from", "yesterday")
+	assert.Equal(t, 2, code)
+	code, _, stderr := runVotectl("export", "--out", filepath.Join(t.TempDir(), "votes.csv"), "--resume")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "there is no export to resume")
+}
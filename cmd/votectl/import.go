@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/IsaqueB/ps-klever/pkg/grpc_client"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"google.golang.org/grpc/codes"
+)
+
+// The report of the lines which failed is written next to the file imported, unless --report is given
+const REPORT_SUFFIX = ".errors.csv"
+
+var reportHeader = []string{"line", "code", "message"}
+
+// Format of the file by its extension, unless given
+func importFormat(file string, format string) (pb.ExportFormat, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		default:
+			format = "csv"
+		}
+	}
+	value, ok := pb.ExportFormat_value["EXPORT_FORMAT_"+strings.ToUpper(format)]
+	if !ok {
+		return 0, fmt.Errorf("%w: format must be csv or ndjson", ErrUsage)
+	}
+	return pb.ExportFormat(value), nil
+}
+
+// Imports a file of votes, writing each line which failed to the report
+func importCommand(ctx context.Context, client grpc_client.Client, args []string) (result, error) {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "")
+	dryRun := fs.Bool("dry-run", false, "")
+	reportPath := fs.String("report", "", "")
+	positional, err := parseCommand(fs, args, 1)
+	if err != nil {
+		return result{}, err
+	}
+	file := positional[0]
+	exportFormat, err := importFormat(file, *format)
+	if err != nil {
+		return result{}, err
+	}
+	if *reportPath == "" {
+		*reportPath = file + REPORT_SUFFIX
+	}
+	data, err := os.Open(file)
+	if err != nil {
+		return result{}, err
+	}
+	defer data.Close()
+	report, err := os.Create(*reportPath)
+	if err != nil {
+		return result{}, err
+	}
+	defer report.Close()
+	writer := csv.NewWriter(report)
+	writer.Write(reportHeader)
+	summary, err := client.ImportVotes(ctx, exportFormat, *dryRun, data, func(failure *pb.BatchItemResult) error {
+		return writer.Write([]string{
+			strconv.Itoa(int(failure.GetIndex())),
+			codes.Code(failure.GetCode()).String(),
+			failure.GetMessage(),
+		})
+	})
+	writer.Flush()
+	if err != nil {
+		return result{}, err
+	}
+	if err := writer.Error(); err != nil {
+		return result{}, err
+	}
+	return fieldsResult([]string{"file", "dry_run", "lines", "inserted", "updated", "unchanged", "failed", "report"},
+		file, summary.GetDryRun(), summary.GetLines(), summary.GetInserted(), summary.GetUpdated(),
+		summary.GetUnchanged(), summary.GetFailed(), *reportPath), nil
+}
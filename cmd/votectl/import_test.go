@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImport(t *testing.T) {
+	_, address := startFakeServer(t)
+	file := filepath.Join(t.TempDir(), "votes.csv")
+	content := "video,user,upvote\nvideo-1,user-1,true\nvideo-1,invalid,true\nvideo-2,user-1,false\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing file. %v", err)
+	}
+	code, stdout, stderr := runVotectl("--address", address, "--output", "csv", "import", file, "--dry-run")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "file,dry_run,lines,inserted,updated,unchanged,failed,report\n"+
+		file+",true,3,2,0,0,1,"+file+REPORT_SUFFIX+"\n", stdout)
+	report, _ := ioutil.ReadFile(file + REPORT_SUFFIX)
+	assert.Equal(t, "line,code,message\n3,InvalidArgument,invalid vote\n", string(report))
+
+	reportPath := filepath.Join(t.TempDir(), "report.csv")
+	code, _, stderr = runVotectl("--address", address, "import", "--report", reportPath, file)
+	assert.Equal(t, 0, code, stderr)
+	report, _ = ioutil.ReadFile(reportPath)
+	assert.Equal(t, "line,code,message\n3,InvalidArgument,invalid vote\n", string(report))
+}
+
+func TestImportUsage(t *testing.T) {
+	code, _, _ := runVotectl("import")
+	assert.Equal(t, 2, code, "The file should be required")
+	code, _, _ = runVotectl("import", "votes.xml", "--format", "xml")
+	assert.Equal(t, 2, code)
+	code, _, stderr := runVotectl("import", filepath.Join(t.TempDir(), "missing.csv"))
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "no such file")
+}
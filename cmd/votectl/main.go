@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/IsaqueB/ps-klever/pkg/grpc_client"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata key of the bearer token
+const AUTHORIZATION_METADATA_KEY = "authorization"
+
+// Command-line client of the Vote service, for support tasks and scripts
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Runs the command of the arguments and returns the exit code: 1 if the request failed and 2 if
+// the arguments are invalid
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("votectl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	global := newGlobalFlags(fs)
+	fs.Usage = func() {
+		printUsage(fs, stderr)
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		printUsage(fs, stderr)
+		return 2
+	}
+	c, ok := findCommand(fs.Arg(0))
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown command %q\n", fs.Arg(0))
+		printUsage(fs, stderr)
+		return 2
+	}
+	profile, err := global.resolve(fs)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return 2
+	}
+	if profile.Output != TABLE_OUTPUT && profile.Output != JSON_OUTPUT && profile.Output != CSV_OUTPUT {
+		fmt.Fprintln(stderr, "Error:", ErrUnknownOutput)
+		return 2
+	}
+	client, err := connect(profile)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return 1
+	}
+	defer client.Disconnect()
+	ctx, cancel, err := requestContext(profile, c.streaming)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return 2
+	}
+	defer cancel()
+	r, err := c.run(ctx, client, fs.Args()[1:])
+	if errors.Is(err, ErrUsage) {
+		fmt.Fprintf(stderr, "Usage: votectl [flags] %s %s\n", c.name, c.args)
+		return 2
+	}
+	if err != nil {
+		if s, ok := status.FromError(err); ok {
+			fmt.Fprintf(stderr, "Error: %s: %s\n", s.Code(), s.Message())
+		} else {
+			fmt.Fprintln(stderr, "Error:", err)
+		}
+		return 1
+	}
+	if err := printResult(stdout, profile.Output, r); err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+func printUsage(fs *flag.FlagSet, w io.Writer) {
+	fmt.Fprintln(w, "Usage: votectl [flags] <command> [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(table, "  %s %s\t%s\n", c.name, c.args, c.summary)
+	}
+	table.Flush()
+	fmt.Fprintln(w, "\nFlags:")
+	fs.PrintDefaults()
+}
+
+// Connects to the addresses of the profile, separated by commas. The deadline of the calls is set
+// by requestContext instead of the client
+func connect(profile Profile) (grpc_client.Client, error) {
+	creds, err := profile.credentials()
+	if err != nil {
+		return nil, err
+	}
+	opts := []grpc_client.Option{grpc_client.WithTimeout(0)}
+	if creds != nil {
+		opts = append(opts, grpc_client.WithTransportCredentials(creds))
+	}
+	return grpc_client.New(strings.Split(profile.Address, ","), opts...)
+}
+
+// Context of the request, with its deadline unless the timeout is 0, and carrying the tenant and token of the profile.
+// Streaming commands only get a deadline when the profile or --timeout sets one
+func requestContext(profile Profile, streaming bool) (context.Context, context.CancelFunc, error) {
+	timeout, err := profile.timeout()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := context.Background()
+	if profile.Tenant != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, tenant.METADATA_KEY, profile.Tenant)
+	}
+	if profile.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, AUTHORIZATION_METADATA_KEY, "Bearer "+profile.Token)
+	}
+	if timeout == 0 || (streaming && profile.Timeout == "") {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
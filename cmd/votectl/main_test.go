@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Answers from memory and keeps the metadata of the last request
+type fakeVoteServer struct {
+	votes    map[string]*pb.VoteStruct
+	metadata metadata.MD
+	// the next export fails after its first chunk
+	breakExport bool
+	pb.UnimplementedVoteServer
+}
+
+func (s *fakeVoteServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	s.metadata, _ = metadata.FromIncomingContext(ctx)
+	vote, ok := s.votes[req.GetId()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "vote not found")
+	}
+	return &pb.GetResponse{Vote: vote}, nil
+}
+
+func (s *fakeVoteServer) ListVotesInVideo(ctx context.Context, req *pb.ListVotesInVideoRequest) (*pb.ListVotesInVideoResponse, error) {
+	response := &pb.ListVotesInVideoResponse{}
+	for _, vote := range s.votes {
+		if vote.GetVideo() == req.GetId() {
+			response.Vote = append(response.Vote, vote)
+		}
+	}
+	return response, nil
+}
+
+// Exports one line per chunk, the cursor being the number of the line
+func (s *fakeVoteServer) ExportVotes(req *pb.ExportVotesRequest, stream pb.Vote_ExportVotesServer) error {
+	lines := []string{"line 1\n", "line 2\n", "line 3\n"}
+	start := 0
+	if req.GetCursor() != "" {
+		start, _ = strconv.Atoi(req.GetCursor())
+	}
+	for i := start; i < len(lines); i++ {
+		if err := stream.Send(&pb.ExportVotesResponse{Data: []byte(lines[i]), Votes: 1, Cursor: strconv.Itoa(i + 1)}); err != nil {
+			return err
+		}
+		if s.breakExport {
+			s.breakExport = false
+			return status.Error(codes.Unavailable, "connection lost")
+		}
+	}
+	return nil
+}
+
+// Reads the file as lines of a CSV file, failing the lines with an invalid vote
+func (s *fakeVoteServer) ImportVotes(stream pb.Vote_ImportVotesServer) error {
+	var file []byte
+	var dryRun bool
+	for i := 0; ; i++ {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			dryRun = req.GetDryRun()
+		}
+		file = append(file, req.GetData()...)
+	}
+	summary := &pb.ImportVotesSummary{DryRun: dryRun}
+	lines := strings.Split(strings.TrimSpace(string(file)), "\n")[1:]
+	for i, line := range lines {
+		summary.Lines++
+		if strings.Contains(line, "invalid") {
+			summary.Failed++
+			failure := &pb.BatchItemResult{Index: int32(i + 2), Code: int32(codes.InvalidArgument), Message: "invalid vote"}
+			if err := stream.Send(&pb.ImportVotesResponse{Failure: []*pb.BatchItemResult{failure}}); err != nil {
+				return err
+			}
+		} else {
+			summary.Inserted++
+		}
+	}
+	return stream.Send(&pb.ImportVotesResponse{Summary: summary})
+}
+
+func startFakeServer(t *testing.T) (*fakeVoteServer, string) {
+	fake := &fakeVoteServer{votes: map[string]*pb.VoteStruct{
+		"vote-1": {Id: "vote-1", Video: "video-1", User: "user-1", Upvote: true, Version: 2},
+	}}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening. %v", err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterVoteServer(server, fake)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return fake, lis.Addr().String()
+}
+
+func runVotectl(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"--config", ""}, args...), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestGet(t *testing.T) {
+	fake, address := startFakeServer(t)
+	code, stdout, stderr := runVotectl("--address", address, "--tenant", "acme", "--token", "secret", "--output", "csv", "get", "vote-1")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "id,video,user,upvote,version\nvote-1,video-1,user-1,true,2\n", stdout)
+	assert.Equal(t, []string{"acme"}, fake.metadata.Get("x-tenant-id"))
+	assert.Equal(t, []string{"Bearer secret"}, fake.metadata.Get("authorization"))
+
+	code, stdout, _ = runVotectl("--address", address, "--output", "json", "get", "vote-1")
+	assert.Equal(t, 0, code)
+	assert.JSONEq(t, `{"id":"vote-1","video":"video-1","user":"user-1","upvote":true,"version":"2"}`, stdout)
+
+	code, _, stderr = runVotectl("--address", address, "get", "missing")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "Error: NotFound: vote not found\n", stderr)
+}
+
+func TestListByVideo(t *testing.T) {
+	_, address := startFakeServer(t)
+	code, stdout, _ := runVotectl("--address", address, "--output", "json", "list-by-video", "video-1")
+	assert.Equal(t, 0, code)
+	assert.JSONEq(t, `[{"id":"vote-1","video":"video-1","user":"user-1","upvote":true,"version":"2"}]`, stdout)
+}
+
+func TestUsage(t *testing.T) {
+	code, _, _ := runVotectl()
+	assert.Equal(t, 2, code)
+	code, _, stderr := runVotectl("vote")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `Unknown command "vote"`)
+	code, _, stderr = runVotectl("get")
+	assert.Equal(t, 2, code, "The id of the vote should be required")
+	assert.Contains(t, stderr, "Usage: votectl [flags] get <id>")
+	code, _, _ = runVotectl("update", "vote-1")
+	assert.Equal(t, 2, code, "The new value should be required")
+	code, _, _ = runVotectl("--output", "xml", "get", "vote-1")
+	assert.Equal(t, 2, code)
+}
+
+func TestProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"current_profile": "local", "profiles": {
+		"local": {"address": "localhost:9001", "output": "json"},
+		"prod": {"address": "votes.example.com:443", "tls": true, "tenant": "acme", "timeout": "30s"}
+	}}`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config. %v", err)
+	}
+	resolve := func(args ...string) (Profile, error) {
+		fs := flag.NewFlagSet("votectl", flag.ContinueOnError)
+		global := newGlobalFlags(fs)
+		if err := fs.Parse(append([]string{"--config", path}, args...)); err != nil {
+			t.Fatalf("Error parsing flags. %v", err)
+		}
+		return global.resolve(fs)
+	}
+	profile, err := resolve()
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost:9001", profile.Address)
+	assert.Equal(t, JSON_OUTPUT, profile.Output)
+
+	profile, err = resolve("--profile", "prod", "--tenant", "other")
+	assert.Nil(t, err)
+	assert.Equal(t, "votes.example.com:443", profile.Address)
+	assert.True(t, profile.TLS)
+	assert.Equal(t, "other", profile.Tenant, "Flags should override the profile")
+	assert.Equal(t, TABLE_OUTPUT, profile.Output)
+
+	_, err = resolve("--profile", "staging")
+	assert.ErrorIs(t, err, ErrUnknownProfile)
+}
+
+func TestRequestContextDeadline(t *testing.T) {
+	ctx, cancel, err := requestContext(Profile{}, false)
+	assert.Nil(t, err)
+	defer cancel()
+	_, ok := ctx.Deadline()
+	assert.True(t, ok, "Requests should have the default deadline")
+
+	ctx, cancel, err = requestContext(Profile{}, true)
+	assert.Nil(t, err)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok, "Streaming commands should have no default deadline")
+
+	ctx, cancel, err = requestContext(Profile{Timeout: "1m"}, true)
+	assert.Nil(t, err)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.True(t, ok, "A timeout set explicitly should apply to streaming commands")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Output formats
+const (
+	TABLE_OUTPUT = "table"
+	JSON_OUTPUT  = "json"
+	CSV_OUTPUT   = "csv"
+)
+
+var ErrUnknownOutput = errors.New("output must be table, json or csv")
+
+// What a command prints, as rows of a table or CSV, or as JSON
+type result struct {
+	header []string
+	rows   [][]string
+	// printed as JSON. Proto messages are marshalled with the field names of the HTTP API
+	value interface{}
+}
+
+func printResult(w io.Writer, format string, r result) error {
+	switch format {
+	case TABLE_OUTPUT:
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, strings.ToUpper(strings.Join(r.header, "\t")))
+		for _, row := range r.rows {
+			fmt.Fprintln(table, strings.Join(row, "\t"))
+		}
+		return table.Flush()
+	case CSV_OUTPUT:
+		writer := csv.NewWriter(w)
+		writer.Write(r.header)
+		writer.WriteAll(r.rows)
+		return writer.Error()
+	case JSON_OUTPUT:
+		return printJSON(w, r.value)
+	}
+	return ErrUnknownOutput
+}
+
+func printJSON(w io.Writer, value interface{}) error {
+	switch v := value.(type) {
+	case proto.Message:
+		content, err := protojson.Marshal(v)
+		if err != nil {
+			return err
+		}
+		value = json.RawMessage(content)
+	case []proto.Message:
+		messages := make([]json.RawMessage, len(v))
+		for i, message := range v {
+			content, err := protojson.Marshal(message)
+			if err != nil {
+				return err
+			}
+			messages[i] = content
+		}
+		value = messages
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+var voteHeader = []string{"id", "video", "user", "upvote", "version"}
+
+func voteRow(vote *pb.VoteStruct) []string {
+	return []string{
+		vote.GetId(),
+		vote.GetVideo(),
+		vote.GetUser(),
+		strconv.FormatBool(vote.GetUpvote()),
+		strconv.FormatInt(vote.GetVersion(), 10),
+	}
+}
+
+func votesResult(votes []*pb.VoteStruct) result {
+	r := result{header: voteHeader}
+	messages := make([]proto.Message, len(votes))
+	for i, vote := range votes {
+		r.rows = append(r.rows, voteRow(vote))
+		messages[i] = vote
+	}
+	r.value = messages
+	return r
+}
+
+// Result of a command answering with a few counts or ids, as a single row
+func fieldsResult(names []string, values ...interface{}) result {
+	r := result{header: names}
+	row := make([]string, len(values))
+	object := map[string]interface{}{}
+	for i, value := range values {
+		row[i] = fmt.Sprint(value)
+		object[names[i]] = value
+	}
+	r.rows = [][]string{row}
+	r.value = object
+	return r
+}
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Metadata key of the bearer token. The HTTP gateway forwards the Authorization header to it
+	METADATA_KEY = "authorization"
+	// Role of the tokens allowed to call the admin services
+	ADMIN_ROLE = "admin"
+)
+
+var (
+	ErrNoSecret     = errors.New("tokens can't be verified, AUTH_SECRET is not set")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("the token expired")
+)
+
+// Caller of a request, taken from the claims of its token
+type Identity struct {
+	// who the caller is, recorded as the actor of the admin actions
+	Subject string   `json:"sub"`
+	Roles   []string `json:"roles,omitempty"`
+	// tenant the caller belongs to, whose votes are the only ones it reaches
+	Tenant    string `json:"tenant,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+func (i Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type Config struct {
+	// Key of the HMAC-SHA256 signature of the tokens. Tokens are refused while it is empty
+	Secret []byte
+	// If true, calling the API requires a token, not only the admin services
+	Required bool
+}
+
+// Reads the configuration from AUTH_SECRET and AUTH_REQUIRED
+func ConfigFromEnv() Config {
+	return Config{
+		Secret:   []byte(os.Getenv("AUTH_SECRET")),
+		Required: os.Getenv("AUTH_REQUIRED") == "true",
+	}
+}
+
+var encoding = base64.RawURLEncoding
+
+// Header of every token, signed with HMAC-SHA256
+var tokenHeader = encoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func (c Config) signature(content string) []byte {
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write([]byte(content))
+	return mac.Sum(nil)
+}
+
+// Creates a JWT carrying the identity, signed with the secret
+func (c Config) Sign(identity Identity) (string, error) {
+	if len(c.Secret) == 0 {
+		return "", ErrNoSecret
+	}
+	claims, err := json.Marshal(identity)
+	if err != nil {
+		return "", err
+	}
+	content := tokenHeader + "." + encoding.EncodeToString(claims)
+	return content + "." + encoding.EncodeToString(c.signature(content)), nil
+}
+
+// Returns the identity of a JWT signed with the secret using HS256, which must have a subject and
+// not be expired
+func (c Config) Verify(token string, now time.Time) (Identity, error) {
+	if len(c.Secret) == 0 {
+		return Identity{}, ErrNoSecret
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, ErrInvalidToken
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if rawHeader, err := encoding.DecodeString(parts[0]); err != nil || json.Unmarshal(rawHeader, &header) != nil || header.Algorithm != "HS256" {
+		return Identity{}, ErrInvalidToken
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, c.signature(parts[0]+"."+parts[1])) {
+		return Identity{}, ErrInvalidToken
+	}
+	var identity Identity
+	if rawClaims, err := encoding.DecodeString(parts[1]); err != nil || json.Unmarshal(rawClaims, &identity) != nil || identity.Subject == "" {
+		return Identity{}, ErrInvalidToken
+	}
+	if identity.ExpiresAt != 0 && now.Unix() >= identity.ExpiresAt {
+		return Identity{}, ErrExpiredToken
+	}
+	return identity, nil
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// Identity of the caller of the request, if it sent a valid token
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok
+}
+
+// Calls an Authenticator protects: gRPC services by their full name, such as proto.Admin, and
+// HTTP paths by their leading segments, such as /v1/admin, which covers /v1/admin and every path
+// under it but not /v1/administrators
+type Scope struct {
+	Services []string
+	Paths    []string
+}
+
+func (s Scope) hasMethod(method string) bool {
+	for _, service := range s.Services {
+		if strings.HasPrefix(method, "/"+service+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scope) hasPath(path string) bool {
+	for _, prefix := range s.Paths {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifies the tokens of the calls to the API, and only lets admins call the admin scope. Calls
+// outside of both, such as health checks, are left alone
+type Authenticator struct {
+	config  Config
+	tenants tenant.Config
+	api     Scope
+	admin   Scope
+}
+
+func NewAuthenticator(config Config, tenants tenant.Config, api Scope, admin Scope) *Authenticator {
+	return &Authenticator{config: config, tenants: tenants, api: api, admin: admin}
+}
+
+// Returns ctx with the identity of the caller if it sent a token, which is required by admin calls,
+// and with the tenant of the token. The tenant sent in the header must match it, and is refused
+// when the token has none unless the header is trusted
+func (a *Authenticator) authenticate(ctx context.Context, authorization string, header string, admin bool) (context.Context, error) {
+	if authorization == "" {
+		if admin {
+			return nil, status.Error(codes.Unauthenticated, "An admin token is required")
+		}
+		if a.config.Required {
+			return nil, status.Error(codes.Unauthenticated, "A token is required")
+		}
+		return a.headerTenant(ctx, header)
+	}
+	const prefix = "bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return nil, status.Error(codes.Unauthenticated, "The authorization must be a bearer token")
+	}
+	identity, err := a.config.Verify(authorization[len(prefix):], time.Now())
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if admin && !identity.HasRole(ADMIN_ROLE) {
+		return nil, status.Error(codes.PermissionDenied, "The token is not of an admin")
+	}
+	if identity.Tenant != "" {
+		if header != "" && header != identity.Tenant {
+			return nil, status.Error(codes.PermissionDenied, "The tenant doesn't match the one of the token")
+		}
+		return NewContext(tenant.NewContext(ctx, identity.Tenant), identity), nil
+	}
+	ctx, err = a.headerTenant(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+	return NewContext(ctx, identity), nil
+}
+
+// Returns ctx with the tenant sent in the header, refused unless it is trusted
+func (a *Authenticator) headerTenant(ctx context.Context, header string) (context.Context, error) {
+	if header == "" {
+		return ctx, nil
+	}
+	if !a.tenants.TrustHeader {
+		return nil, status.Error(codes.PermissionDenied, "The tenant must be set in the token")
+	}
+	return tenant.NewContext(ctx, header), nil
+}
+
+func (a *Authenticator) serverCall(ctx context.Context, method string) (context.Context, error) {
+	admin := a.admin.hasMethod(method)
+	if !admin && !a.api.hasMethod(method) {
+		return ctx, nil
+	}
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(METADATA_KEY); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	return a.authenticate(ctx, authorization, tenant.FromMetadata(ctx), admin)
+}
+
+func (a *Authenticator) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.serverCall(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// Server stream whose context has the identity of the caller
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *Authenticator) StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.serverCall(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// Authenticates the requests handled by the gateway, which calls the servers without going
+// through the gRPC interceptors. Refused requests are answered as the gateway answers errors
+func (a *Authenticator) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin := a.admin.hasPath(r.URL.Path)
+		if !admin && !a.api.hasPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, err := a.authenticate(r.Context(), r.Header.Get("Authorization"), r.Header.Get("X-Tenant-Id"), admin)
+		if err != nil {
+			writeError(w, status.Convert(err))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func writeError(w http.ResponseWriter, st *status.Status) {
+	w.Header().Set("Content-Type", "application/json")
+	if st.Code() == codes.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.WriteHeader(runtime.HTTPStatusFromCode(st.Code()))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    st.Code(),
+		"message": st.Message(),
+		"details": []interface{}{},
+	})
+}
@@ -0,0 +1,194 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/auth"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	mock_config = auth.Config{Secret: []byte("secret")}
+	mock_api    = auth.Scope{Services: []string{"proto.Vote"}, Paths: []string{"/v1/"}}
+	mock_admin  = auth.Scope{Services: []string{"proto.Admin"}, Paths: []string{"/v1/admin/"}}
+)
+
+func sign(t *testing.T, config auth.Config, identity auth.Identity) string {
+	token, err := config.Sign(identity)
+	if err != nil {
+		t.Fatalf("Error signing token. %v", err)
+	}
+	return token
+}
+
+// Calls the method through the authenticator with the metadata given, returning the identity
+// the handler got and the tenant it resolved
+func callWith(authenticator *auth.Authenticator, method string, md metadata.MD) (*auth.Identity, string, error) {
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	var identity *auth.Identity
+	var id string
+	_, err := authenticator.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		if found, ok := auth.FromContext(ctx); ok {
+			identity = &found
+		}
+		id, _ = tenant.Config{DefaultTenant: "main"}.FromContext(ctx)
+		return nil, nil
+	})
+	return identity, id, err
+}
+
+// Calls the method through the authenticator with the authorization given, returning the
+// identity the handler got
+func call(authenticator *auth.Authenticator, method string, authorization string) (*auth.Identity, error) {
+	md := metadata.MD{}
+	if authorization != "" {
+		md = metadata.Pairs(auth.METADATA_KEY, authorization)
+	}
+	identity, _, err := callWith(authenticator, method, md)
+	return identity, err
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	token := sign(t, mock_config, auth.Identity{Subject: "moderator", Roles: []string{auth.ADMIN_ROLE}, ExpiresAt: now.Add(time.Hour).Unix()})
+	identity, err := mock_config.Verify(token, now)
+	if err != nil {
+		t.Fatalf("Error verifying token. %v", err)
+	}
+	assert.Equal(t, "moderator", identity.Subject)
+	assert.True(t, identity.HasRole(auth.ADMIN_ROLE))
+	_, err = mock_config.Verify(token, now.Add(2*time.Hour))
+	assert.Equal(t, auth.ErrExpiredToken, err)
+	_, err = auth.Config{Secret: []byte("other")}.Verify(token, now)
+	assert.Equal(t, auth.ErrInvalidToken, err, "Tokens signed with another secret should be refused")
+	_, err = auth.Config{}.Verify(token, now)
+	assert.Equal(t, auth.ErrNoSecret, err)
+	_, err = mock_config.Verify(sign(t, mock_config, auth.Identity{}), now)
+	assert.Equal(t, auth.ErrInvalidToken, err, "Tokens without subject should be refused")
+	_, err = mock_config.Verify("a.b.c", now)
+	assert.Equal(t, auth.ErrInvalidToken, err)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	authenticator := auth.NewAuthenticator(mock_config, tenant.Config{}, mock_api, mock_admin)
+	admin := "Bearer " + sign(t, mock_config, auth.Identity{Subject: "moderator", Roles: []string{auth.ADMIN_ROLE}})
+	user := "Bearer " + sign(t, mock_config, auth.Identity{Subject: "app"})
+	_, err := call(authenticator, "/proto.Admin/BanUser", "")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "Admin calls should require a token")
+	_, err = call(authenticator, "/proto.Admin/BanUser", user)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "Admin calls should require the admin role")
+	_, err = call(authenticator, "/proto.Admin/BanUser", "Basic "+user)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	identity, err := call(authenticator, "/proto.Admin/BanUser", admin)
+	assert.Nil(t, err)
+	if assert.NotNil(t, identity) {
+		assert.Equal(t, "moderator", identity.Subject)
+	}
+	identity, err = call(authenticator, "/proto.Vote/Get", "")
+	assert.Nil(t, err, "Tokens should be optional unless required")
+	assert.Nil(t, identity)
+	_, err = call(authenticator, "/proto.Vote/Get", "Bearer invalid")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "Invalid tokens should be refused even when optional")
+	_, err = call(authenticator, "/grpc.health.v1.Health/Check", "Bearer invalid")
+	assert.Nil(t, err, "Calls outside of the scopes should be left alone")
+	required := auth.NewAuthenticator(auth.Config{Secret: mock_config.Secret, Required: true}, tenant.Config{}, mock_api, mock_admin)
+	_, err = call(required, "/proto.Vote/Get", "")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = call(required, "/proto.Vote/Get", user)
+	assert.Nil(t, err)
+}
+
+func TestTenantFromToken(t *testing.T) {
+	authenticator := auth.NewAuthenticator(mock_config, tenant.Config{}, mock_api, mock_admin)
+	acme := "Bearer " + sign(t, mock_config, auth.Identity{Subject: "app", Tenant: "acme"})
+	plain := "Bearer " + sign(t, mock_config, auth.Identity{Subject: "app"})
+	_, id, err := callWith(authenticator, "/proto.Vote/Get", metadata.Pairs(auth.METADATA_KEY, acme))
+	assert.Nil(t, err)
+	assert.Equal(t, "acme", id, "The tenant should be taken from the token")
+	_, id, err = callWith(authenticator, "/proto.Vote/Get", metadata.Pairs(auth.METADATA_KEY, acme, tenant.METADATA_KEY, "acme"))
+	assert.Nil(t, err)
+	assert.Equal(t, "acme", id)
+	_, _, err = callWith(authenticator, "/proto.Vote/Get", metadata.Pairs(auth.METADATA_KEY, acme, tenant.METADATA_KEY, "other"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "A tenant other than the one of the token should be refused")
+	_, _, err = callWith(authenticator, "/proto.Vote/Get", metadata.Pairs(auth.METADATA_KEY, plain, tenant.METADATA_KEY, "acme"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "The header shouldn't be trusted by default")
+	_, _, err = callWith(authenticator, "/proto.Vote/Get", metadata.Pairs(tenant.METADATA_KEY, "acme"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, id, err = callWith(authenticator, "/proto.Vote/Get", metadata.Pairs(auth.METADATA_KEY, plain))
+	assert.Nil(t, err)
+	assert.Equal(t, "main", id)
+	trusted := auth.NewAuthenticator(mock_config, tenant.Config{TrustHeader: true}, mock_api, mock_admin)
+	_, id, err = callWith(trusted, "/proto.Vote/Get", metadata.Pairs(tenant.METADATA_KEY, "acme"))
+	assert.Nil(t, err)
+	assert.Equal(t, "acme", id, "A trusted header should be used when the token has no tenant")
+	_, _, err = callWith(trusted, "/proto.Vote/Get", metadata.Pairs(auth.METADATA_KEY, acme, tenant.METADATA_KEY, "other"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "The token should have priority over a trusted header")
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	authenticator := auth.NewAuthenticator(mock_config, tenant.Config{}, mock_api, mock_admin)
+	var identity *auth.Identity
+	handler := authenticator.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = nil
+		if found, ok := auth.FromContext(r.Context()); ok {
+			identity = &found
+		}
+	}))
+	serve := func(path string, authorization string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, serve("/v1/admin/bans", ""))
+	assert.Equal(t, http.StatusForbidden, serve("/v1/admin/bans", "Bearer "+sign(t, mock_config, auth.Identity{Subject: "app"})))
+	assert.Equal(t, http.StatusOK, serve("/v1/admin/bans", "Bearer "+sign(t, mock_config, auth.Identity{Subject: "moderator", Roles: []string{auth.ADMIN_ROLE}})))
+	if assert.NotNil(t, identity) {
+		assert.Equal(t, "moderator", identity.Subject)
+	}
+	assert.Equal(t, http.StatusOK, serve("/v1/61f0c0ffee0000000000000a", ""))
+	assert.Equal(t, http.StatusOK, serve("/healthz", "Bearer invalid"))
+	r := httptest.NewRequest(http.MethodGet, "/v1/61f0c0ffee0000000000000a", nil)
+	r.Header.Set("Authorization", "Bearer "+sign(t, mock_config, auth.Identity{Subject: "app", Tenant: "acme"}))
+	r.Header.Set("X-Tenant-Id", "other")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// Insert and UpdateOne are routed to /v1 itself, which must be authenticated like the paths under it
+func TestHTTPMiddlewareRoot(t *testing.T) {
+	required := auth.NewAuthenticator(auth.Config{Secret: mock_config.Secret, Required: true}, tenant.Config{}, mock_api, mock_admin)
+	var id string
+	handler := required.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ = tenant.Config{DefaultTenant: "main"}.FromContext(r.Context())
+	}))
+	acme := "Bearer " + sign(t, mock_config, auth.Identity{Subject: "app", Tenant: "acme"})
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/v1", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "%s /v1 should require a token", method)
+		id = ""
+		r := httptest.NewRequest(method, "/v1", nil)
+		r.Header.Set("Authorization", acme)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "acme", id, "%s /v1 should use the tenant of the token", method)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1beta", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "Paths only sharing a prefix with the scope should be left alone")
+}
@@ -0,0 +1,17 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache of encoded values. The in-process LRU is the default implementation, a shared cache can be
+// used instead by implementing this interface, so every instance of the API sees the same entries
+type Cache interface {
+	// Returns the value stored with the key and whether it was found. Expired values are not found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Stores the value with the key until ttl passes
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Removes the values of the keys, if stored
+	Delete(ctx context.Context, keys ...string) error
+}
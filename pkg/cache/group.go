@@ -0,0 +1,62 @@
+package cache
+
+import "sync"
+
+type call struct {
+	done   chan struct{}
+	values map[string][]byte
+	err    error
+}
+
+// Collapses concurrent loads of the same keys, so a hot key missing from the cache is loaded from
+// the database once instead of once per request
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Loads the keys with load, returning the values found. Keys already being loaded by another
+// caller are waited for instead of loaded again, the others are loaded in a single call of load
+func (g *Group) Do(keys []string, load func(keys []string) (map[string][]byte, error)) (map[string][]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	own := &call{done: make(chan struct{})}
+	var missing []string
+	waiting := make(map[string]*call)
+	for _, key := range keys {
+		if existing, ok := g.calls[key]; ok {
+			waiting[key] = existing
+			continue
+		}
+		if _, ok := waiting[key]; !ok {
+			g.calls[key] = own
+			waiting[key] = own
+			missing = append(missing, key)
+		}
+	}
+	g.mu.Unlock()
+
+	if len(missing) > 0 {
+		own.values, own.err = load(missing)
+		g.mu.Lock()
+		for _, key := range missing {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		close(own.done)
+	}
+
+	values := make(map[string][]byte, len(keys))
+	for key, c := range waiting {
+		<-c.done
+		if c.err != nil {
+			return nil, c.err
+		}
+		if value, ok := c.values[key]; ok {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
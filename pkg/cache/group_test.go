@@ -0,0 +1,69 @@
+package cache_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupCollapsesConcurrentLoads(t *testing.T) {
+	var group cache.Group
+	var loads int32
+	release := make(chan struct{})
+	load := func(keys []string) (map[string][]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		values := make(map[string][]byte)
+		for _, key := range keys {
+			values[key] = []byte(key)
+		}
+		return values, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := group.Do([]string{"hot"}, load)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("hot"), values["hot"])
+		}()
+	}
+	// give every caller time to join the first load
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads), "Concurrent loads of a key should be collapsed")
+}
+
+func TestGroupLoadsOnlyMissingKeys(t *testing.T) {
+	var group cache.Group
+	var loaded [][]string
+	values, err := group.Do([]string{"a", "b", "a"}, func(keys []string) (map[string][]byte, error) {
+		loaded = append(loaded, keys)
+		return map[string][]byte{"a": []byte("1"), "b": []byte("2")}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}}, loaded, "Repeated keys should be loaded once")
+	assert.Equal(t, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, values)
+}
+
+func TestGroupError(t *testing.T) {
+	var group cache.Group
+	mock_err := errors.New("failed")
+	_, err := group.Do([]string{"a"}, func(keys []string) (map[string][]byte, error) {
+		return nil, mock_err
+	})
+	assert.Equal(t, mock_err, err)
+	// failed loads are not remembered
+	values, err := group.Do([]string{"a"}, func(keys []string) (map[string][]byte, error) {
+		return map[string][]byte{"a": []byte("1")}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), values["a"])
+}
@@ -0,0 +1,60 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUGetSet(t *testing.T) {
+	mock_ctx := context.Background()
+	c := cache.NewLRU(2)
+	_, ok, err := c.Get(mock_ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, ok, "Keys not stored should not be found")
+	assert.NoError(t, c.Set(mock_ctx, "a", []byte("1"), time.Minute))
+	value, ok, _ := c.Get(mock_ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	assert.NoError(t, c.Delete(mock_ctx, "a"))
+	_, ok, _ = c.Get(mock_ctx, "a")
+	assert.False(t, ok, "Deleted keys should not be found")
+}
+
+func TestLRUEviction(t *testing.T) {
+	mock_ctx := context.Background()
+	c := cache.NewLRU(2)
+	c.Set(mock_ctx, "a", []byte("1"), time.Minute)
+	c.Set(mock_ctx, "b", []byte("2"), time.Minute)
+	// reading a makes b the least recently used
+	c.Get(mock_ctx, "a")
+	c.Set(mock_ctx, "c", []byte("3"), time.Minute)
+	_, ok, _ := c.Get(mock_ctx, "b")
+	assert.False(t, ok, "The least recently used key should be evicted")
+	_, ok, _ = c.Get(mock_ctx, "a")
+	assert.True(t, ok)
+	_, ok, _ = c.Get(mock_ctx, "c")
+	assert.True(t, ok)
+}
+
+func TestLRUExpiration(t *testing.T) {
+	mock_ctx := context.Background()
+	c := cache.NewLRU(2)
+	c.Set(mock_ctx, "a", []byte("1"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, ok, _ := c.Get(mock_ctx, "a")
+	assert.False(t, ok, "Expired keys should not be found")
+}
+
+func TestLRUNegativeSize(t *testing.T) {
+	mock_ctx := context.Background()
+	c := cache.NewLRU(-1)
+	assert.NotPanics(t, func() {
+		assert.NoError(t, c.Set(mock_ctx, "a", []byte("1"), time.Minute))
+	})
+	_, ok, _ := c.Get(mock_ctx, "a")
+	assert.False(t, ok, "A cache with a negative size should hold nothing")
+}
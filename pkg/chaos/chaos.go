@@ -0,0 +1,314 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Latencies are drawn evenly between the minimum and the maximum
+	UNIFORM_DISTRIBUTION = "uniform"
+	// Latencies are drawn from a normal distribution centered between the minimum and the
+	// maximum, six standard deviations wide, and kept between them
+	NORMAL_DISTRIBUTION = "normal"
+	// Method of the rules applied to every method
+	ANY_METHOD = "*"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid fault injection configuration")
+	ErrProduction    = errors.New("fault injection is not allowed in production")
+)
+
+// Names of ENVIRONMENT where faults can't be injected. An empty one counts as production
+var productionEnvironments = []string{"", "prod", "production"}
+
+// Status code returned by a call, with the given probability
+type Error struct {
+	Code        codes.Code
+	Probability float64
+}
+
+// Time added before a call, with the given probability
+type Latency struct {
+	Probability  float64
+	Distribution string
+	Min          time.Duration
+	Max          time.Duration
+}
+
+// Faults injected in the calls of a method
+type Rule struct {
+	// Full name of the method, such as /proto.Vote/Get, its name alone, or ANY_METHOD
+	Method string
+	// Drawn in order, so their probabilities add up to 1 at most
+	Errors  []Error
+	Latency *Latency
+	// Probability of dropping a stream after a random amount of its messages, up to DropAfter
+	DropProbability float64
+	DropAfter       int
+}
+
+type Config struct {
+	Enabled bool
+	// Calls made in the same order with the same seed get the same faults
+	Seed int64
+	// The first rule matching a method applies to it
+	Rules []Rule
+}
+
+// Reads whether fault injection is enabled from FAULT_INJECTION. It can only be enabled when
+// ENVIRONMENT names a non-production environment, such as "staging"
+func EnabledFromEnv() (bool, error) {
+	if os.Getenv("FAULT_INJECTION") != "true" {
+		return false, nil
+	}
+	environment := strings.ToLower(os.Getenv("ENVIRONMENT"))
+	for _, production := range productionEnvironments {
+		if environment == production {
+			return false, ErrProduction
+		}
+	}
+	return true, nil
+}
+
+func validProbability(probability float64) bool {
+	return probability >= 0 && probability <= 1
+}
+
+func (c Config) Validate() error {
+	for _, rule := range c.Rules {
+		if rule.Method == "" {
+			return fmt.Errorf("%w: a rule has no method", ErrInvalidConfig)
+		}
+		total := 0.0
+		for _, e := range rule.Errors {
+			if e.Code == codes.OK {
+				return fmt.Errorf("%w: the errors of %s can't have code OK", ErrInvalidConfig, rule.Method)
+			}
+			if !validProbability(e.Probability) {
+				return fmt.Errorf("%w: invalid probability %v of %s", ErrInvalidConfig, e.Probability, rule.Method)
+			}
+			total += e.Probability
+		}
+		if total > 1 {
+			return fmt.Errorf("%w: the probabilities of the errors of %s add up to more than 1", ErrInvalidConfig, rule.Method)
+		}
+		if latency := rule.Latency; latency != nil {
+			if !validProbability(latency.Probability) {
+				return fmt.Errorf("%w: invalid probability %v of the latency of %s", ErrInvalidConfig, latency.Probability, rule.Method)
+			}
+			if latency.Distribution != UNIFORM_DISTRIBUTION && latency.Distribution != NORMAL_DISTRIBUTION {
+				return fmt.Errorf("%w: unknown latency distribution %q", ErrInvalidConfig, latency.Distribution)
+			}
+			if latency.Min < 0 || latency.Max < latency.Min {
+				return fmt.Errorf("%w: invalid latency range of %s", ErrInvalidConfig, rule.Method)
+			}
+		}
+		if !validProbability(rule.DropProbability) || rule.DropAfter < 0 {
+			return fmt.Errorf("%w: invalid stream drops of %s", ErrInvalidConfig, rule.Method)
+		}
+	}
+	return nil
+}
+
+func (r Rule) matches(method string) bool {
+	return r.Method == ANY_METHOD || r.Method == method || r.Method == path.Base(method)
+}
+
+// Faults drawn for a call
+type fault struct {
+	delay time.Duration
+	err   error
+	// messages the stream gets before being dropped, or -1 to not drop it
+	dropAfter int
+}
+
+// Injects the faults configured into the calls of a gRPC server. It starts disabled
+type Injector struct {
+	mutex  sync.Mutex
+	config Config
+	// one per method, so the faults of a method only depend on the seed and its own calls
+	sources  map[string]*rand.Rand
+	services []string
+}
+
+// Create an injector of faults into the methods of the services given, so others such as the
+// one toggling the faults are left alone
+func NewInjector(services ...string) *Injector {
+	return &Injector{sources: map[string]*rand.Rand{}, services: services}
+}
+
+// Replace the configuration, starting the draws of every method over from the seed
+func (i *Injector) Set(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.config = config
+	i.sources = map[string]*rand.Rand{}
+	return nil
+}
+
+func (i *Injector) Config() Config {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.config
+}
+
+func (i *Injector) source(method string) *rand.Rand {
+	source, ok := i.sources[method]
+	if !ok {
+		hash := fnv.New64a()
+		hash.Write([]byte(method))
+		source = rand.New(rand.NewSource(i.config.Seed ^ int64(hash.Sum64())))
+		i.sources[method] = source
+	}
+	return source
+}
+
+func (i *Injector) injected(method string) bool {
+	for _, service := range i.services {
+		if strings.HasPrefix(method, "/"+service+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Injector) draw(method string) fault {
+	f := fault{dropAfter: -1}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if !i.config.Enabled || !i.injected(method) {
+		return f
+	}
+	var rule *Rule
+	for j := range i.config.Rules {
+		if i.config.Rules[j].matches(method) {
+			rule = &i.config.Rules[j]
+			break
+		}
+	}
+	if rule == nil {
+		return f
+	}
+	source := i.source(method)
+	// every call draws the same values, whatever faults they pick
+	latency, spread, failure, drop, dropAfter := source.Float64(), source.Float64(), source.Float64(), source.Float64(), source.Int()
+	normal := source.NormFloat64()
+	if l := rule.Latency; l != nil && latency < l.Probability {
+		f.delay = l.Min + time.Duration(spread*float64(l.Max-l.Min))
+		if l.Distribution == NORMAL_DISTRIBUTION {
+			f.delay = (l.Min+l.Max)/2 + time.Duration(normal*float64(l.Max-l.Min)/6)
+			if f.delay < l.Min {
+				f.delay = l.Min
+			}
+			if f.delay > l.Max {
+				f.delay = l.Max
+			}
+		}
+	}
+	for _, e := range rule.Errors {
+		if failure < e.Probability {
+			f.err = status.Errorf(e.Code, "Fault injected into %s", method)
+			break
+		}
+		failure -= e.Probability
+	}
+	if drop < rule.DropProbability {
+		f.dropAfter = dropAfter % (rule.DropAfter + 1)
+	}
+	return f
+}
+
+// Waits for the delay of the fault, or until the call is cancelled
+func (f fault) wait(ctx context.Context) error {
+	if f.delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(f.delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (i *Injector) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	f := i.draw(info.FullMethod)
+	if err := f.wait(ctx); err != nil {
+		return nil, err
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return handler(ctx, req)
+}
+
+var errDropped = status.Error(codes.Unavailable, "Stream dropped by fault injection")
+
+// Stream failing every message once remaining ones were sent or received
+type droppedStream struct {
+	grpc.ServerStream
+	remaining int
+	dropped   bool
+}
+
+func (s *droppedStream) next() error {
+	if s.remaining == 0 {
+		s.dropped = true
+		return errDropped
+	}
+	s.remaining--
+	return nil
+}
+
+func (s *droppedStream) SendMsg(m interface{}) error {
+	if err := s.next(); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *droppedStream) RecvMsg(m interface{}) error {
+	if err := s.next(); err != nil {
+		return err
+	}
+	return s.ServerStream.RecvMsg(m)
+}
+
+func (i *Injector) StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	f := i.draw(info.FullMethod)
+	if err := f.wait(ss.Context()); err != nil {
+		return err
+	}
+	if f.err != nil {
+		return f.err
+	}
+	if f.dropAfter < 0 {
+		return handler(srv, ss)
+	}
+	stream := &droppedStream{ServerStream: ss, remaining: f.dropAfter}
+	err := handler(srv, stream)
+	// the handler may have wrapped the error, or ignored it
+	if stream.dropped {
+		return errDropped
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/chaos"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	mock_service = "proto.Vote"
+	mock_method  = "/proto.Vote/Get"
+)
+
+func okHandler(ctx context.Context, req interface{}) (interface{}, error) {
+	return "ok", nil
+}
+
+// Codes returned by calls of the method through the injector
+func callCodes(injector *chaos.Injector, method string, calls int) []codes.Code {
+	var result []codes.Code
+	for i := 0; i < calls; i++ {
+		_, err := injector.UnaryServerInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, okHandler)
+		result = append(result, status.Code(err))
+	}
+	return result
+}
+
+func TestInjectorErrors(t *testing.T) {
+	injector := chaos.NewInjector(mock_service)
+	assert.Equal(t, []codes.Code{codes.OK}, callCodes(injector, mock_method, 1), "The injector should start disabled")
+	err := injector.Set(chaos.Config{Enabled: true, Rules: []chaos.Rule{{Method: "Get", Errors: []chaos.Error{{Code: codes.Unavailable, Probability: 1}}}}})
+	if err != nil {
+		t.Fatalf("Error setting the config. %v", err)
+	}
+	assert.Equal(t, []codes.Code{codes.Unavailable, codes.Unavailable}, callCodes(injector, mock_method, 2))
+	assert.Equal(t, []codes.Code{codes.OK}, callCodes(injector, "/proto.Vote/Insert", 1), "Only the methods of the rules should fail")
+	assert.Equal(t, []codes.Code{codes.OK}, callCodes(injector, "/proto.Admin/Get", 1), "Only the services of the injector should fail")
+}
+
+func TestInjectorSeed(t *testing.T) {
+	config := chaos.Config{Enabled: true, Seed: 42, Rules: []chaos.Rule{{
+		Method: chaos.ANY_METHOD,
+		Errors: []chaos.Error{{Code: codes.Unavailable, Probability: 0.3}, {Code: codes.Internal, Probability: 0.2}},
+	}}}
+	injector := chaos.NewInjector(mock_service)
+	if err := injector.Set(config); err != nil {
+		t.Fatalf("Error setting the config. %v", err)
+	}
+	first := callCodes(injector, mock_method, 50)
+	assert.Contains(t, first, codes.OK)
+	assert.Contains(t, first, codes.Unavailable)
+	assert.Contains(t, first, codes.Internal)
+	// setting the config again replays the same faults
+	injector.Set(config)
+	assert.Equal(t, first, callCodes(injector, mock_method, 50))
+	other := chaos.NewInjector(mock_service)
+	other.Set(config)
+	// calls of other methods don't change the faults of a method
+	callCodes(other, "/proto.Vote/Insert", 10)
+	assert.Equal(t, first, callCodes(other, mock_method, 50))
+	config.Seed = 7
+	other.Set(config)
+	assert.NotEqual(t, first, callCodes(other, mock_method, 50), "Another seed should inject other faults")
+}
+
+func TestInjectorLatency(t *testing.T) {
+	injector := chaos.NewInjector(mock_service)
+	err := injector.Set(chaos.Config{Enabled: true, Rules: []chaos.Rule{{
+		Method:  mock_method,
+		Latency: &chaos.Latency{Probability: 1, Distribution: chaos.NORMAL_DISTRIBUTION, Min: 20 * time.Millisecond, Max: 40 * time.Millisecond},
+	}}})
+	if err != nil {
+		t.Fatalf("Error setting the config. %v", err)
+	}
+	start := time.Now()
+	assert.Equal(t, []codes.Code{codes.OK}, callCodes(injector, mock_method, 1))
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, int64(elapsed), int64(20*time.Millisecond))
+	// the delay ends with the call
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err = injector.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: mock_method}, okHandler)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+type mockServerStream struct {
+	grpc.ServerStream
+	sent int
+}
+
+func (s *mockServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *mockServerStream) SendMsg(m interface{}) error {
+	s.sent++
+	return nil
+}
+
+func TestInjectorDropStreams(t *testing.T) {
+	injector := chaos.NewInjector(mock_service)
+	err := injector.Set(chaos.Config{Enabled: true, Rules: []chaos.Rule{{Method: "ExportVotes", DropProbability: 1, DropAfter: 3}}})
+	if err != nil {
+		t.Fatalf("Error setting the config. %v", err)
+	}
+	stream := &mockServerStream{}
+	err = injector.StreamServerInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/proto.Vote/ExportVotes"}, func(srv interface{}, ss grpc.ServerStream) error {
+		for i := 0; i < 10; i++ {
+			if err := ss.SendMsg(i); err != nil {
+				return errors.New("wrapped")
+			}
+		}
+		return nil
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err), "The stream should be dropped, even if the handler wraps the error")
+	assert.LessOrEqual(t, stream.sent, 3)
+}
+
+func TestInvalidConfig(t *testing.T) {
+	injector := chaos.NewInjector(mock_service)
+	configs := []chaos.Config{
+		{Rules: []chaos.Rule{{Errors: []chaos.Error{{Code: codes.Internal, Probability: 1}}}}},
+		{Rules: []chaos.Rule{{Method: "Get", Errors: []chaos.Error{{Code: codes.OK, Probability: 1}}}}},
+		{Rules: []chaos.Rule{{Method: "Get", Errors: []chaos.Error{{Code: codes.Internal, Probability: 0.6}, {Code: codes.Unavailable, Probability: 0.6}}}}},
+		{Rules: []chaos.Rule{{Method: "Get", Latency: &chaos.Latency{Probability: 1, Distribution: "pareto"}}}},
+		{Rules: []chaos.Rule{{Method: "Get", Latency: &chaos.Latency{Probability: 1, Distribution: chaos.UNIFORM_DISTRIBUTION, Min: time.Second}}}},
+		{Rules: []chaos.Rule{{Method: "Get", DropProbability: 2}}},
+	}
+	for _, config := range configs {
+		assert.ErrorIs(t, injector.Set(config), chaos.ErrInvalidConfig)
+	}
+}
+
+func TestEnabledFromEnv(t *testing.T) {
+	defer os.Unsetenv("FAULT_INJECTION")
+	defer os.Unsetenv("ENVIRONMENT")
+	enabled, err := chaos.EnabledFromEnv()
+	assert.Nil(t, err)
+	assert.False(t, enabled)
+	os.Setenv("FAULT_INJECTION", "true")
+	_, err = chaos.EnabledFromEnv()
+	assert.ErrorIs(t, err, chaos.ErrProduction, "Fault injection should need a non-production environment")
+	os.Setenv("ENVIRONMENT", "Production")
+	_, err = chaos.EnabledFromEnv()
+	assert.ErrorIs(t, err, chaos.ErrProduction)
+	os.Setenv("ENVIRONMENT", "staging")
+	enabled, err = chaos.EnabledFromEnv()
+	assert.Nil(t, err)
+	assert.True(t, enabled)
+}
@@ -0,0 +1,340 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/cache"
+	"github.com/IsaqueB/ps-klever/pkg/logging"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	BAN_COLLECTION        = "ban"
+	DEFAULT_BAN_CACHE_TTL = time.Minute
+)
+
+// User prevented from voting
+type Ban struct {
+	// tenant and user
+	ID        string             `bson:"_id"`
+	Tenant    string             `bson:"tenant,omitempty"`
+	User      primitive.ObjectID `bson:"user"`
+	Reason    string             `bson:"reason"`
+	Actor     string             `bson:"actor"`
+	CreatedAt time.Time          `bson:"created_at"`
+	// nil for permanent bans. Expired bans stop applying, and are removed by the database
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+}
+
+func (b *Ban) Expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !b.ExpiresAt.After(now)
+}
+
+type BanStore interface {
+	// Creates the index which removes the bans once they expire
+	EnsureIndexes(ctx context.Context) error
+	// Bans the user, replacing the ban it already has. Sets the id, tenant and time of the ban
+	Ban(ctx context.Context, ban Ban) (Ban, error)
+	// Lifts the ban of the user. Returns whether it was banned
+	Unban(ctx context.Context, user primitive.ObjectID) (bool, error)
+	// Returns the ban of the user, or nil if it isn't banned or the ban expired
+	Find(ctx context.Context, user primitive.ObjectID) (*Ban, error)
+	// Returns the bans of the users which are banned, by user, in a single query
+	FindMany(ctx context.Context, users []primitive.ObjectID) (map[primitive.ObjectID]*Ban, error)
+	// Lists the bans of the tenant which didn't expire
+	List(ctx context.Context) ([]Ban, error)
+}
+
+// Bans of every tenant are stored in the same collection, with the tenant in their id
+type banStore struct {
+	client   *MongoClient
+	database string
+	tenants  tenant.Config
+}
+
+func NewBanStore(client *MongoClient, database string, tenants tenant.Config) BanStore {
+	return &banStore{
+		client:   client,
+		database: database,
+		tenants:  tenants,
+	}
+}
+
+func (st *banStore) collection() *mongo.Collection {
+	return (*st.client).GetClient().Database(st.database).Collection(BAN_COLLECTION)
+}
+
+// A user only identifies a ban inside its tenant
+func (st *banStore) id(ctx context.Context, user primitive.ObjectID) (string, string, error) {
+	tenantId, err := st.tenants.FromContext(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return tenantId + "/" + user.Hex(), tenantId, nil
+}
+
+// Query matching the bans which didn't expire
+func notExpired(query bson.M, now time.Time) bson.M {
+	query["$or"] = bson.A{
+		bson.M{"expires_at": bson.M{"$exists": false}},
+		bson.M{"expires_at": bson.M{"$gt": now}},
+	}
+	return query
+}
+
+func (st *banStore) EnsureIndexes(ctx context.Context) error {
+	_, err := st.collection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+func (st *banStore) Ban(ctx context.Context, ban Ban) (Ban, error) {
+	id, tenantId, err := st.id(ctx, ban.User)
+	if err != nil {
+		return Ban{}, err
+	}
+	ban.ID = id
+	ban.Tenant = tenantId
+	ban.CreatedAt = time.Now().UTC()
+	_, err = st.collection().ReplaceOne(ctx, bson.M{"_id": id}, ban, options.Replace().SetUpsert(true))
+	return ban, err
+}
+
+func (st *banStore) Unban(ctx context.Context, user primitive.ObjectID) (bool, error) {
+	id, _, err := st.id(ctx, user)
+	if err != nil {
+		return false, err
+	}
+	deleteResult, err := st.collection().DeleteOne(ctx, notExpired(bson.M{"_id": id}, time.Now().UTC()))
+	if err != nil {
+		return false, err
+	}
+	return deleteResult.DeletedCount > 0, nil
+}
+
+// Expired bans may not have been removed yet, so they are checked too
+func (st *banStore) Find(ctx context.Context, user primitive.ObjectID) (*Ban, error) {
+	id, _, err := st.id(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	var ban Ban
+	err = st.collection().FindOne(ctx, notExpired(bson.M{"_id": id}, time.Now().UTC())).Decode(&ban)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+func (st *banStore) FindMany(ctx context.Context, users []primitive.ObjectID) (map[primitive.ObjectID]*Ban, error) {
+	bans := make(map[primitive.ObjectID]*Ban, len(users))
+	if len(users) == 0 {
+		return bans, nil
+	}
+	ids := make([]string, len(users))
+	for i, user := range users {
+		id, _, err := st.id(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	cursor, err := st.collection().Find(ctx, notExpired(bson.M{"_id": bson.M{"$in": ids}}, time.Now().UTC()))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var found []Ban
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	for i := range found {
+		bans[found[i].User] = &found[i]
+	}
+	return bans, nil
+}
+
+func (st *banStore) List(ctx context.Context) ([]Ban, error) {
+	tenantId, err := st.tenants.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// bans without tenant are stored without the field, which null also matches
+	query := bson.M{"tenant": nil}
+	if tenantId != "" {
+		query = bson.M{"tenant": tenantId}
+	}
+	cursor, err := st.collection().Find(ctx, notExpired(query, time.Now().UTC()), options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var bans []Ban
+	if err = cursor.All(ctx, &bans); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// Cache of the bans checked on every vote, shared by every store wrapped with it, so banning
+// through any of them invalidates the entries read by the others
+type BanCache struct {
+	cache  cache.Cache
+	ttl    time.Duration
+	logger *zap.Logger
+}
+
+func NewBanCache(c cache.Cache, ttl time.Duration) *BanCache {
+	return &BanCache{cache: c, ttl: ttl, logger: zap.NewNop()}
+}
+
+// Set the logger of the errors of the cache, which are not returned to the callers
+func (bc *BanCache) SetLogger(logger *zap.Logger) {
+	bc.logger = logger
+}
+
+// Store which reads bans through the cache, including the users who aren't banned, and
+// invalidates them when banning or unbanning. Temporary bans are cached until they expire at most
+type cachedBanStore struct {
+	BanStore
+	cache   *BanCache
+	tenants tenant.Config
+}
+
+func NewCachedBanStore(store BanStore, banCache *BanCache, tenants tenant.Config) BanStore {
+	return &cachedBanStore{
+		BanStore: store,
+		cache:    banCache,
+		tenants:  tenants,
+	}
+}
+
+func banKey(tenantId string, user primitive.ObjectID) string {
+	return "ban/" + tenantId + "/" + user.Hex()
+}
+
+func (st *cachedBanStore) invalidate(ctx context.Context, user primitive.ObjectID) {
+	tenantId, err := st.tenants.FromContext(ctx)
+	if err != nil {
+		return
+	}
+	if err := st.cache.cache.Delete(ctx, banKey(tenantId, user)); err != nil {
+		logging.WithRequest(ctx, st.cache.logger).Error("could not invalidate cache", zap.String("key", banKey(tenantId, user)), zap.Error(err))
+	}
+}
+
+func (st *cachedBanStore) Ban(ctx context.Context, ban Ban) (Ban, error) {
+	ban, err := st.BanStore.Ban(ctx, ban)
+	if err == nil {
+		st.invalidate(ctx, ban.User)
+	}
+	return ban, err
+}
+
+func (st *cachedBanStore) Unban(ctx context.Context, user primitive.ObjectID) (bool, error) {
+	unbanned, err := st.BanStore.Unban(ctx, user)
+	if err == nil {
+		st.invalidate(ctx, user)
+	}
+	return unbanned, err
+}
+
+// Returns the ban cached for the key and whether it was. An empty value means the user isn't banned
+func (st *cachedBanStore) cached(ctx context.Context, key string, now time.Time) (*Ban, bool) {
+	value, ok, err := st.cache.cache.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false
+	}
+	if len(value) == 0 {
+		return nil, true
+	}
+	var ban Ban
+	if bson.Unmarshal(value, &ban) != nil || ban.Expired(now) {
+		return nil, false
+	}
+	return &ban, true
+}
+
+// Caches the ban of the key, nil if the user isn't banned, until the ban expires at most
+func (st *cachedBanStore) store(ctx context.Context, key string, ban *Ban, now time.Time) error {
+	value, ttl := []byte{}, st.cache.ttl
+	if ban != nil {
+		var err error
+		if value, err = bson.Marshal(ban); err != nil {
+			return err
+		}
+		if ban.ExpiresAt != nil && ban.ExpiresAt.Sub(now) < ttl {
+			ttl = ban.ExpiresAt.Sub(now)
+		}
+	}
+	if err := st.cache.cache.Set(ctx, key, value, ttl); err != nil {
+		logging.WithRequest(ctx, st.cache.logger).Warn("could not store in cache", zap.String("key", key), zap.Error(err))
+	}
+	return nil
+}
+
+func (st *cachedBanStore) Find(ctx context.Context, user primitive.ObjectID) (*Ban, error) {
+	tenantId, err := st.tenants.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := banKey(tenantId, user)
+	now := time.Now().UTC()
+	if ban, ok := st.cached(ctx, key, now); ok {
+		return ban, nil
+	}
+	ban, err := st.BanStore.Find(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.store(ctx, key, ban, now); err != nil {
+		return nil, err
+	}
+	return ban, nil
+}
+
+// Only the users missing from the cache are queried, all of them at once
+func (st *cachedBanStore) FindMany(ctx context.Context, users []primitive.ObjectID) (map[primitive.ObjectID]*Ban, error) {
+	tenantId, err := st.tenants.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	bans := make(map[primitive.ObjectID]*Ban, len(users))
+	var missing []primitive.ObjectID
+	for _, user := range users {
+		ban, ok := st.cached(ctx, banKey(tenantId, user), now)
+		if !ok {
+			missing = append(missing, user)
+		} else if ban != nil {
+			bans[user] = ban
+		}
+	}
+	if len(missing) == 0 {
+		return bans, nil
+	}
+	found, err := st.BanStore.FindMany(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range missing {
+		if err := st.store(ctx, banKey(tenantId, user), found[user], now); err != nil {
+			return nil, err
+		}
+		if found[user] != nil {
+			bans[user] = found[user]
+		}
+	}
+	return bans, nil
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrNotExecuted = errors.New("not executed since a previous write of the ordered batch failed")
+
+type UpvoteUpdate struct {
+	ID     primitive.ObjectID
+	Upvote bool
+	// zero to update whatever the version of the vote is
+	ExpectedVersion int64
+}
+
+// Bulk operations return one error for each item, in the same order of the items, nil if the
+// item was written. The last error is returned when the whole operation failed.
+// When ordered, the items after the first one that failed are not written and get ErrNotExecuted
+
+// Inserts the votes in a single BulkWrite. Votes past the quota of the tenant get ErrQuotaExceeded
+func (r *voteRepository) BulkInsert(ctx context.Context, votes []VoteModel, ordered bool) ([]error, error) {
+	collection, filter, tenantId, err := r.writeScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]error, len(votes))
+	if quota := r.tenants.Quota(tenantId); quota > 0 {
+		count, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for i := range votes {
+			if count+int64(i) >= quota {
+				errs[i] = ErrQuotaExceeded
+			}
+		}
+	}
+	now := time.Now().UTC()
+	models := make([]mongo.WriteModel, len(votes))
+	for i, vote := range votes {
+		vote.Tenant = tenantId
+		vote.Version = 1
+		vote.stamp(now)
+		models[i] = mongo.NewInsertOneModel().SetDocument(vote)
+	}
+	_, err = bulkWrite(ctx, collection, models, errs, ordered)
+	return errs, err
+}
+
+// Changes the upvote value of many votes in a single BulkWrite. Votes not found get mongo.ErrNoDocuments
+// and the ones without the expected version get ErrVersionMismatch, also when a concurrent write
+// changed them between the lookup and the BulkWrite. The ids must not repeat
+func (r *voteRepository) BulkUpdateUpvote(ctx context.Context, updates []UpvoteUpdate, ordered bool) ([]error, error) {
+	collection, filter, _, err := r.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(updates))
+	versions := make([]int64, len(updates))
+	for i, update := range updates {
+		ids[i] = update.ID
+		versions[i] = update.ExpectedVersion
+	}
+	before, errs, err := checkVersions(ctx, collection, filter, ids, versions)
+	if err != nil {
+		return nil, err
+	}
+	// stored with the precision of MongoDB, to tell the votes this write changed when read again
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	models := make([]mongo.WriteModel, len(updates))
+	for i, update := range updates {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(versioned(filter, update.ID, update.ExpectedVersion)).
+			SetUpdate(upvoteUpdate(update.Upvote, now))
+	}
+	result, err := bulkWrite(ctx, collection, models, errs, ordered)
+	if err != nil {
+		return nil, err
+	}
+	err = checkMatched(ctx, collection, filter, result, ids, errs, func(i int, after VoteModel) error {
+		switch {
+		case after.DeletedAt != nil:
+			return mongo.ErrNoDocuments
+		// without an expected version only a deleted vote isn't matched
+		case updates[i].ExpectedVersion == 0, after.UpdatedAt != nil && after.UpdatedAt.Equal(now):
+			return nil
+		// the vote already had the value, and nothing wrote it since it was looked up
+		case before[ids[i]].Upvote == updates[i].Upvote && after.Version == before[ids[i]].Version:
+			return nil
+		}
+		return ErrVersionMismatch
+	})
+	return errs, err
+}
+
+// Marks many votes as deleted in a single BulkWrite. Votes not found get mongo.ErrNoDocuments, also
+// when a concurrent write deleted them between the lookup and the BulkWrite. The ids must not repeat
+func (r *voteRepository) BulkSoftDelete(ctx context.Context, ids []primitive.ObjectID, ordered bool) ([]error, error) {
+	collection, filter, _, err := r.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, errs, err := checkVersions(ctx, collection, filter, ids, make([]int64, len(ids)))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	models := make([]mongo.WriteModel, len(ids))
+	for i, id := range ids {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(versioned(filter, id, 0)).
+			SetUpdate(bson.M{
+				"$set": bson.M{"deleted_at": now, "updated_at": now},
+				"$inc": bson.M{"version": 1},
+			})
+	}
+	result, err := bulkWrite(ctx, collection, models, errs, ordered)
+	if err != nil {
+		return nil, err
+	}
+	err = checkMatched(ctx, collection, filter, result, ids, errs, func(i int, after VoteModel) error {
+		if after.DeletedAt != nil && after.DeletedAt.Equal(now) {
+			return nil
+		}
+		return mongo.ErrNoDocuments
+	})
+	return errs, err
+}
+
+// BulkWrite doesn't tell which updates matched, so the votes are looked up before writing.
+// Returns the votes found and mongo.ErrNoDocuments for the ids that don't belong to a vote that
+// wasn't deleted, and ErrVersionMismatch for the votes without the expected version, unless it is zero
+func checkVersions(ctx context.Context, collection *mongo.Collection, filter bson.M, ids []primitive.ObjectID, expectedVersions []int64) (map[primitive.ObjectID]VoteModel, []error, error) {
+	cursor, err := collection.Find(ctx, notDeleted(scoped(filter, bson.M{"_id": bson.M{"$in": ids}})),
+		options.Find().SetProjection(bson.M{"_id": 1, "version": 1, "upvote": 1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	var found []VoteModel
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, nil, err
+	}
+	votes := make(map[primitive.ObjectID]VoteModel, len(found))
+	for _, vote := range found {
+		votes[vote.ID] = vote
+	}
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		vote, ok := votes[id]
+		if !ok {
+			errs[i] = mongo.ErrNoDocuments
+		} else if expectedVersions[i] != 0 && expectedVersions[i] != vote.Version {
+			errs[i] = ErrVersionMismatch
+		}
+	}
+	return votes, errs, nil
+}
+
+// A vote written concurrently after the lookup of checkVersions doesn't match its update anymore.
+// When the BulkWrite matched fewer votes than it wrote, the votes are read again and the ones the
+// write didn't reach get the error of matched, which tells it from the vote read
+func checkMatched(ctx context.Context, collection *mongo.Collection, filter bson.M, result *mongo.BulkWriteResult, ids []primitive.ObjectID, errs []error, matched func(i int, after VoteModel) error) error {
+	var written []primitive.ObjectID
+	var indexes []int
+	for i, err := range errs {
+		if err == nil {
+			written = append(written, ids[i])
+			indexes = append(indexes, i)
+		}
+	}
+	if result == nil || result.MatchedCount >= int64(len(written)) {
+		return nil
+	}
+	cursor, err := collection.Find(ctx, scoped(filter, bson.M{"_id": bson.M{"$in": written}}),
+		options.Find().SetProjection(bson.M{"_id": 1, "version": 1, "deleted_at": 1, "updated_at": 1}))
+	if err != nil {
+		return err
+	}
+	var found []VoteModel
+	if err = cursor.All(ctx, &found); err != nil {
+		return err
+	}
+	votes := make(map[primitive.ObjectID]VoteModel, len(found))
+	for _, vote := range found {
+		votes[vote.ID] = vote
+	}
+	for _, i := range indexes {
+		vote, ok := votes[ids[i]]
+		if !ok {
+			// purged since
+			errs[i] = mongo.ErrNoDocuments
+			continue
+		}
+		errs[i] = matched(i, vote)
+	}
+	return nil
+}
+
+// Writes the models of the items which didn't fail yet, then sets the write errors in errs.
+// Returns the result of the BulkWrite, nil if nothing was written
+func bulkWrite(ctx context.Context, collection *mongo.Collection, models []mongo.WriteModel, errs []error, ordered bool) (*mongo.BulkWriteResult, error) {
+	var writes []mongo.WriteModel
+	var indexes []int
+	for i, model := range models {
+		if errs[i] != nil {
+			if ordered {
+				notExecuted(errs, i+1)
+				break
+			}
+			continue
+		}
+		writes = append(writes, model)
+		indexes = append(indexes, i)
+	}
+	if len(writes) == 0 {
+		return nil, nil
+	}
+	result, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(ordered))
+	if exception, ok := err.(mongo.BulkWriteException); ok && exception.WriteConcernError == nil {
+		for _, writeError := range exception.WriteErrors {
+			index := indexes[writeError.Index]
+			// as a WriteException, which mongo.IsDuplicateKeyError recognizes unlike a WriteError
+			errs[index] = mongo.WriteException{WriteErrors: mongo.WriteErrors{writeError.WriteError}}
+			if ordered {
+				notExecuted(errs, index+1)
+			}
+		}
+		return result, nil
+	}
+	return result, err
+}
+
+func notExecuted(errs []error, from int) {
+	for i := from; i < len(errs); i++ {
+		errs[i] = ErrNotExecuted
+	}
+}
@@ -0,0 +1,328 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/cache"
+	"github.com/IsaqueB/ps-klever/pkg/logging"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	DEFAULT_CACHE_VOTE_TTL  = time.Minute
+	DEFAULT_CACHE_TALLY_TTL = 5 * time.Second
+)
+
+// Hits and misses of the cache of an entity type
+type CacheCounts struct {
+	Hits   uint64
+	Misses uint64
+}
+
+type CacheStats struct {
+	Votes   CacheCounts
+	Tallies CacheCounts
+}
+
+// Cache of votes and tallies shared by every repository wrapped with it, so a write made through
+// any of them invalidates the entries read by the others
+type VoteCache struct {
+	cache    cache.Cache
+	voteTTL  time.Duration
+	tallyTTL time.Duration
+	group    cache.Group
+	stats    CacheStats
+	logger   *zap.Logger
+}
+
+func NewVoteCache(c cache.Cache, voteTTL time.Duration, tallyTTL time.Duration) *VoteCache {
+	return &VoteCache{
+		cache:    c,
+		voteTTL:  voteTTL,
+		tallyTTL: tallyTTL,
+		logger:   zap.NewNop(),
+	}
+}
+
+// Set the logger of the errors of the cache, which are not returned to the callers
+func (vc *VoteCache) SetLogger(logger *zap.Logger) {
+	vc.logger = logger
+}
+
+func (vc *VoteCache) Stats() CacheStats {
+	return CacheStats{
+		Votes: CacheCounts{
+			Hits:   atomic.LoadUint64(&vc.stats.Votes.Hits),
+			Misses: atomic.LoadUint64(&vc.stats.Votes.Misses),
+		},
+		Tallies: CacheCounts{
+			Hits:   atomic.LoadUint64(&vc.stats.Tallies.Hits),
+			Misses: atomic.LoadUint64(&vc.stats.Tallies.Misses),
+		},
+	}
+}
+
+// Repository which reads votes by id and tallies through the cache, and invalidates them on every
+// write. Entries written concurrently with a write may be stale until their TTL passes
+type cachedVoteRepository struct {
+	VoteRepository
+	cache   *VoteCache
+	tenants tenant.Config
+}
+
+func NewCachedVoteRepository(repository VoteRepository, voteCache *VoteCache, tenants tenant.Config) VoteRepository {
+	return &cachedVoteRepository{
+		VoteRepository: repository,
+		cache:          voteCache,
+		tenants:        tenants,
+	}
+}
+
+func voteKey(tenantId string, id primitive.ObjectID) string {
+	return "vote/" + tenantId + "/" + id.Hex()
+}
+
+func tallyKey(tenantId string, video primitive.ObjectID) string {
+	return "tally/" + tenantId + "/" + video.Hex()
+}
+
+// Removes the cached vote and tally of the video of every vote given
+func (r *cachedVoteRepository) invalidate(ctx context.Context, votes []VoteModel) {
+	tenantId, err := r.tenants.FromContext(ctx)
+	if err != nil {
+		return
+	}
+	var keys []string
+	for _, vote := range votes {
+		keys = append(keys, voteKey(tenantId, vote.ID), tallyKey(tenantId, vote.Video))
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := r.cache.cache.Delete(ctx, keys...); err != nil {
+		logging.WithRequest(ctx, r.cache.logger).Error("could not invalidate cache", zap.Strings("keys", keys), zap.Error(err))
+	}
+}
+
+// Invalidates votes known only by id, looking up their videos
+func (r *cachedVoteRepository) invalidateIDs(ctx context.Context, ids []primitive.ObjectID) {
+	votes, err := r.VoteRepository.Find(ctx, VoteFilter{IDs: ids, IncludeDeleted: true})
+	if err != nil {
+		logging.WithRequest(ctx, r.cache.logger).Error("could not find votes to invalidate", zap.Error(err))
+		return
+	}
+	r.invalidate(ctx, votes)
+}
+
+func (r *cachedVoteRepository) Insert(ctx context.Context, vote VoteModel) (primitive.ObjectID, error) {
+	id, err := r.VoteRepository.Insert(ctx, vote)
+	if err == nil {
+		vote.ID = id
+		r.invalidate(ctx, []VoteModel{vote})
+	}
+	return id, err
+}
+
+func (r *cachedVoteRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*VoteModel, error) {
+	tenantId, err := r.tenants.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := voteKey(tenantId, id)
+	var vote VoteModel
+	if value, ok, err := r.cache.cache.Get(ctx, key); err == nil && ok && bson.Unmarshal(value, &vote) == nil {
+		atomic.AddUint64(&r.cache.stats.Votes.Hits, 1)
+		return &vote, nil
+	}
+	atomic.AddUint64(&r.cache.stats.Votes.Misses, 1)
+	values, err := r.cache.group.Do([]string{key}, func(keys []string) (map[string][]byte, error) {
+		found, err := r.VoteRepository.FindByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		value, err := bson.Marshal(found)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.cache.cache.Set(ctx, key, value, r.cache.voteTTL); err != nil {
+			logging.WithRequest(ctx, r.cache.logger).Warn("could not store in cache", zap.String("key", key), zap.Error(err))
+		}
+		return map[string][]byte{key: value}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := bson.Unmarshal(values[key], &vote); err != nil {
+		return nil, err
+	}
+	return &vote, nil
+}
+
+func (r *cachedVoteRepository) UpdateUpvote(ctx context.Context, id primitive.ObjectID, upvote bool, expectedVersion int64) (*VoteModel, bool, error) {
+	vote, modified, err := r.VoteRepository.UpdateUpvote(ctx, id, upvote, expectedVersion)
+	if err == nil && modified {
+		r.invalidate(ctx, []VoteModel{*vote})
+	}
+	return vote, modified, err
+}
+
+func (r *cachedVoteRepository) SoftDelete(ctx context.Context, id primitive.ObjectID, expectedVersion int64) (int64, error) {
+	deleted, err := r.VoteRepository.SoftDelete(ctx, id, expectedVersion)
+	if err == nil && deleted > 0 {
+		r.invalidateIDs(ctx, []primitive.ObjectID{id})
+	}
+	return deleted, err
+}
+
+func (r *cachedVoteRepository) Restore(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	restored, err := r.VoteRepository.Restore(ctx, id)
+	if err == nil && restored > 0 {
+		r.invalidateIDs(ctx, []primitive.ObjectID{id})
+	}
+	return restored, err
+}
+
+func (r *cachedVoteRepository) BulkInsert(ctx context.Context, votes []VoteModel, ordered bool) ([]error, error) {
+	errs, err := r.VoteRepository.BulkInsert(ctx, votes, ordered)
+	if err == nil {
+		r.invalidate(ctx, votes)
+	}
+	return errs, err
+}
+
+func (r *cachedVoteRepository) BulkUpdateUpvote(ctx context.Context, updates []UpvoteUpdate, ordered bool) ([]error, error) {
+	errs, err := r.VoteRepository.BulkUpdateUpvote(ctx, updates, ordered)
+	if err == nil {
+		ids := make([]primitive.ObjectID, len(updates))
+		for i, update := range updates {
+			ids[i] = update.ID
+		}
+		r.invalidateIDs(ctx, ids)
+	}
+	return errs, err
+}
+
+func (r *cachedVoteRepository) BulkSoftDelete(ctx context.Context, ids []primitive.ObjectID, ordered bool) ([]error, error) {
+	errs, err := r.VoteRepository.BulkSoftDelete(ctx, ids, ordered)
+	if err == nil {
+		r.invalidateIDs(ctx, ids)
+	}
+	return errs, err
+}
+
+func (r *cachedVoteRepository) BulkImport(ctx context.Context, votes []VoteModel, dryRun bool) ([]ImportAction, []error, error) {
+	actions, errs, err := r.VoteRepository.BulkImport(ctx, votes, dryRun)
+	if err == nil && !dryRun {
+		var changed []VoteModel
+		for i, action := range actions {
+			if action != IMPORT_UNCHANGED {
+				changed = append(changed, votes[i])
+			}
+		}
+		r.invalidate(ctx, changed)
+	}
+	return actions, errs, err
+}
+
+func (r *cachedVoteRepository) CastVote(ctx context.Context, video primitive.ObjectID, user primitive.ObjectID, direction Direction) (*VoteModel, CastAction, error) {
+	vote, action, err := r.VoteRepository.CastVote(ctx, video, user, direction)
+	if err == nil && action != CAST_UNCHANGED {
+		r.invalidate(ctx, []VoteModel{*vote})
+	}
+	return vote, action, err
+}
+
+func (r *cachedVoteRepository) BulkCastVote(ctx context.Context, casts []Cast) ([]primitive.ObjectID, []error, error) {
+	ids, errs, err := r.VoteRepository.BulkCastVote(ctx, casts)
+	if err == nil {
+		var changed []VoteModel
+		for i, id := range ids {
+			if !id.IsZero() {
+				changed = append(changed, VoteModel{ID: id, Video: casts[i].Video})
+			}
+		}
+		r.invalidate(ctx, changed)
+	}
+	return ids, errs, err
+}
+
+func (r *cachedVoteRepository) Moderate(ctx context.Context, ids []primitive.ObjectID, action ModerationAction) (int64, error) {
+	modified, err := r.VoteRepository.Moderate(ctx, ids, action)
+	if err == nil && modified > 0 {
+		r.invalidateIDs(ctx, ids)
+	}
+	return modified, err
+}
+
+func (r *cachedVoteRepository) Tally(ctx context.Context, video primitive.ObjectID) (Tally, error) {
+	tallies, err := r.Tallies(ctx, []primitive.ObjectID{video})
+	if err != nil {
+		return Tally{}, err
+	}
+	return tallies[video], nil
+}
+
+// Reads the tallies cached and counts the others in a single aggregation. Videos already being
+// counted by a concurrent request are waited for instead of counted again
+func (r *cachedVoteRepository) Tallies(ctx context.Context, videos []primitive.ObjectID) (map[primitive.ObjectID]Tally, error) {
+	tenantId, err := r.tenants.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tallies := make(map[primitive.ObjectID]Tally, len(videos))
+	var missing []string
+	missingVideos := make(map[string]primitive.ObjectID)
+	for _, video := range videos {
+		key := tallyKey(tenantId, video)
+		var tally Tally
+		if value, ok, err := r.cache.cache.Get(ctx, key); err == nil && ok && bson.Unmarshal(value, &tally) == nil {
+			atomic.AddUint64(&r.cache.stats.Tallies.Hits, 1)
+			tallies[video] = tally
+			continue
+		}
+		atomic.AddUint64(&r.cache.stats.Tallies.Misses, 1)
+		missing = append(missing, key)
+		missingVideos[key] = video
+	}
+	if len(missing) == 0 {
+		return tallies, nil
+	}
+	values, err := r.cache.group.Do(missing, func(keys []string) (map[string][]byte, error) {
+		ids := make([]primitive.ObjectID, len(keys))
+		for i, key := range keys {
+			ids[i] = missingVideos[key]
+		}
+		counted, err := r.VoteRepository.Tallies(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			value, err := bson.Marshal(counted[missingVideos[key]])
+			if err != nil {
+				return nil, err
+			}
+			if err := r.cache.cache.Set(ctx, key, value, r.cache.tallyTTL); err != nil {
+				logging.WithRequest(ctx, r.cache.logger).Warn("could not store in cache", zap.String("key", key), zap.Error(err))
+			}
+			values[key] = value
+		}
+		return values, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range missing {
+		var tally Tally
+		if err := bson.Unmarshal(values[key], &tally); err != nil {
+			return nil, err
+		}
+		tallies[missingVideos[key]] = tally
+	}
+	return tallies, nil
+}
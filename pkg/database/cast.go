@@ -0,0 +1,251 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// State of the vote of an user on a video
+type Direction int
+
+const (
+	DIRECTION_NONE Direction = iota
+	DIRECTION_UP
+	DIRECTION_DOWN
+)
+
+// What casting a vote did to the vote stored
+type CastAction int
+
+const (
+	CAST_UNCHANGED CastAction = iota
+	CAST_INSERTED
+	CAST_FLIPPED
+	CAST_RETRACTED
+)
+
+// times a cast is retried when a concurrent cast on the same video and user wins the race
+const castRetries = 3
+
+// Id of the vote created by casting, the same for every cast of the user on the video. Concurrent
+// casts creating the vote then write the same document instead of inserting two votes
+func castID(tenantId string, video primitive.ObjectID, user primitive.ObjectID) primitive.ObjectID {
+	hash := sha256.New()
+	hash.Write([]byte(tenantId))
+	hash.Write(video[:])
+	hash.Write(user[:])
+	var id primitive.ObjectID
+	copy(id[:], hash.Sum(nil))
+	return id
+}
+
+// Sets the vote of the user on the video to direction in a single write: inserting it if there is
+// none, flipping its value or retracting it with DIRECTION_NONE, which soft deletes it. Returns
+// the vote after casting, nil if the user has no vote on the video, and what was done to it
+func (r *voteRepository) CastVote(ctx context.Context, video primitive.ObjectID, user primitive.ObjectID, direction Direction) (*VoteModel, CastAction, error) {
+	collection, filter, tenantId, err := r.writeScope(ctx)
+	if err != nil {
+		return nil, CAST_UNCHANGED, err
+	}
+	current := notDeleted(scoped(filter, bson.M{"video": video, "user": user}))
+	before := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	for retry := 0; ; retry++ {
+		var vote VoteModel
+		now := time.Now().UTC()
+		if direction == DIRECTION_NONE {
+			err = collection.FindOneAndUpdate(ctx, current, bson.M{
+				"$set": bson.M{"deleted_at": now, "updated_at": now},
+				"$inc": bson.M{"version": 1},
+			}, before).Decode(&vote)
+			if err == mongo.ErrNoDocuments {
+				return nil, CAST_UNCHANGED, nil
+			}
+			if err != nil {
+				return nil, CAST_UNCHANGED, err
+			}
+			vote.DeletedAt = &now
+			vote.UpdatedAt = &now
+			vote.Version++
+			return &vote, CAST_RETRACTED, nil
+		}
+		upvote := direction == DIRECTION_UP
+		err = collection.FindOneAndUpdate(ctx, current, upvoteUpdate(upvote, now), before).Decode(&vote)
+		if err == nil {
+			if vote.Upvote == upvote {
+				return &vote, CAST_UNCHANGED, nil
+			}
+			vote.Upvote = upvote
+			vote.UpdatedAt = &now
+			vote.Version++
+			return &vote, CAST_FLIPPED, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, CAST_UNCHANGED, err
+		}
+		// there is no vote, so it is created with the id of the casts of the user, reusing the
+		// document if a previous cast was retracted
+		if err = r.checkQuota(ctx, collection, filter, tenantId); err != nil {
+			return nil, CAST_UNCHANGED, err
+		}
+		id := castID(tenantId, video, user)
+		err = collection.FindOneAndUpdate(ctx, castInsertFilter(filter, id), castInsert(tenantId, video, user, upvote, now),
+			options.FindOneAndUpdate().SetReturnDocument(options.Before).SetUpsert(true)).Decode(&vote)
+		if err == mongo.ErrNoDocuments {
+			return &VoteModel{ID: id, Video: video, User: user, Upvote: upvote, Tenant: tenantId, Version: 1, CreatedAt: &now, UpdatedAt: &now}, CAST_INSERTED, nil
+		}
+		if err == nil {
+			vote.Upvote = upvote
+			vote.DeletedAt = nil
+			vote.InvalidatedAt = nil
+			vote.CreatedAt = &now
+			vote.UpdatedAt = &now
+			vote.Version++
+			return &vote, CAST_INSERTED, nil
+		}
+		// a concurrent cast created the vote first, so it is cast again over that vote
+		if !mongo.IsDuplicateKeyError(err) || retry == castRetries {
+			return nil, CAST_UNCHANGED, err
+		}
+	}
+}
+
+// Matches the vote created by the casts of an user only if it was retracted, so upserting it
+// either reuses the document or fails with a duplicate key if the user has a vote
+func castInsertFilter(filter bson.M, id primitive.ObjectID) bson.M {
+	return scoped(filter, bson.M{"_id": id, "deleted_at": bson.M{"$exists": true}})
+}
+
+// Writes the vote created by a cast over the document of the previous casts, if any
+func castInsert(tenantId string, video primitive.ObjectID, user primitive.ObjectID, upvote bool, now time.Time) mongo.Pipeline {
+	var tenantValue interface{} = "$$REMOVE"
+	if tenantId != "" {
+		tenantValue = tenantId
+	}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "video", Value: video},
+		{Key: "user", Value: user},
+		{Key: "upvote", Value: upvote},
+		{Key: "tenant", Value: tenantValue},
+		{Key: "deleted_at", Value: "$$REMOVE"},
+		{Key: "invalidated_at", Value: "$$REMOVE"},
+		{Key: "created_at", Value: now},
+		{Key: "updated_at", Value: now},
+		{Key: "version", Value: bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}}},
+	}}}}
+}
+
+// Vote of an user on a video to cast in bulk
+type Cast struct {
+	Video     primitive.ObjectID
+	User      primitive.ObjectID
+	Direction Direction
+}
+
+// Casts many votes in a single BulkWrite, each like CastVote. Returns the id of the vote of each
+// cast, nil if the user has no vote on the video, and the errors of the casts. Creating votes past
+// the quota of the tenant fails with ErrQuotaExceeded. The casts which created a vote while
+// another one was created concurrently are cast again
+func (r *voteRepository) BulkCastVote(ctx context.Context, casts []Cast) ([]primitive.ObjectID, []error, error) {
+	collection, filter, tenantId, err := r.writeScope(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]primitive.ObjectID, len(casts))
+	errs := make([]error, len(casts))
+	pending := make([]int, len(casts))
+	for i := range casts {
+		pending[i] = i
+	}
+	for retry := 0; len(pending) > 0 && retry <= castRetries; retry++ {
+		if pending, err = r.bulkCast(ctx, collection, filter, tenantId, casts, pending, ids, errs); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ids, errs, nil
+}
+
+// Writes the casts of the indexes given, setting their ids and errors. BulkWrite doesn't tell which
+// updates matched, so the votes are looked up before writing. Returns the indexes of the casts
+// which lost the race to create a vote
+func (r *voteRepository) bulkCast(ctx context.Context, collection *mongo.Collection, filter bson.M, tenantId string, casts []Cast, indexes []int, ids []primitive.ObjectID, errs []error) ([]int, error) {
+	keys := make(bson.A, len(indexes))
+	for i, index := range indexes {
+		keys[i] = bson.M{"video": casts[index].Video, "user": casts[index].User}
+	}
+	cursor, err := collection.Find(ctx, notDeleted(scoped(filter, bson.M{"$or": keys})),
+		options.Find().SetProjection(bson.M{"_id": 1, "video": 1, "user": 1, "upvote": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var found []VoteModel
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	current := make(map[[2]primitive.ObjectID]VoteModel, len(found))
+	for _, vote := range found {
+		current[[2]primitive.ObjectID{vote.Video, vote.User}] = vote
+	}
+	var count int64
+	quota := r.tenants.Quota(tenantId)
+	if quota > 0 {
+		if count, err = collection.CountDocuments(ctx, filter); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now().UTC()
+	var models []mongo.WriteModel
+	var written []int
+	var inserts []bool
+	for _, index := range indexes {
+		cast := casts[index]
+		ids[index], errs[index] = primitive.NilObjectID, nil
+		vote, ok := current[[2]primitive.ObjectID{cast.Video, cast.User}]
+		upvote := cast.Direction == DIRECTION_UP
+		var model mongo.WriteModel
+		switch {
+		case ok && cast.Direction == DIRECTION_NONE:
+			model = mongo.NewUpdateOneModel().SetFilter(versioned(filter, vote.ID, 0)).SetUpdate(bson.M{
+				"$set": bson.M{"deleted_at": now, "updated_at": now},
+				"$inc": bson.M{"version": 1},
+			})
+		case ok && vote.Upvote != upvote:
+			model = mongo.NewUpdateOneModel().SetFilter(versioned(filter, vote.ID, 0)).SetUpdate(upvoteUpdate(upvote, now))
+		case !ok && cast.Direction != DIRECTION_NONE:
+			if quota > 0 && count >= quota {
+				errs[index] = ErrQuotaExceeded
+				continue
+			}
+			count++
+			vote.ID = castID(tenantId, cast.Video, cast.User)
+			model = mongo.NewUpdateOneModel().SetFilter(castInsertFilter(filter, vote.ID)).
+				SetUpdate(castInsert(tenantId, cast.Video, cast.User, upvote, now)).SetUpsert(true)
+		}
+		ids[index] = vote.ID
+		if model != nil {
+			models = append(models, model)
+			written = append(written, index)
+			inserts = append(inserts, !ok)
+		}
+	}
+	writeErrs := make([]error, len(models))
+	if _, err = bulkWrite(ctx, collection, models, writeErrs, false); err != nil {
+		return nil, err
+	}
+	var raced []int
+	for i, index := range written {
+		if writeErrs[i] == nil {
+			continue
+		}
+		ids[index], errs[index] = primitive.NilObjectID, writeErrs[i]
+		if inserts[i] && mongo.IsDuplicateKeyError(writeErrs[i]) {
+			raced = append(raced, index)
+		}
+	}
+	return raced, nil
+}
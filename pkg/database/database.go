@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -16,16 +17,39 @@ type VoteModel struct {
 	Video  primitive.ObjectID `json:"video" bson:"video"`
 	User   primitive.ObjectID `json:"user" bson:"user"`
 	Upvote bool               `json:"upvote" bson:"upvote"`
+	// Tenant which owns the vote. Empty for votes stored without tenant
+	Tenant string `json:"tenant,omitempty" bson:"tenant,omitempty"`
+	// Incremented on every write, for optimistic concurrency. Zero for votes written before versions existed and not migrated yet
+	Version int64 `json:"version,omitempty" bson:"version,omitempty"`
+	// Tombstone set when the vote is deleted. Deleted votes are hidden from reads until purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	// Set when the vote is invalidated by a moderator. Invalidated votes can be read, but aren't counted in tallies
+	InvalidatedAt *time.Time `json:"invalidated_at,omitempty" bson:"invalidated_at,omitempty"`
+	// Set on every write. Votes written before timestamps existed get them from a migration
+	CreatedAt *time.Time `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+}
+
+// Sets the timestamps of a vote being inserted, keeping the creation time it already has
+func (vote *VoteModel) stamp(now time.Time) {
+	if vote.CreatedAt == nil {
+		vote.CreatedAt = &now
+	}
+	vote.UpdatedAt = &now
 }
 
 type MongoClient interface {
 	Connect() error
 	Disconnect()
 	GetClient() *mongo.Client
+	SetMonitors(command *event.CommandMonitor, pool *event.PoolMonitor)
 }
 type mongoClient struct {
 	client *mongo.Client
 	ctx    *context.Context
+	// monitors of the driver, used on Connect
+	commandMonitor *event.CommandMonitor
+	poolMonitor    *event.PoolMonitor
 }
 
 func NewMongoClient() MongoClient {
@@ -34,7 +58,14 @@ func NewMongoClient() MongoClient {
 
 func (mc *mongoClient) Connect() error {
 	url := fmt.Sprintf("mongodb+srv://%s:%s@cluster0.kh2zb.mongodb.net/myFirstDatabase?retryWrites=true&w=majority", os.Getenv("DB_USR"), os.Getenv("DB_PWD"))
-	client, err := mongo.NewClient(options.Client().ApplyURI(url))
+	opts := options.Client().ApplyURI(url)
+	if mc.commandMonitor != nil {
+		opts.SetMonitor(mc.commandMonitor)
+	}
+	if mc.poolMonitor != nil {
+		opts.SetPoolMonitor(mc.poolMonitor)
+	}
+	client, err := mongo.NewClient(opts)
 	if err != nil {
 		return err
 	}
@@ -58,3 +89,36 @@ func (mc *mongoClient) Disconnect() {
 func (mc *mongoClient) GetClient() *mongo.Client {
 	return mc.client
 }
+
+// Monitor which notifies every monitor given of each command, since the client takes a single one
+func CombineCommandMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, monitor := range monitors {
+				if monitor.Started != nil {
+					monitor.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, monitor := range monitors {
+				if monitor.Succeeded != nil {
+					monitor.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, monitor := range monitors {
+				if monitor.Failed != nil {
+					monitor.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+// Set the monitors notified of the commands and connections of the client, before connecting
+func (mc *mongoClient) SetMonitors(command *event.CommandMonitor, pool *event.PoolMonitor) {
+	mc.commandMonitor = command
+	mc.poolMonitor = pool
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/auth"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const IDEMPOTENCY_COLLECTION = "idempotency"
+
+// Response stored for an idempotency key. While the first request is running, Done is false
+type IdempotencyRecord struct {
+	// tenant, caller and key sent by the caller
+	ID string `bson:"_id"`
+	// hash of the request, to tell replays from other requests using the same key
+	Hash      string    `bson:"hash"`
+	Done      bool      `bson:"done"`
+	Response  []byte    `bson:"response,omitempty"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+type IdempotencyStore interface {
+	// Creates the index which removes the records once they expire
+	EnsureIndexes(ctx context.Context) error
+	// Reserves the key for a request until timeout. Returns nil if it was reserved, or else the
+	// record already stored with the key
+	Reserve(ctx context.Context, key string, hash string, timeout time.Duration) (*IdempotencyRecord, error)
+	// Stores the response of the request which reserved the key, to be replayed until ttl
+	Complete(ctx context.Context, key string, response []byte, ttl time.Duration) error
+	// Releases the key, so the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// Records of every tenant are stored in the same collection, with the tenant in their id
+type idempotencyStore struct {
+	client   *MongoClient
+	database string
+	tenants  tenant.Config
+}
+
+func NewIdempotencyStore(client *MongoClient, database string, tenants tenant.Config) IdempotencyStore {
+	return &idempotencyStore{
+		client:   client,
+		database: database,
+		tenants:  tenants,
+	}
+}
+
+func (st *idempotencyStore) collection() *mongo.Collection {
+	return (*st.client).GetClient().Database(st.database).Collection(IDEMPOTENCY_COLLECTION)
+}
+
+// The key sent by the caller only identifies a request of the same caller inside its tenant, so
+// callers can't replay each other's responses. Calls without a token share the same caller
+func (st *idempotencyStore) id(ctx context.Context, key string) (string, error) {
+	tenantId, err := st.tenants.FromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	identity, _ := auth.FromContext(ctx)
+	return tenantId + "/" + url.PathEscape(identity.Subject) + "/" + key, nil
+}
+
+func (st *idempotencyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := st.collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (st *idempotencyStore) Reserve(ctx context.Context, key string, hash string, timeout time.Duration) (*IdempotencyRecord, error) {
+	id, err := st.id(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	record := IdempotencyRecord{ID: id, Hash: hash, ExpiresAt: now.Add(timeout)}
+	_, err = st.collection().InsertOne(ctx, record)
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+	var existing IdempotencyRecord
+	if err = st.collection().FindOne(ctx, bson.M{"_id": id}).Decode(&existing); err != nil {
+		return nil, err
+	}
+	if existing.ExpiresAt.After(now) {
+		return &existing, nil
+	}
+	// expired records may not have been removed yet, they are taken over only if no one else did
+	updateResult, err := st.collection().ReplaceOne(ctx, bson.M{"_id": id, "expires_at": existing.ExpiresAt}, record)
+	if err != nil {
+		return nil, err
+	}
+	if updateResult.ModifiedCount == 0 {
+		return st.Reserve(ctx, key, hash, timeout)
+	}
+	return nil, nil
+}
+
+func (st *idempotencyStore) Complete(ctx context.Context, key string, response []byte, ttl time.Duration) error {
+	id, err := st.id(ctx, key)
+	if err != nil {
+		return err
+	}
+	_, err = st.collection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"done":       true,
+		"response":   response,
+		"expires_at": time.Now().UTC().Add(ttl),
+	}})
+	return err
+}
+
+func (st *idempotencyStore) Release(ctx context.Context, key string) error {
+	id, err := st.id(ctx, key)
+	if err != nil {
+		return err
+	}
+	_, err = st.collection().DeleteOne(ctx, bson.M{"_id": id, "done": false})
+	return err
+}
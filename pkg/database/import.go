@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// What importing a vote did to the vote of the user on the video, or would do on a dry run
+type ImportAction int
+
+const (
+	IMPORT_UNCHANGED ImportAction = iota
+	IMPORT_INSERTED
+	IMPORT_UPDATED
+)
+
+type importKey struct {
+	video primitive.ObjectID
+	user  primitive.ObjectID
+}
+
+// Imports votes identified by their video and user, keeping one vote per user on a video: the
+// vote is inserted when the user has none on the video, its value is updated when it differs and
+// it is left unchanged otherwise, so importing the same votes again changes nothing.
+// The votes must not repeat a video and user. The ID of each vote is set to the one of the vote
+// stored. With dryRun nothing is written, and the actions returned are the ones that would be done.
+// Returns the action and the error of each vote, in the same order of the votes
+func (r *voteRepository) BulkImport(ctx context.Context, votes []VoteModel, dryRun bool) ([]ImportAction, []error, error) {
+	collection, filter, _, err := r.scope(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	videos := make([]primitive.ObjectID, len(votes))
+	users := make([]primitive.ObjectID, len(votes))
+	for i, vote := range votes {
+		videos[i] = vote.Video
+		users[i] = vote.User
+	}
+	// may also find votes of other pairs of the videos and users, which are ignored
+	cursor, err := collection.Find(ctx,
+		notDeleted(scoped(filter, bson.M{"video": bson.M{"$in": videos}, "user": bson.M{"$in": users}})),
+		options.Find().SetProjection(bson.M{"_id": 1, "video": 1, "user": 1, "upvote": 1, "version": 1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	var found []VoteModel
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, nil, err
+	}
+	stored := make(map[importKey]VoteModel, len(found))
+	for _, vote := range found {
+		stored[importKey{vote.Video, vote.User}] = vote
+	}
+	actions := make([]ImportAction, len(votes))
+	errs := make([]error, len(votes))
+	var inserts []VoteModel
+	var updates []UpvoteUpdate
+	var insertIndexes, updateIndexes []int
+	for i := range votes {
+		current, ok := stored[importKey{votes[i].Video, votes[i].User}]
+		if !ok {
+			if votes[i].ID.IsZero() {
+				votes[i].ID = primitive.NewObjectID()
+			}
+			actions[i] = IMPORT_INSERTED
+			inserts = append(inserts, votes[i])
+			insertIndexes = append(insertIndexes, i)
+			continue
+		}
+		votes[i].ID = current.ID
+		if current.Upvote != votes[i].Upvote {
+			actions[i] = IMPORT_UPDATED
+			updates = append(updates, UpvoteUpdate{ID: current.ID, Upvote: votes[i].Upvote, ExpectedVersion: current.Version})
+			updateIndexes = append(updateIndexes, i)
+		}
+	}
+	if dryRun {
+		return actions, errs, nil
+	}
+	if len(inserts) > 0 {
+		written, err := r.BulkInsert(ctx, inserts, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		for j, err := range written {
+			errs[insertIndexes[j]] = err
+		}
+	}
+	if len(updates) > 0 {
+		written, err := r.BulkUpdateUpvote(ctx, updates, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		for j, err := range written {
+			errs[updateIndexes[j]] = err
+		}
+	}
+	return actions, errs, nil
+}
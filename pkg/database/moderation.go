@@ -0,0 +1,316 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MODERATION_JOB_COLLECTION = "moderation_job"
+	AUDIT_COLLECTION          = "audit"
+)
+
+// What moderating does to the votes matched
+type ModerationAction int
+
+const (
+	// Soft deletes the votes, so they can be restored until purged
+	MODERATION_DELETE ModerationAction = iota
+	// Keeps the votes, which stop being counted in tallies
+	MODERATION_INVALIDATE
+)
+
+type JobStatus int
+
+const (
+	JOB_PENDING JobStatus = iota
+	JOB_RUNNING
+	JOB_DONE
+	JOB_FAILED
+)
+
+// Votes targeted by a moderation, stored with its job and audit entry. Nil fields match every vote
+type ModerationFilter struct {
+	Video  *primitive.ObjectID `bson:"video,omitempty"`
+	User   *primitive.ObjectID `bson:"user,omitempty"`
+	Upvote *bool               `bson:"upvote,omitempty"`
+	// votes created from CreatedFrom, inclusive, until CreatedTo, exclusive
+	CreatedFrom *time.Time `bson:"created_from,omitempty"`
+	CreatedTo   *time.Time `bson:"created_to,omitempty"`
+}
+
+func (f ModerationFilter) Empty() bool {
+	return f == ModerationFilter{}
+}
+
+func (f ModerationFilter) VoteFilter() VoteFilter {
+	return VoteFilter{Video: f.Video, User: f.User, Upvote: f.Upvote, CreatedFrom: f.CreatedFrom, CreatedTo: f.CreatedTo}
+}
+
+// Moderation run in the background by the server holding its lease, which is renewed while it
+// runs. Jobs whose lease expired are resumed by another server
+type ModerationJob struct {
+	ID     primitive.ObjectID `bson:"_id"`
+	Tenant string             `bson:"tenant,omitempty"`
+	Action ModerationAction   `bson:"action"`
+	Filter ModerationFilter   `bson:"filter"`
+	Actor  string             `bson:"actor"`
+	Reason string             `bson:"reason,omitempty"`
+	Status JobStatus          `bson:"status"`
+	// votes matched when the job was created
+	Matched int64 `bson:"matched"`
+	// votes moderated so far
+	Modified   int64      `bson:"modified"`
+	Error      string     `bson:"error,omitempty"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	UpdatedAt  time.Time  `bson:"updated_at"`
+	FinishedAt *time.Time `bson:"finished_at,omitempty"`
+	// server running the job, until the lease expires
+	Owner          string     `bson:"owner,omitempty"`
+	LeaseExpiresAt *time.Time `bson:"lease_expires_at,omitempty"`
+}
+
+// Record of an action taken through the Admin service
+type AuditEntry struct {
+	ID     primitive.ObjectID `bson:"_id"`
+	Tenant string             `bson:"tenant,omitempty"`
+	Actor  string             `bson:"actor"`
+	// such as "delete_votes"
+	Action   string              `bson:"action"`
+	Reason   string              `bson:"reason,omitempty"`
+	Filter   ModerationFilter    `bson:"filter"`
+	DryRun   bool                `bson:"dry_run,omitempty"`
+	Matched  int64               `bson:"matched"`
+	Modified int64               `bson:"modified"`
+	Job      *primitive.ObjectID `bson:"job,omitempty"`
+	// time the action was taken
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// Filter used to list audit entries. Empty fields are not used in the query
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Limit  int64
+}
+
+type ModerationStore interface {
+	// Creates the indexes listing the audit entries of a tenant, newest first, and the jobs to resume
+	EnsureIndexes(ctx context.Context) error
+	// Stores a new job, setting its id, tenant and times
+	CreateJob(ctx context.Context, job *ModerationJob) error
+	// Stores the status and progress of a job, unless another owner took it
+	UpdateJob(ctx context.Context, job *ModerationJob) error
+	// Takes a pending or running job of any tenant whose lease expired, as the server running it
+	// stopped, holding it for owner during the lease. Returns mongo.ErrNoDocuments if there is none
+	ClaimJob(ctx context.Context, owner string, lease time.Duration) (*ModerationJob, error)
+	// Extends the lease of the job held by owner. Returns mongo.ErrNoDocuments if another owner took it
+	RenewJob(ctx context.Context, id primitive.ObjectID, owner string, lease time.Duration) error
+	// Returns mongo.ErrNoDocuments if the tenant has no job with the id
+	FindJob(ctx context.Context, id primitive.ObjectID) (*ModerationJob, error)
+	// Stores an entry, setting its id, tenant and time
+	Audit(ctx context.Context, entry AuditEntry) error
+	// Lists the entries of the tenant matching the filter, newest first
+	ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+}
+
+// Jobs and audit entries of every tenant are stored in the same collections, with their tenant
+type moderationStore struct {
+	client   *MongoClient
+	database string
+	tenants  tenant.Config
+}
+
+func NewModerationStore(client *MongoClient, database string, tenants tenant.Config) ModerationStore {
+	return &moderationStore{
+		client:   client,
+		database: database,
+		tenants:  tenants,
+	}
+}
+
+func (st *moderationStore) collection(name string) *mongo.Collection {
+	return (*st.client).GetClient().Database(st.database).Collection(name)
+}
+
+// Returns the tenant of the context and the filter matching its documents
+func (st *moderationStore) scope(ctx context.Context) (string, bson.M, error) {
+	tenantId, err := st.tenants.FromContext(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	// documents without tenant are stored without the field, which null also matches
+	filter := bson.M{"tenant": nil}
+	if tenantId != "" {
+		filter = bson.M{"tenant": tenantId}
+	}
+	return tenantId, filter, nil
+}
+
+func (st *moderationStore) EnsureIndexes(ctx context.Context) error {
+	_, err := st.collection(AUDIT_COLLECTION).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = st.collection(MODERATION_JOB_COLLECTION).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "lease_expires_at", Value: 1}},
+	})
+	return err
+}
+
+func (st *moderationStore) CreateJob(ctx context.Context, job *ModerationJob) error {
+	tenantId, _, err := st.scope(ctx)
+	if err != nil {
+		return err
+	}
+	job.ID = primitive.NewObjectID()
+	job.Tenant = tenantId
+	job.CreatedAt = time.Now().UTC()
+	job.UpdatedAt = job.CreatedAt
+	_, err = st.collection(MODERATION_JOB_COLLECTION).InsertOne(ctx, job)
+	return err
+}
+
+func (st *moderationStore) UpdateJob(ctx context.Context, job *ModerationJob) error {
+	_, filter, err := st.scope(ctx)
+	if err != nil {
+		return err
+	}
+	job.UpdatedAt = time.Now().UTC()
+	query := scoped(filter, bson.M{"_id": job.ID})
+	if job.Owner != "" {
+		query["owner"] = job.Owner
+	}
+	_, err = st.collection(MODERATION_JOB_COLLECTION).UpdateOne(ctx, query, bson.M{"$set": bson.M{
+		"status":      job.Status,
+		"modified":    job.Modified,
+		"error":       job.Error,
+		"updated_at":  job.UpdatedAt,
+		"finished_at": job.FinishedAt,
+	}})
+	return err
+}
+
+func (st *moderationStore) ClaimJob(ctx context.Context, owner string, lease time.Duration) (*ModerationJob, error) {
+	now := time.Now().UTC()
+	// jobs created before leases existed have none, so they are resumed too
+	query := bson.M{
+		"status": bson.M{"$in": []JobStatus{JOB_PENDING, JOB_RUNNING}},
+		"$or": []bson.M{
+			{"lease_expires_at": bson.M{"$exists": false}},
+			{"lease_expires_at": bson.M{"$lt": now}},
+		},
+	}
+	var job ModerationJob
+	err := st.collection(MODERATION_JOB_COLLECTION).FindOneAndUpdate(ctx, query,
+		bson.M{"$set": bson.M{"owner": owner, "lease_expires_at": now.Add(lease), "updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (st *moderationStore) RenewJob(ctx context.Context, id primitive.ObjectID, owner string, lease time.Duration) error {
+	updateResult, err := st.collection(MODERATION_JOB_COLLECTION).UpdateOne(ctx, bson.M{"_id": id, "owner": owner},
+		bson.M{"$set": bson.M{"lease_expires_at": time.Now().UTC().Add(lease)}})
+	if err != nil {
+		return err
+	}
+	if updateResult.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (st *moderationStore) FindJob(ctx context.Context, id primitive.ObjectID) (*ModerationJob, error) {
+	_, filter, err := st.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var job ModerationJob
+	if err := st.collection(MODERATION_JOB_COLLECTION).FindOne(ctx, scoped(filter, bson.M{"_id": id})).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (st *moderationStore) Audit(ctx context.Context, entry AuditEntry) error {
+	tenantId, _, err := st.scope(ctx)
+	if err != nil {
+		return err
+	}
+	entry.ID = primitive.NewObjectID()
+	entry.Tenant = tenantId
+	entry.CreatedAt = time.Now().UTC()
+	_, err = st.collection(AUDIT_COLLECTION).InsertOne(ctx, entry)
+	return err
+}
+
+func (st *moderationStore) ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	_, query, err := st.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Actor != "" {
+		query["actor"] = filter.Actor
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+	cursor, err := st.collection(AUDIT_COLLECTION).Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var entries []AuditEntry
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Counts the votes matching the filter
+func (r *voteRepository) Count(ctx context.Context, filter VoteFilter) (int64, error) {
+	collection, query, _, err := r.scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return collection.CountDocuments(ctx, filter.query(query))
+}
+
+// Deletes or invalidates the votes with the ids given which weren't deleted, skipping those
+// already invalidated. Returns the amount of votes changed
+func (r *voteRepository) Moderate(ctx context.Context, ids []primitive.ObjectID, action ModerationAction) (int64, error) {
+	collection, filter, _, err := r.scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	query := notDeleted(scoped(filter, bson.M{"_id": bson.M{"$in": ids}}))
+	set := bson.M{"deleted_at": now, "updated_at": now}
+	if action == MODERATION_INVALIDATE {
+		query["invalidated_at"] = bson.M{"$exists": false}
+		set = bson.M{"invalidated_at": now, "updated_at": now}
+	}
+	updateResult, err := collection.UpdateMany(ctx, query, bson.M{
+		"$set": set,
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updateResult.ModifiedCount, nil
+}
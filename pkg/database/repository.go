@@ -0,0 +1,377 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const VOTE_COLLECTION = "vote"
+
+var (
+	ErrQuotaExceeded   = errors.New("tenant reached its quota of votes")
+	ErrVersionMismatch = errors.New("the vote was changed since the version expected")
+)
+
+// Filter used to query votes. Nil fields are not used in the query. IDs and Videos match the
+// votes with any of the ids or on any of the videos in them
+type VoteFilter struct {
+	IDs            []primitive.ObjectID
+	Video          *primitive.ObjectID
+	Videos         []primitive.ObjectID
+	User           *primitive.ObjectID
+	Upvote         *bool
+	IncludeDeleted bool
+	// votes created from CreatedFrom, inclusive, until CreatedTo, exclusive
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+// Adds the conditions of the filter to a query
+func (filter VoteFilter) query(query bson.M) bson.M {
+	if filter.IDs != nil {
+		query["_id"] = bson.M{"$in": filter.IDs}
+	}
+	if filter.Video != nil {
+		query["video"] = *filter.Video
+	}
+	if filter.Videos != nil {
+		query["video"] = bson.M{"$in": filter.Videos}
+	}
+	if filter.User != nil {
+		query["user"] = *filter.User
+	}
+	if filter.Upvote != nil {
+		query["upvote"] = *filter.Upvote
+	}
+	if filter.CreatedFrom != nil || filter.CreatedTo != nil {
+		createdAt := bson.M{}
+		if filter.CreatedFrom != nil {
+			createdAt["$gte"] = *filter.CreatedFrom
+		}
+		if filter.CreatedTo != nil {
+			createdAt["$lt"] = *filter.CreatedTo
+		}
+		query["created_at"] = createdAt
+	}
+	if !filter.IncludeDeleted {
+		query = notDeleted(query)
+	}
+	return query
+}
+
+// Every read and write of the vote collection goes through the repository, so
+// soft deleted votes are excluded in a single place. Every query is scoped by the
+// tenant of the context, so votes of other tenants can't be reached
+type VoteRepository interface {
+	Insert(ctx context.Context, vote VoteModel) (primitive.ObjectID, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*VoteModel, error)
+	Find(ctx context.Context, filter VoteFilter) ([]VoteModel, error)
+	// Calls each with the votes matching the filter in the order of their ids, starting after the
+	// id given unless it is nil, until each returns an error
+	Scan(ctx context.Context, filter VoteFilter, after primitive.ObjectID, each func(vote VoteModel) error) error
+	UpdateUpvote(ctx context.Context, id primitive.ObjectID, upvote bool, expectedVersion int64) (*VoteModel, bool, error)
+	SoftDelete(ctx context.Context, id primitive.ObjectID, expectedVersion int64) (int64, error)
+	Restore(ctx context.Context, id primitive.ObjectID) (int64, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	BulkInsert(ctx context.Context, votes []VoteModel, ordered bool) ([]error, error)
+	BulkUpdateUpvote(ctx context.Context, updates []UpvoteUpdate, ordered bool) ([]error, error)
+	BulkSoftDelete(ctx context.Context, ids []primitive.ObjectID, ordered bool) ([]error, error)
+	BulkImport(ctx context.Context, votes []VoteModel, dryRun bool) ([]ImportAction, []error, error)
+	CastVote(ctx context.Context, video primitive.ObjectID, user primitive.ObjectID, direction Direction) (*VoteModel, CastAction, error)
+	BulkCastVote(ctx context.Context, casts []Cast) ([]primitive.ObjectID, []error, error)
+	Tally(ctx context.Context, video primitive.ObjectID) (Tally, error)
+	Tallies(ctx context.Context, videos []primitive.ObjectID) (map[primitive.ObjectID]Tally, error)
+	Count(ctx context.Context, filter VoteFilter) (int64, error)
+	Moderate(ctx context.Context, ids []primitive.ObjectID, action ModerationAction) (int64, error)
+	// Lists the tenants which have votes stored, besides the default one
+	Tenants(ctx context.Context) ([]string, error)
+	// Checks the database can be reached
+	Ping(ctx context.Context) error
+}
+
+type voteRepository struct {
+	client   *MongoClient
+	database string
+	tenants  tenant.Config
+	// nil if tenants need nothing before their first write
+	provision TenantProvisioner
+}
+
+func NewVoteRepository(client *MongoClient, database string, tenants tenant.Config) VoteRepository {
+	return &voteRepository{
+		client:   client,
+		database: database,
+		tenants:  tenants,
+	}
+}
+
+// Creates a repository which provisions each tenant before its first write
+func NewProvisionedVoteRepository(client *MongoClient, database string, tenants tenant.Config, provision TenantProvisioner) VoteRepository {
+	return &voteRepository{
+		client:    client,
+		database:  database,
+		tenants:   tenants,
+		provision: provision,
+	}
+}
+
+// Returns the collection of the tenant of the context and the filter matching its votes
+func (r *voteRepository) scope(ctx context.Context) (*mongo.Collection, bson.M, string, error) {
+	tenantId, err := r.tenants.FromContext(ctx)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	databaseName, collectionName := r.tenants.Namespace(tenantId, r.database, VOTE_COLLECTION)
+	collection := (*r.client).GetClient().Database(databaseName).Collection(collectionName)
+	// votes without tenant are stored without the field, which null also matches
+	filter := bson.M{"tenant": nil}
+	if tenantId != "" {
+		filter = bson.M{"tenant": tenantId}
+	}
+	return collection, filter, tenantId, nil
+}
+
+// Returns a new query with the conditions of both the tenant filter and the query
+func scoped(filter bson.M, query bson.M) bson.M {
+	result := bson.M{}
+	for key, value := range filter {
+		result[key] = value
+	}
+	for key, value := range query {
+		result[key] = value
+	}
+	return result
+}
+
+// Adds the tombstone condition to a query, so only votes that weren't deleted are matched
+func notDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
+
+// Returns ErrQuotaExceeded if the tenant already stores as many votes as its quota allows.
+// The quota is checked before inserting, so concurrent inserts may exceed it slightly
+func (r *voteRepository) checkQuota(ctx context.Context, collection *mongo.Collection, filter bson.M, tenantId string) error {
+	quota := r.tenants.Quota(tenantId)
+	if quota <= 0 {
+		return nil
+	}
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count >= quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Returns ErrQuotaExceeded if the tenant reached its quota
+func (r *voteRepository) Insert(ctx context.Context, vote VoteModel) (primitive.ObjectID, error) {
+	collection, filter, tenantId, err := r.writeScope(ctx)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if err = r.checkQuota(ctx, collection, filter, tenantId); err != nil {
+		return primitive.NilObjectID, err
+	}
+	vote.Tenant = tenantId
+	vote.Version = 1
+	vote.stamp(time.Now().UTC())
+	insertResult, err := collection.InsertOne(ctx, vote)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return insertResult.InsertedID.(primitive.ObjectID), nil
+}
+
+// Returns mongo.ErrNoDocuments if the vote does not exist or was deleted
+func (r *voteRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*VoteModel, error) {
+	collection, filter, _, err := r.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var vote VoteModel
+	if err := collection.FindOne(ctx, notDeleted(scoped(filter, bson.M{"_id": id}))).Decode(&vote); err != nil {
+		return nil, err
+	}
+	return &vote, nil
+}
+
+func (r *voteRepository) Find(ctx context.Context, filter VoteFilter) ([]VoteModel, error) {
+	collection, query, _, err := r.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, filter.query(query))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var votes []VoteModel
+	if err = cursor.All(ctx, &votes); err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+// Reads the votes with a cursor instead of loading them all, so exports of many votes don't hold
+// them in memory
+func (r *voteRepository) Scan(ctx context.Context, filter VoteFilter, after primitive.ObjectID, each func(vote VoteModel) error) error {
+	collection, query, _, err := r.scope(ctx)
+	if err != nil {
+		return err
+	}
+	query = filter.query(query)
+	if !after.IsZero() {
+		ids := bson.M{"$gt": after}
+		if filter.IDs != nil {
+			ids["$in"] = filter.IDs
+		}
+		query["_id"] = ids
+	}
+	cursor, err := collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var vote VoteModel
+		if err := cursor.Decode(&vote); err != nil {
+			return err
+		}
+		if err := each(vote); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// Pipeline which sets the upvote value, incrementing the version and setting the update time
+// only if the value changes
+func upvoteUpdate(upvote bool, now time.Time) mongo.Pipeline {
+	unchanged := bson.M{"$eq": bson.A{"$upvote", upvote}}
+	version := bson.M{"$cond": bson.A{
+		unchanged,
+		"$version",
+		bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+	}}
+	updatedAt := bson.M{"$cond": bson.A{unchanged, "$updated_at", now}}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "version", Value: version},
+		{Key: "updated_at", Value: updatedAt},
+		{Key: "upvote", Value: upvote},
+	}}}}
+}
+
+// Query matching a vote that wasn't deleted, and has the expected version unless it is zero
+func versioned(filter bson.M, id primitive.ObjectID, expectedVersion int64) bson.M {
+	query := bson.M{"_id": id}
+	if expectedVersion != 0 {
+		query["version"] = expectedVersion
+	}
+	return notDeleted(scoped(filter, query))
+}
+
+// Tells why a versioned write matched nothing: ErrVersionMismatch if the vote exists, or else mongo.ErrNoDocuments
+func versionMismatch(ctx context.Context, collection *mongo.Collection, filter bson.M, id primitive.ObjectID) error {
+	count, err := collection.CountDocuments(ctx, versioned(filter, id, 0))
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVersionMismatch
+	}
+	return mongo.ErrNoDocuments
+}
+
+// Returns the vote after the update and whether it was modified. Returns mongo.ErrNoDocuments if
+// the vote does not exist and ErrVersionMismatch if it doesn't have the expected version
+func (r *voteRepository) UpdateUpvote(ctx context.Context, id primitive.ObjectID, upvote bool, expectedVersion int64) (*VoteModel, bool, error) {
+	collection, filter, _, err := r.scope(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var vote VoteModel
+	now := time.Now().UTC()
+	err = collection.FindOneAndUpdate(ctx, versioned(filter, id, expectedVersion), upvoteUpdate(upvote, now),
+		options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&vote)
+	if err == mongo.ErrNoDocuments && expectedVersion != 0 {
+		return nil, false, versionMismatch(ctx, collection, filter, id)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	modified := vote.Upvote != upvote
+	vote.Upvote = upvote
+	if modified {
+		vote.Version++
+		vote.UpdatedAt = &now
+	}
+	return &vote, modified, nil
+}
+
+// Marks the vote as deleted instead of removing it. Returns the amount of votes deleted, or
+// ErrVersionMismatch if the vote doesn't have the expected version
+func (r *voteRepository) SoftDelete(ctx context.Context, id primitive.ObjectID, expectedVersion int64) (int64, error) {
+	collection, filter, _, err := r.scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	updateResult, err := collection.UpdateOne(ctx, versioned(filter, id, expectedVersion), bson.M{
+		"$set": bson.M{"deleted_at": now, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if updateResult.ModifiedCount == 0 && expectedVersion != 0 {
+		if err = versionMismatch(ctx, collection, filter, id); err != mongo.ErrNoDocuments {
+			return 0, err
+		}
+	}
+	return updateResult.ModifiedCount, nil
+}
+
+// Removes the tombstone of a deleted vote. Returns the amount of votes restored
+func (r *voteRepository) Restore(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	collection, filter, _, err := r.scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	updateResult, err := collection.UpdateOne(ctx, scoped(filter, bson.M{"_id": id, "deleted_at": bson.M{"$exists": true}}), bson.M{
+		"$set":   bson.M{"updated_at": time.Now().UTC()},
+		"$unset": bson.M{"deleted_at": ""},
+		"$inc":   bson.M{"version": 1},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updateResult.ModifiedCount, nil
+}
+
+// Physically removes votes deleted before the time given. Returns the amount of votes removed
+func (r *voteRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	collection, filter, _, err := r.scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	deleteResult, err := collection.DeleteMany(ctx, scoped(filter, bson.M{"deleted_at": bson.M{"$lt": before}}))
+	if err != nil {
+		return 0, err
+	}
+	return deleteResult.DeletedCount, nil
+}
+
+func (r *voteRepository) Ping(ctx context.Context) error {
+	return (*r.client).GetClient().Ping(ctx, readpref.Primary())
+}
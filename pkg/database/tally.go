@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Amount of upvotes and downvotes of a video, deleted and invalidated votes are not counted
+type Tally struct {
+	Video     primitive.ObjectID `bson:"_id"`
+	Upvotes   int64              `bson:"upvotes"`
+	Downvotes int64              `bson:"downvotes"`
+}
+
+// Counts the upvotes and downvotes of a video which weren't deleted or invalidated
+func (r *voteRepository) Tally(ctx context.Context, video primitive.ObjectID) (Tally, error) {
+	tallies, err := r.Tallies(ctx, []primitive.ObjectID{video})
+	if err != nil {
+		return Tally{}, err
+	}
+	return tallies[video], nil
+}
+
+// Counts the votes of every video in a single aggregation. Every video requested is in the
+// result, with zero votes if it has none
+func (r *voteRepository) Tallies(ctx context.Context, videos []primitive.ObjectID) (map[primitive.ObjectID]Tally, error) {
+	collection, filter, _, err := r.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(scoped(filter, bson.M{"video": bson.M{"$in": videos}, "invalidated_at": bson.M{"$exists": false}}))}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$video"},
+			{Key: "upvotes", Value: bson.M{"$sum": bson.M{"$cond": bson.A{"$upvote", 1, 0}}}},
+			{Key: "downvotes", Value: bson.M{"$sum": bson.M{"$cond": bson.A{"$upvote", 0, 1}}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	tallies := make(map[primitive.ObjectID]Tally, len(videos))
+	for _, video := range videos {
+		tallies[video] = Tally{Video: video}
+	}
+	for cursor.Next(ctx) {
+		var tally Tally
+		if err = cursor.Decode(&tally); err != nil {
+			return nil, err
+		}
+		tallies[tally.Video] = tally
+	}
+	return tallies, cursor.Err()
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Registry of the tenants, in the main database. Every tenant which writes a vote is recorded
+// in it, so tenants are found without guessing them from the names of databases or collections
+const TENANT_COLLECTION = "tenant"
+
+// Tenants already recorded by this process, by database and tenant, so each is only written once
+var registered sync.Map
+
+// Prepares the votes of a tenant before its first write, such as applying the migrations which
+// create its indexes, since tenants appearing after the server started were not migrated
+type TenantProvisioner func(ctx context.Context, tenantId string) error
+
+func (r *voteRepository) registry() *mongo.Collection {
+	return (*r.client).GetClient().Database(r.database).Collection(TENANT_COLLECTION)
+}
+
+// Records the tenant in the registry and provisions it, unless it was already done by this process
+func (r *voteRepository) register(ctx context.Context, tenantId string) error {
+	if tenantId == "" {
+		return nil
+	}
+	key := r.database + "/" + tenantId
+	if _, ok := registered.Load(key); ok {
+		return nil
+	}
+	_, err := r.registry().UpdateOne(ctx, bson.M{"_id": tenantId},
+		bson.M{"$setOnInsert": bson.M{"created_at": time.Now().UTC()}}, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	if r.provision != nil {
+		if err := r.provision(ctx, tenantId); err != nil {
+			return err
+		}
+	}
+	registered.Store(key, true)
+	return nil
+}
+
+// Returns the collection of the tenant of the context and the filter matching its votes, recording
+// the tenant in the registry. Used by every method which may create votes
+func (r *voteRepository) writeScope(ctx context.Context) (*mongo.Collection, bson.M, string, error) {
+	collection, filter, tenantId, err := r.scope(ctx)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if err = r.register(ctx, tenantId); err != nil {
+		return nil, nil, "", err
+	}
+	return collection, filter, tenantId, nil
+}
+
+// Lists the tenants of the registry, and the ones found through the databases or collections
+// named after them, which stored votes before the registry existed. Names which aren't valid
+// tenant ids, such as the ones of test databases, are left out
+func (r *voteRepository) Tenants(ctx context.Context) ([]string, error) {
+	var records []struct {
+		ID string `bson:"_id"`
+	}
+	cursor, err := r.registry().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	var tenants []string
+	found := map[string]bool{}
+	add := func(id string) {
+		if tenant.Valid(id) && !found[id] {
+			found[id] = true
+			tenants = append(tenants, id)
+		}
+	}
+	for _, record := range records {
+		add(record.ID)
+	}
+	client := (*r.client).GetClient()
+	if r.tenants.Strategy == tenant.DATABASE_STRATEGY {
+		prefix := r.database + "-"
+		names, err := client.ListDatabaseNames(ctx, bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}})
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			add(strings.TrimPrefix(name, prefix))
+		}
+		return tenants, nil
+	}
+	suffix := "_" + VOTE_COLLECTION
+	names, err := client.Database(r.database).ListCollectionNames(ctx, bson.M{"name": bson.M{"$regex": regexp.QuoteMeta(suffix) + "$"}})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		add(strings.TrimSuffix(name, suffix))
+	}
+	return tenants, nil
+}
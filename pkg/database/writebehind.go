@@ -0,0 +1,346 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"github.com/IsaqueB/ps-klever/pkg/wal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+const (
+	DEFAULT_WRITE_BEHIND_FLUSH_SIZE     = 1000
+	DEFAULT_WRITE_BEHIND_FLUSH_INTERVAL = 100 * time.Millisecond
+
+	writeBehindInsert = "insert"
+	writeBehindCast   = "cast"
+)
+
+// Write buffered in the log
+type writeBehindRecord struct {
+	Op        string             `json:"op"`
+	Tenant    string             `json:"tenant,omitempty"`
+	Vote      *VoteModel         `json:"vote,omitempty"`
+	Video     primitive.ObjectID `json:"video,omitempty"`
+	User      primitive.ObjectID `json:"user,omitempty"`
+	Direction Direction          `json:"direction,omitempty"`
+	// when the write was acknowledged, to measure how long it took to be applied
+	Time time.Time `json:"time"`
+}
+
+// Counters of the writes buffered, updated on each flush
+type WriteBehindStats struct {
+	// writes acknowledged and not applied yet
+	Pending int64
+	// how long the oldest pending write has been waiting
+	Lag     time.Duration
+	Applied int64
+	// writes which could not be applied, such as votes over the quota of the tenant
+	Failed        int64
+	LastFlush     time.Time
+	LastFlushTime time.Duration
+	// how long the writes of the last flush waited to be applied, at most
+	LastFlushLag time.Duration
+}
+
+// Acknowledges inserts and casts once they are appended to a write-ahead log, and applies them to
+// the repository in bulk in the background. Until then they are not visible to reads. Repeated casts
+// of an user on a video are coalesced into the last one, and the votes of each tenant are written
+// together. Writes left in the log by a crash are applied by the first flush after it is opened again
+type WriteBehind struct {
+	log      *wal.Log
+	tenants  tenant.Config
+	size     int
+	interval time.Duration
+	full     chan struct{}
+	logger   *zap.Logger
+
+	mu     sync.Mutex
+	stats  WriteBehindStats
+	oldest time.Time
+}
+
+// A non-positive interval is replaced by DEFAULT_WRITE_BEHIND_FLUSH_INTERVAL
+func NewWriteBehind(writeLog *wal.Log, tenants tenant.Config, size int, interval time.Duration) *WriteBehind {
+	if interval <= 0 {
+		interval = DEFAULT_WRITE_BEHIND_FLUSH_INTERVAL
+	}
+	return &WriteBehind{
+		log:      writeLog,
+		tenants:  tenants,
+		size:     size,
+		interval: interval,
+		full:     make(chan struct{}, 1),
+		logger:   zap.NewNop(),
+	}
+}
+
+// Set the logger of the writes which could not be applied
+func (wb *WriteBehind) SetLogger(logger *zap.Logger) {
+	wb.logger = logger
+}
+
+func (wb *WriteBehind) append(ctx context.Context, record writeBehindRecord) error {
+	tenantId, err := wb.tenants.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	record.Tenant = tenantId
+	record.Time = time.Now().UTC()
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	appended, err := wb.log.Append(encoded)
+	if err != nil {
+		return err
+	}
+	wb.mu.Lock()
+	wb.stats.Pending++
+	if wb.oldest.IsZero() {
+		wb.oldest = record.Time
+	}
+	wb.mu.Unlock()
+	if appended >= wb.size {
+		select {
+		case wb.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Buffers the insert of the vote, which must already have its id
+func (wb *WriteBehind) Insert(ctx context.Context, vote VoteModel) error {
+	return wb.append(ctx, writeBehindRecord{Op: writeBehindInsert, Vote: &vote})
+}
+
+// Buffers the cast of the vote of the user on the video
+func (wb *WriteBehind) CastVote(ctx context.Context, video primitive.ObjectID, user primitive.ObjectID, direction Direction) error {
+	return wb.append(ctx, writeBehindRecord{Op: writeBehindCast, Video: video, User: user, Direction: direction})
+}
+
+func (wb *WriteBehind) Stats() WriteBehindStats {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	stats := wb.stats
+	if !wb.oldest.IsZero() {
+		stats.Lag = time.Since(wb.oldest)
+	}
+	return stats
+}
+
+// Applies the writes buffered every interval, or sooner once size writes are buffered, until the
+// context is cancelled. A flush that fails is retried on the next one
+func (wb *WriteBehind) Run(ctx context.Context, repository VoteRepository) {
+	ticker := time.NewTicker(wb.interval)
+	defer ticker.Stop()
+	for {
+		if err := wb.Flush(ctx, repository); err != nil {
+			wb.logger.Error("could not flush write-behind", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wb.full:
+		}
+	}
+}
+
+// Closes the log. Writes which were not flushed are applied once it is opened again
+func (wb *WriteBehind) Close() error {
+	return wb.log.Close()
+}
+
+// Writes of a tenant, after coalescing. Each round has at most one write of each user on each
+// video, so the writes of a round are applied together and the ones of an user on a video are
+// applied in the order of the log
+type tenantWrites struct {
+	rounds []*writeRound
+	// round of the last write of each user on each video
+	last map[[2]primitive.ObjectID]int
+}
+
+type writeRound struct {
+	inserts []VoteModel
+	casts   []Cast
+	// index in casts of the cast of each user on each video
+	castIndex map[[2]primitive.ObjectID]int
+}
+
+// Round of the next write of the user on the video, after the round of its previous write
+func (tw *tenantWrites) next(key [2]primitive.ObjectID) *writeRound {
+	index := 0
+	if last, ok := tw.last[key]; ok {
+		index = last + 1
+	}
+	if index == len(tw.rounds) {
+		tw.rounds = append(tw.rounds, &writeRound{castIndex: make(map[[2]primitive.ObjectID]int)})
+	}
+	tw.last[key] = index
+	return tw.rounds[index]
+}
+
+func (tw *tenantWrites) insert(vote VoteModel) {
+	round := tw.next([2]primitive.ObjectID{vote.Video, vote.User})
+	round.inserts = append(round.inserts, vote)
+}
+
+// Casts following a cast of the user on the video replace it, unless a vote was inserted between them
+func (tw *tenantWrites) cast(cast Cast) {
+	key := [2]primitive.ObjectID{cast.Video, cast.User}
+	if last, ok := tw.last[key]; ok {
+		if index, ok := tw.rounds[last].castIndex[key]; ok {
+			tw.rounds[last].casts[index] = cast
+			return
+		}
+	}
+	round := tw.next(key)
+	round.castIndex[key] = len(round.casts)
+	round.casts = append(round.casts, cast)
+}
+
+// Applies every write in the segments closed so far and removes them
+func (wb *WriteBehind) Flush(ctx context.Context, repository VoteRepository) error {
+	segments, err := wb.log.Rotate()
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+	// writes appended after rotating are in the new segment, so they set the oldest again
+	wb.mu.Lock()
+	wb.oldest = time.Time{}
+	wb.mu.Unlock()
+	start := time.Now()
+	var read int64
+	var oldest time.Time
+	writes := make(map[string]*tenantWrites)
+	for _, segment := range segments {
+		err := wal.ReadSegment(segment, func(encoded []byte) error {
+			var record writeBehindRecord
+			if err := json.Unmarshal(encoded, &record); err != nil {
+				return err
+			}
+			read++
+			if oldest.IsZero() || record.Time.Before(oldest) {
+				oldest = record.Time
+			}
+			tenantWrite, ok := writes[record.Tenant]
+			if !ok {
+				tenantWrite = &tenantWrites{last: make(map[[2]primitive.ObjectID]int)}
+				writes[record.Tenant] = tenantWrite
+			}
+			switch record.Op {
+			case writeBehindInsert:
+				tenantWrite.insert(*record.Vote)
+			case writeBehindCast:
+				tenantWrite.cast(Cast{Video: record.Video, User: record.User, Direction: record.Direction})
+			}
+			return nil
+		})
+		if err != nil {
+			wb.restoreOldest(oldest)
+			return err
+		}
+	}
+	if read == 0 {
+		return wb.removeSegments(segments)
+	}
+	var failed int64
+	for tenantId, tenantWrite := range writes {
+		tenantCtx := ctx
+		if tenantId != "" {
+			tenantCtx = tenant.NewContext(ctx, tenantId)
+		}
+		for _, round := range tenantWrite.rounds {
+			roundFailed, err := wb.apply(tenantCtx, repository, tenantId, round)
+			if err != nil {
+				wb.restoreOldest(oldest)
+				return err
+			}
+			failed += roundFailed
+		}
+	}
+	if err := wb.removeSegments(segments); err != nil {
+		return err
+	}
+	wb.mu.Lock()
+	// writes recovered from a previous process were not counted as pending
+	wb.stats.Pending -= read
+	if wb.stats.Pending < 0 {
+		wb.stats.Pending = 0
+	}
+	wb.stats.Applied += read - failed
+	wb.stats.Failed += failed
+	wb.stats.LastFlush = time.Now()
+	wb.stats.LastFlushTime = time.Since(start)
+	wb.stats.LastFlushLag = time.Since(oldest)
+	wb.mu.Unlock()
+	return nil
+}
+
+// Applies the inserts and the casts of a round, each in a single BulkWrite. Returns how many failed
+func (wb *WriteBehind) apply(ctx context.Context, repository VoteRepository, tenantId string, round *writeRound) (int64, error) {
+	var failed int64
+	if len(round.inserts) > 0 {
+		errs, err := repository.BulkInsert(ctx, round.inserts, false)
+		if err != nil {
+			return 0, err
+		}
+		for i, err := range errs {
+			// votes inserted by a flush interrupted by a crash are inserted again by the next one,
+			// with the same id. Other duplicates, such as a second vote of the user on the video, fail
+			if err != nil && !isDuplicateID(err) {
+				failed++
+				wb.logger.Error("could not insert buffered vote", zap.String("tenant", tenantId),
+					zap.String("id", round.inserts[i].ID.Hex()), zap.Error(err))
+			}
+		}
+	}
+	if len(round.casts) > 0 {
+		_, errs, err := repository.BulkCastVote(ctx, round.casts)
+		if err != nil {
+			return 0, err
+		}
+		for i, err := range errs {
+			if err != nil {
+				failed++
+				wb.logger.Error("could not cast buffered vote", zap.String("tenant", tenantId),
+					zap.String("video", round.casts[i].Video.Hex()), zap.String("user", round.casts[i].User.Hex()), zap.Error(err))
+			}
+		}
+	}
+	return failed, nil
+}
+
+// Whether err is a duplicate key error on the _id index, as opposed to the other unique indexes
+func isDuplicateID(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "index: _id_ ")
+}
+
+func (wb *WriteBehind) removeSegments(segments []string) error {
+	for _, segment := range segments {
+		if err := wb.log.Remove(segment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The writes of a failed flush are retried by the next one, so they are still the oldest
+func (wb *WriteBehind) restoreOldest(oldest time.Time) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	if !oldest.IsZero() && (wb.oldest.IsZero() || oldest.Before(wb.oldest)) {
+		wb.oldest = oldest
+	}
+}
@@ -0,0 +1,176 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"github.com/IsaqueB/ps-klever/pkg/wal"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type cast struct {
+	tenant    string
+	video     primitive.ObjectID
+	user      primitive.ObjectID
+	direction database.Direction
+}
+
+// Records the writes applied by the flushes
+type recordingRepository struct {
+	database.VoteRepository
+	tenants  tenant.Config
+	inserted []database.VoteModel
+	casts    []cast
+	// "insert" or "cast" for each BulkWrite, in the order they were applied
+	writes []string
+	// errors of the votes inserted, none if nil
+	insertErrors []error
+}
+
+func (r *recordingRepository) BulkInsert(ctx context.Context, votes []database.VoteModel, ordered bool) ([]error, error) {
+	r.inserted = append(r.inserted, votes...)
+	r.writes = append(r.writes, "insert")
+	if r.insertErrors != nil {
+		return r.insertErrors, nil
+	}
+	return make([]error, len(votes)), nil
+}
+
+func (r *recordingRepository) BulkCastVote(ctx context.Context, casts []database.Cast) ([]primitive.ObjectID, []error, error) {
+	tenantId, _ := r.tenants.FromContext(ctx)
+	for _, c := range casts {
+		r.casts = append(r.casts, cast{tenantId, c.Video, c.User, c.Direction})
+	}
+	r.writes = append(r.writes, "cast")
+	return make([]primitive.ObjectID, len(casts)), make([]error, len(casts)), nil
+}
+
+func TestWriteBehindCoalescesCasts(t *testing.T) {
+	mock_ctx := context.Background()
+	writeLog, err := wal.Open(t.TempDir(), wal.SYNC_ALWAYS)
+	if err != nil {
+		t.Fatalf("Error opening log. %v", err)
+	}
+	defer writeLog.Close()
+	tenants := tenant.Config{Strategy: tenant.PREFIX_STRATEGY}
+	wb := database.NewWriteBehind(writeLog, tenants, 100, time.Minute)
+	video := primitive.NewObjectID()
+	user := primitive.NewObjectID()
+	other_user := primitive.NewObjectID()
+	assert.NoError(t, wb.CastVote(mock_ctx, video, user, database.DIRECTION_UP))
+	assert.NoError(t, wb.CastVote(mock_ctx, video, other_user, database.DIRECTION_DOWN))
+	assert.NoError(t, wb.CastVote(mock_ctx, video, user, database.DIRECTION_NONE))
+	assert.NoError(t, wb.CastVote(tenant.NewContext(mock_ctx, "acme"), video, user, database.DIRECTION_UP))
+	vote := database.VoteModel{ID: primitive.NewObjectID(), Video: video, User: other_user, Upvote: true}
+	assert.NoError(t, wb.Insert(mock_ctx, vote))
+	assert.Equal(t, int64(5), wb.Stats().Pending)
+
+	repository := &recordingRepository{tenants: tenants}
+	if err := wb.Flush(mock_ctx, repository); err != nil {
+		t.Fatalf("Error flushing. %v", err)
+	}
+	assert.Equal(t, []database.VoteModel{vote}, repository.inserted)
+	assert.ElementsMatch(t, []cast{
+		{"", video, user, database.DIRECTION_NONE},
+		{"", video, other_user, database.DIRECTION_DOWN},
+		{"acme", video, user, database.DIRECTION_UP},
+	}, repository.casts, "Only the last cast of each user on each video of each tenant should be applied")
+	stats := wb.Stats()
+	assert.Equal(t, int64(0), stats.Pending)
+	assert.Equal(t, int64(5), stats.Applied)
+
+	// flushed writes are not applied again
+	repository = &recordingRepository{tenants: tenants}
+	assert.NoError(t, wb.Flush(mock_ctx, repository))
+	assert.Empty(t, repository.casts)
+}
+
+func TestWriteBehindRecovery(t *testing.T) {
+	mock_ctx := context.Background()
+	dir := t.TempDir()
+	tenants := tenant.Config{Strategy: tenant.PREFIX_STRATEGY}
+	writeLog, err := wal.Open(dir, wal.SYNC_ALWAYS)
+	if err != nil {
+		t.Fatalf("Error opening log. %v", err)
+	}
+	wb := database.NewWriteBehind(writeLog, tenants, 100, time.Minute)
+	vote := database.VoteModel{ID: primitive.NewObjectID(), Video: primitive.NewObjectID(), User: primitive.NewObjectID()}
+	assert.NoError(t, wb.Insert(mock_ctx, vote))
+	// the process crashes before flushing
+	writeLog.Close()
+
+	writeLog, err = wal.Open(dir, wal.SYNC_ALWAYS)
+	if err != nil {
+		t.Fatalf("Error opening log. %v", err)
+	}
+	defer writeLog.Close()
+	wb = database.NewWriteBehind(writeLog, tenants, 100, time.Minute)
+	repository := &recordingRepository{tenants: tenants}
+	if err := wb.Flush(mock_ctx, repository); err != nil {
+		t.Fatalf("Error flushing. %v", err)
+	}
+	assert.Equal(t, []database.VoteModel{vote}, repository.inserted, "Writes acknowledged before the crash should be applied")
+}
+
+func TestWriteBehindDuplicates(t *testing.T) {
+	mock_ctx := context.Background()
+	writeLog, err := wal.Open(t.TempDir(), wal.SYNC_ALWAYS)
+	if err != nil {
+		t.Fatalf("Error opening log. %v", err)
+	}
+	defer writeLog.Close()
+	tenants := tenant.Config{Strategy: tenant.PREFIX_STRATEGY}
+	wb := database.NewWriteBehind(writeLog, tenants, 100, time.Minute)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, wb.Insert(mock_ctx, database.VoteModel{ID: primitive.NewObjectID(), Video: primitive.NewObjectID(), User: primitive.NewObjectID()}))
+	}
+	repository := &recordingRepository{tenants: tenants, insertErrors: []error{
+		nil,
+		// inserted by a flush interrupted by a crash
+		mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error collection: ps-klever.vote index: _id_ dup key: { _id: ObjectId('61f0c0ffee0000000000000a') }"}}},
+		// the user already voted on the video
+		mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error collection: ps-klever.vote index: video_1_user_1 dup key: { video: ObjectId('61f0c0ffee0000000000000b') }"}}},
+	}}
+	if err := wb.Flush(mock_ctx, repository); err != nil {
+		t.Fatalf("Error flushing. %v", err)
+	}
+	stats := wb.Stats()
+	assert.Equal(t, int64(2), stats.Applied, "Votes already inserted with the same id should count as applied")
+	assert.Equal(t, int64(1), stats.Failed, "Duplicates on other indexes should fail")
+}
+
+func TestWriteBehindOrder(t *testing.T) {
+	mock_ctx := context.Background()
+	writeLog, err := wal.Open(t.TempDir(), wal.SYNC_ALWAYS)
+	if err != nil {
+		t.Fatalf("Error opening log. %v", err)
+	}
+	defer writeLog.Close()
+	tenants := tenant.Config{Strategy: tenant.PREFIX_STRATEGY}
+	wb := database.NewWriteBehind(writeLog, tenants, 100, time.Minute)
+	video := primitive.NewObjectID()
+	user := primitive.NewObjectID()
+	other_user := primitive.NewObjectID()
+	assert.NoError(t, wb.CastVote(mock_ctx, video, user, database.DIRECTION_UP))
+	assert.NoError(t, wb.CastVote(mock_ctx, video, other_user, database.DIRECTION_UP))
+	assert.NoError(t, wb.Insert(mock_ctx, database.VoteModel{ID: primitive.NewObjectID(), Video: video, User: user}))
+	assert.NoError(t, wb.CastVote(mock_ctx, video, user, database.DIRECTION_DOWN))
+	assert.NoError(t, wb.CastVote(mock_ctx, video, user, database.DIRECTION_NONE))
+
+	repository := &recordingRepository{tenants: tenants}
+	if err := wb.Flush(mock_ctx, repository); err != nil {
+		t.Fatalf("Error flushing. %v", err)
+	}
+	assert.Equal(t, []string{"cast", "insert", "cast"}, repository.writes, "Writes of an user on a video should keep the order of the log")
+	assert.Equal(t, []cast{
+		{"", video, user, database.DIRECTION_UP},
+		{"", video, other_user, database.DIRECTION_UP},
+		{"", video, user, database.DIRECTION_NONE},
+	}, repository.casts, "Casts of different users should be cast together, and the ones after an insert coalesced")
+	assert.Equal(t, int64(5), wb.Stats().Applied)
+}
@@ -2,42 +2,171 @@ package grpc_client
 
 import (
 	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
 
 	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
 )
 
+// Same as the default limit of items of the server batch RPCs
+const DEFAULT_BATCH_SIZE = 500
+
+// Scheme of the target of the clients of many endpoints
+const ENDPOINTS_SCHEME = "endpoints"
+
+var ErrNoEndpoints = errors.New("no endpoints to connect to")
+
+// Size of the chunks of the files sent to ImportVotes
+const IMPORT_CHUNK_SIZE = 64 * 1024
+
+// Returns a context which makes Insert, UpdateOne and DeleteOne idempotent: retrying them with the
+// same key returns the response of the first call instead of executing them again
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "idempotency-key", key)
+}
+
+// Returns a context whose calls send the token as a bearer token, required by the Admin service
+func WithToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
 type Client interface {
 	GetClient() pb.VoteClient
+	GetAdminClient() pb.AdminClient
 	GetConnection() *grpc.ClientConn
 	Disconnect() error
+	// Sets the vote of the user on the video, the recommended way of voting. Unlike combining
+	// Insert, UpdateOne and DeleteOne, it is atomic and safe to retry
+	CastVote(ctx context.Context, video string, user string, direction pb.Direction) (*pb.CastVoteResponse, error)
+	GetUserVoteOnVideo(ctx context.Context, video string, user string) (*pb.UserVote, error)
+	// Returns the vote of the user on each video, in the same order of the videos
+	GetUserVotesOnVideos(ctx context.Context, user string, videos []string) ([]*pb.UserVote, error)
+	// Returns the tally of each video keyed by its id, sending batch_size videos in each request
+	BatchGetVideoTallies(ctx context.Context, videos []string) (map[string]*pb.VideoTally, error)
 	Insert(ctx context.Context, vote *pb.VoteStruct) (string, error)
 	Get(ctx context.Context, id string) (*pb.VoteStruct, error)
 	UpdateOne(ctx context.Context, id string, new_vote_value bool) (int32, int32, error)
 	DeleteOne(ctx context.Context, id string) (int32, error)
+	ListVotesInVideo(ctx context.Context, id string) ([]*pb.VoteStruct, error)
+	ListVotesOfUser(ctx context.Context, id string) ([]*pb.VoteStruct, error)
+	BatchInsert(ctx context.Context, votes []*pb.VoteStruct, ordered bool) ([]*pb.BatchItemResult, error)
+	BatchUpdate(ctx context.Context, updates []*pb.UpdateOneRequest, ordered bool) ([]*pb.BatchItemResult, error)
+	BatchDelete(ctx context.Context, ids []string, ordered bool) ([]*pb.BatchItemResult, error)
+	IngestVotes(ctx context.Context, votes <-chan *pb.VoteStruct) (*pb.IngestVotesResponse, error)
+	// Calls chunk with every chunk of the export, in order, until the export ends or chunk fails
+	ExportVotes(ctx context.Context, req *pb.ExportVotesRequest, chunk func(chunk *pb.ExportVotesResponse) error) error
+	// Sends the file read from data to ImportVotes, calling failure with every line which failed,
+	// and returns the summary of the import
+	ImportVotes(ctx context.Context, format pb.ExportFormat, dryRun bool, data io.Reader, failure func(failure *pb.BatchItemResult) error) (*pb.ImportVotesSummary, error)
+	SetBatchSize(size int)
 }
 
 type client struct {
-	vote_c pb.VoteClient
-	conn   *grpc.ClientConn
+	vote_c     pb.VoteClient
+	admin_c    pb.AdminClient
+	conn       *grpc.ClientConn
+	batch_size int
 }
 
+// Creates a client connected to the server, with the default options of New
 func NewGrpcClient(port string) (Client, error) {
-	conn, err := grpc.Dial(port, grpc.WithInsecure())
+	return New([]string{port})
+}
+
+// Creates a client connected to the server over TLS, such as the one built by
+// credentials.NewTLS
+func NewSecureGrpcClient(target string, creds credentials.TransportCredentials) (Client, error) {
+	return New([]string{target}, WithTransportCredentials(creds))
+}
+
+// Creates a client balancing the calls over the endpoints. A single endpoint may be a target
+// resolved to many addresses, such as dns:///votes.example.com:9001, and many endpoints are
+// addresses. Idempotent calls are retried while the server is unavailable, unary calls get a
+// default deadline and idle connections are kept alive with pings. The trace of the context of
+// each call is sent to the server, using the global tracer provider and propagator of OpenTelemetry
+func New(endpoints []string, opts ...Option) (Client, error) {
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	c := defaultConfig()
+	for _, opt := range opts {
+		opt(&c)
+	}
+	serviceConfig, err := c.serviceConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := grpc.WithInsecure()
+	if c.creds != nil {
+		transport = grpc.WithTransportCredentials(c.creds)
+	}
+	dialOptions := []grpc.DialOption{
+		transport,
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithChainUnaryInterceptor(timeoutInterceptor(c.timeout), otelgrpc.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	}
+	if c.keepaliveTime > 0 {
+		dialOptions = append(dialOptions, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                c.keepaliveTime,
+			Timeout:             c.keepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	target := endpoints[0]
+	if len(endpoints) > 1 {
+		// the addresses are given to the balancer by a resolver of its own
+		r := manual.NewBuilderWithScheme(ENDPOINTS_SCHEME)
+		addresses := make([]resolver.Address, len(endpoints))
+		for i, endpoint := range endpoints {
+			addresses[i] = resolver.Address{Addr: endpoint}
+		}
+		r.InitialState(resolver.State{Addresses: addresses})
+		target = ENDPOINTS_SCHEME + ":///" + strings.Join(endpoints, ",")
+		dialOptions = append(dialOptions, grpc.WithResolvers(r))
+	}
+	conn, err := grpc.Dial(target, append(dialOptions, c.dialOptions...)...)
 	if err != nil {
 		return nil, err
 	}
-	vote_client := pb.NewVoteClient(conn)
 	return &client{
-		conn:   conn,
-		vote_c: vote_client,
+		conn:       conn,
+		vote_c:     pb.NewVoteClient(conn),
+		admin_c:    pb.NewAdminClient(conn),
+		batch_size: c.batchSize,
 	}, nil
 }
 
+// Sets the deadline of the unary calls made with a context without one
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
 func (c *client) GetClient() pb.VoteClient {
 	return c.vote_c
 }
 
+func (c *client) GetAdminClient() pb.AdminClient {
+	return c.admin_c
+}
+
 func (c *client) GetConnection() *grpc.ClientConn {
 	return c.conn
 }
@@ -50,6 +179,44 @@ func (c *client) Disconnect() error {
 	return nil
 }
 
+func (c *client) CastVote(ctx context.Context, video string, user string, direction pb.Direction) (*pb.CastVoteResponse, error) {
+	return c.vote_c.CastVote(ctx, &pb.CastVoteRequest{Video: video, User: user, Direction: direction})
+}
+
+func (c *client) GetUserVoteOnVideo(ctx context.Context, video string, user string) (*pb.UserVote, error) {
+	response, err := c.vote_c.GetUserVoteOnVideo(ctx, &pb.GetUserVoteOnVideoRequest{Video: video, User: user})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetVote(), nil
+}
+
+func (c *client) GetUserVotesOnVideos(ctx context.Context, user string, videos []string) ([]*pb.UserVote, error) {
+	response, err := c.vote_c.GetUserVotesOnVideos(ctx, &pb.GetUserVotesOnVideosRequest{User: user, Video: videos})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetVote(), nil
+}
+
+func (c *client) BatchGetVideoTallies(ctx context.Context, videos []string) (map[string]*pb.VideoTally, error) {
+	tallies := make(map[string]*pb.VideoTally, len(videos))
+	for from := 0; from < len(videos); from += c.batch_size {
+		to := from + c.batch_size
+		if to > len(videos) {
+			to = len(videos)
+		}
+		response, err := c.vote_c.BatchGetVideoTallies(ctx, &pb.BatchGetVideoTalliesRequest{Video: videos[from:to]})
+		if err != nil {
+			return nil, err
+		}
+		for video, tally := range response.GetTallies() {
+			tallies[video] = tally
+		}
+	}
+	return tallies, nil
+}
+
 func (c *client) Insert(ctx context.Context, vote *pb.VoteStruct) (string, error) {
 	response, err := c.vote_c.Insert(ctx, &pb.InsertRequest{Vote: vote})
 	if err != nil {
@@ -101,3 +268,181 @@ func (c *client) ListVotesOfUser(ctx context.Context, id string) ([]*pb.VoteStru
 	}
 	return response.GetVote(), nil
 }
+
+// Set how many items are sent in each request of the batch methods. It should not be greater
+// than the limit of the server
+func (c *client) SetBatchSize(size int) {
+	c.batch_size = size
+}
+
+// Sends the items in chunks of batch_size, returning the results of all chunks with the index of
+// the item in the whole batch. When ordered, the chunks after one with a failed item are not sent
+// and their items get codes.Aborted. If a request fails, the results of the previous chunks are
+// returned with the error
+func (c *client) chunked(size int, ordered bool, send func(from int, to int) ([]*pb.BatchItemResult, error)) ([]*pb.BatchItemResult, error) {
+	var results []*pb.BatchItemResult
+	for from := 0; from < size; from += c.batch_size {
+		to := from + c.batch_size
+		if to > size {
+			to = size
+		}
+		chunk, err := send(from, to)
+		if err != nil {
+			return results, err
+		}
+		failed := false
+		for _, result := range chunk {
+			result.Index += int32(from)
+			failed = failed || result.GetCode() != int32(codes.OK)
+		}
+		results = append(results, chunk...)
+		if ordered && failed {
+			for i := to; i < size; i++ {
+				results = append(results, &pb.BatchItemResult{
+					Index:   int32(i),
+					Code:    int32(codes.Aborted),
+					Message: "not executed since a previous write of the ordered batch failed",
+				})
+			}
+			break
+		}
+	}
+	return results, nil
+}
+
+func (c *client) BatchInsert(ctx context.Context, votes []*pb.VoteStruct, ordered bool) ([]*pb.BatchItemResult, error) {
+	return c.chunked(len(votes), ordered, func(from int, to int) ([]*pb.BatchItemResult, error) {
+		response, err := c.vote_c.BatchInsert(ctx, &pb.BatchInsertRequest{Vote: votes[from:to], Ordered: ordered})
+		if err != nil {
+			return nil, err
+		}
+		return response.GetResult(), nil
+	})
+}
+
+func (c *client) BatchUpdate(ctx context.Context, updates []*pb.UpdateOneRequest, ordered bool) ([]*pb.BatchItemResult, error) {
+	return c.chunked(len(updates), ordered, func(from int, to int) ([]*pb.BatchItemResult, error) {
+		response, err := c.vote_c.BatchUpdate(ctx, &pb.BatchUpdateRequest{Vote: updates[from:to], Ordered: ordered})
+		if err != nil {
+			return nil, err
+		}
+		return response.GetResult(), nil
+	})
+}
+
+func (c *client) BatchDelete(ctx context.Context, ids []string, ordered bool) ([]*pb.BatchItemResult, error) {
+	return c.chunked(len(ids), ordered, func(from int, to int) ([]*pb.BatchItemResult, error) {
+		response, err := c.vote_c.BatchDelete(ctx, &pb.BatchDeleteRequest{Id: ids[from:to], Ordered: ordered})
+		if err != nil {
+			return nil, err
+		}
+		return response.GetResult(), nil
+	})
+}
+
+// Streams every vote read from the channel to the server, until the channel is closed, then
+// returns the summary of the ingestion. Cancelling the context aborts the ingestion
+func (c *client) IngestVotes(ctx context.Context, votes <-chan *pb.VoteStruct) (*pb.IngestVotesResponse, error) {
+	stream, err := c.vote_c.IngestVotes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case vote, ok := <-votes:
+			if !ok {
+				return stream.CloseAndRecv()
+			}
+			if err := stream.Send(&pb.IngestVotesRequest{Vote: vote}); err != nil {
+				// the reason the server aborted the stream is only known when receiving
+				if _, err := stream.CloseAndRecv(); err != nil {
+					return nil, err
+				}
+				return nil, err
+			}
+		}
+	}
+}
+
+func (c *client) ExportVotes(ctx context.Context, req *pb.ExportVotesRequest, chunk func(chunk *pb.ExportVotesResponse) error) error {
+	stream, err := c.vote_c.ExportVotes(ctx, req)
+	if err != nil {
+		return err
+	}
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := chunk(response); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *client) ImportVotes(ctx context.Context, format pb.ExportFormat, dryRun bool, data io.Reader, failure func(failure *pb.BatchItemResult) error) (*pb.ImportVotesSummary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.vote_c.ImportVotes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// send in another goroutine, so the failures are received while the file is sent
+	sent := make(chan error, 1)
+	go func() {
+		// io.EOF from Send means the server ended the stream, and its error is returned by Recv
+		if err := stream.Send(&pb.ImportVotesRequest{Format: format, DryRun: dryRun}); err != nil {
+			sent <- nil
+			return
+		}
+		buffer := make([]byte, IMPORT_CHUNK_SIZE)
+		for {
+			n, err := data.Read(buffer)
+			if n > 0 {
+				if err := stream.Send(&pb.ImportVotesRequest{Data: buffer[:n]}); err != nil {
+					sent <- nil
+					return
+				}
+			}
+			if err == io.EOF {
+				sent <- stream.CloseSend()
+				return
+			}
+			if err != nil {
+				sent <- err
+				cancel()
+				return
+			}
+		}
+	}()
+	for {
+		response, err := stream.Recv()
+		if err != nil {
+			// an error reading the file cancels the stream, and is the one returned
+			select {
+			case readErr := <-sent:
+				if readErr != nil {
+					return nil, readErr
+				}
+			default:
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		for _, item := range response.GetFailure() {
+			if err := failure(item); err != nil {
+				return nil, err
+			}
+		}
+		if response.Summary != nil {
+			return response.Summary, nil
+		}
+	}
+}
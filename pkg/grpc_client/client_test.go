@@ -14,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 )
 
 func init() {
@@ -280,3 +281,121 @@ func TestListVotesOfUser(t *testing.T) {
 		compareVotes(t, votes[i], vote)
 	}
 }
+
+func TestBatchInsertChunked(t *testing.T) {
+	c, err := initClient()
+	if err != nil {
+		t.Fatalf("Error creating client. %v", err)
+	}
+	defer c.Disconnect()
+	c.SetBatchSize(2)
+	mock_id := primitive.NewObjectID().Hex()
+	var votes []*pb.VoteStruct
+	for i := 0; i < 5; i++ {
+		votes = append(votes, &pb.VoteStruct{Video: mock_id, User: primitive.NewObjectID().Hex(), Upvote: true})
+	}
+	results, err := c.BatchInsert(context.Background(), votes, false)
+	if err != nil {
+		t.Fatalf("Error in BatchInsert. %v", err)
+	}
+	assert.Len(t, results, 5)
+	for i, result := range results {
+		assert.Equal(t, int32(i), result.GetIndex(), "Indexes should refer to the whole batch")
+		assert.Equal(t, int32(codes.OK), result.GetCode())
+	}
+	response, err := c.GetClient().ListVotesInVideo(context.Background(), &pb.ListVotesInVideoRequest{
+		Id: mock_id,
+	})
+	if err != nil {
+		t.Fatalf("Error in ListVotesInVideo. %v", err)
+	}
+	assert.Len(t, response.Vote, 5)
+}
+
+func TestBatchDeleteOrderedChunked(t *testing.T) {
+	c, err := initClient()
+	if err != nil {
+		t.Fatalf("Error creating client. %v", err)
+	}
+	defer c.Disconnect()
+	c.SetBatchSize(2)
+	mock_id := primitive.NewObjectID().Hex()
+	inserted, err := c.Insert(context.Background(), &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true})
+	if err != nil {
+		t.Fatalf("Error in Insert. %v", err)
+	}
+	results, err := c.BatchDelete(context.Background(), []string{inserted, primitive.NewObjectID().Hex(), inserted, inserted}, true)
+	if err != nil {
+		t.Fatalf("Error in BatchDelete. %v", err)
+	}
+	assert.Len(t, results, 4)
+	assert.Equal(t, int32(codes.OK), results[0].GetCode())
+	assert.Equal(t, int32(codes.NotFound), results[1].GetCode())
+	assert.Equal(t, int32(codes.Aborted), results[2].GetCode(), "Chunks after a failure should not be sent")
+	assert.Equal(t, int32(codes.Aborted), results[3].GetCode(), "Chunks after a failure should not be sent")
+}
+
+func TestIngestVotes(t *testing.T) {
+	c, err := initClient()
+	if err != nil {
+		t.Fatalf("Error creating client. %v", err)
+	}
+	defer c.Disconnect()
+	mock_id := primitive.NewObjectID().Hex()
+	votes := make(chan *pb.VoteStruct)
+	go func() {
+		defer close(votes)
+		for i := 0; i < 10; i++ {
+			votes <- &pb.VoteStruct{Video: mock_id, User: primitive.NewObjectID().Hex(), Upvote: i%2 == 0}
+		}
+	}()
+	summary, err := c.IngestVotes(context.Background(), votes)
+	if err != nil {
+		t.Fatalf("Error in IngestVotes. %v", err)
+	}
+	assert.Equal(t, int32(10), summary.GetReceived())
+	assert.Equal(t, int32(10), summary.GetInserted())
+	assert.Equal(t, int32(0), summary.GetFailed())
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	c, err := initClient()
+	if err != nil {
+		t.Fatalf("Error creating client. %v", err)
+	}
+	defer c.Disconnect()
+	mock_id := primitive.NewObjectID().Hex()
+	mock_ctx := grpc_client.WithIdempotencyKey(context.Background(), primitive.NewObjectID().Hex())
+	vote := &pb.VoteStruct{Video: mock_id, User: mock_id, Upvote: true}
+	id_0, err := c.Insert(mock_ctx, vote)
+	if err != nil {
+		t.Fatalf("Error in Insert. %v", err)
+	}
+	id_1, err := c.Insert(mock_ctx, vote)
+	if err != nil {
+		t.Fatalf("Error in Insert. %v", err)
+	}
+	assert.Equal(t, id_0, id_1, "Retries with the same key should return the same vote")
+}
+
+func TestCastVote(t *testing.T) {
+	c, err := initClient()
+	if err != nil {
+		t.Fatalf("Error creating client. %v", err)
+	}
+	defer c.Disconnect()
+	mock_video := primitive.NewObjectID().Hex()
+	mock_user := primitive.NewObjectID().Hex()
+	res, err := c.CastVote(context.Background(), mock_video, mock_user, pb.Direction_DIRECTION_UP)
+	if err != nil {
+		t.Fatalf("Error in CastVote. %v", err)
+	}
+	assert.Equal(t, pb.CastAction_CAST_INSERTED, res.GetAction())
+	assert.Equal(t, pb.Direction_DIRECTION_UP, res.GetDirection())
+	assert.Equal(t, int64(1), res.GetTally().GetUpvotes())
+	vote, err := c.Get(context.Background(), res.GetVote().GetId())
+	if err != nil {
+		t.Fatalf("Error in Get. %v", err)
+	}
+	assert.True(t, vote.GetUpvote(), "The vote cast should be stored")
+}
@@ -0,0 +1,37 @@
+package fake
+
+import (
+	"context"
+	"net"
+
+	"github.com/IsaqueB/ps-klever/pkg/grpc_client"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Size of the buffer of the in-memory connections
+const BUFCONN_SIZE = 1024 * 1024
+
+// Serves the Vote service with a real gRPC server listening in memory, and returns a client
+// connected to it with the options given. Any implementation can be served, such as a Server or
+// the real one. Call stop once done, to disconnect the client and stop the server
+func Dial(vote pb.VoteServer, opts ...grpc_client.Option) (client grpc_client.Client, stop func(), err error) {
+	lis := bufconn.Listen(BUFCONN_SIZE)
+	server := grpc.NewServer()
+	pb.RegisterVoteServer(server, vote)
+	go server.Serve(lis)
+	dialer := grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})
+	// passthrough skips resolving the address, which only the dialer knows
+	client, err = grpc_client.New([]string{"passthrough:///bufconn"}, append(opts, grpc_client.WithDialOptions(dialer))...)
+	if err != nil {
+		server.Stop()
+		return nil, nil, err
+	}
+	return client, func() {
+		client.Disconnect()
+		server.Stop()
+	}, nil
+}
@@ -0,0 +1,327 @@
+package fake
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/IsaqueB/ps-klever/pkg/grpc_client"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Client calling the server directly, without gRPC. The metadata of the outgoing context, such as
+// the idempotency key, is recorded by the server as the real one receives it.
+// It has no connection, and the methods of GetClient answer without going through gRPC, except
+// for the streaming ones. Tests needing them, or interceptors, should use Dial instead
+type Client struct {
+	Server *Server
+}
+
+var _ grpc_client.Client = &Client{}
+
+// Creates a client of a new empty server
+func NewClient() *Client {
+	return &Client{Server: NewServer()}
+}
+
+// Context received by the server for a call made with ctx
+func incoming(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+func (c *Client) GetClient() pb.VoteClient {
+	return voteClient{c.Server}
+}
+
+// The fake doesn't serve the Admin service, so it has no client of it
+func (c *Client) GetAdminClient() pb.AdminClient {
+	return nil
+}
+
+// Nil, since the client isn't connected
+func (c *Client) GetConnection() *grpc.ClientConn {
+	return nil
+}
+
+func (c *Client) Disconnect() error {
+	return nil
+}
+
+func (c *Client) SetBatchSize(size int) {}
+
+func (c *Client) CastVote(ctx context.Context, video string, user string, direction pb.Direction) (*pb.CastVoteResponse, error) {
+	return c.Server.CastVote(incoming(ctx), &pb.CastVoteRequest{Video: video, User: user, Direction: direction})
+}
+
+func (c *Client) GetUserVoteOnVideo(ctx context.Context, video string, user string) (*pb.UserVote, error) {
+	response, err := c.Server.GetUserVoteOnVideo(incoming(ctx), &pb.GetUserVoteOnVideoRequest{Video: video, User: user})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetVote(), nil
+}
+
+func (c *Client) GetUserVotesOnVideos(ctx context.Context, user string, videos []string) ([]*pb.UserVote, error) {
+	response, err := c.Server.GetUserVotesOnVideos(incoming(ctx), &pb.GetUserVotesOnVideosRequest{User: user, Video: videos})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetVote(), nil
+}
+
+func (c *Client) BatchGetVideoTallies(ctx context.Context, videos []string) (map[string]*pb.VideoTally, error) {
+	response, err := c.Server.BatchGetVideoTallies(incoming(ctx), &pb.BatchGetVideoTalliesRequest{Video: videos})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetTallies(), nil
+}
+
+func (c *Client) Insert(ctx context.Context, vote *pb.VoteStruct) (string, error) {
+	response, err := c.Server.Insert(incoming(ctx), &pb.InsertRequest{Vote: vote})
+	if err != nil {
+		return "", err
+	}
+	return response.GetId(), nil
+}
+
+func (c *Client) Get(ctx context.Context, id string) (*pb.VoteStruct, error) {
+	response, err := c.Server.Get(incoming(ctx), &pb.GetRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetVote(), nil
+}
+
+func (c *Client) UpdateOne(ctx context.Context, id string, new_vote_value bool) (int32, int32, error) {
+	response, err := c.Server.UpdateOne(incoming(ctx), &pb.UpdateOneRequest{Id: id, NewValue: new_vote_value})
+	if err != nil {
+		return -1, -1, err
+	}
+	return response.GetMatched(), response.GetModified(), nil
+}
+
+func (c *Client) DeleteOne(ctx context.Context, id string) (int32, error) {
+	response, err := c.Server.DeleteOne(incoming(ctx), &pb.DeleteOneRequest{Id: id})
+	if err != nil {
+		return -1, err
+	}
+	return response.GetDeleted(), nil
+}
+
+func (c *Client) ListVotesInVideo(ctx context.Context, id string) ([]*pb.VoteStruct, error) {
+	response, err := c.Server.ListVotesInVideo(incoming(ctx), &pb.ListVotesInVideoRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetVote(), nil
+}
+
+func (c *Client) ListVotesOfUser(ctx context.Context, id string) ([]*pb.VoteStruct, error) {
+	response, err := c.Server.ListVotesOfUser(incoming(ctx), &pb.ListVotesOfUserRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetVote(), nil
+}
+
+func (c *Client) BatchInsert(ctx context.Context, votes []*pb.VoteStruct, ordered bool) ([]*pb.BatchItemResult, error) {
+	response, err := c.Server.BatchInsert(incoming(ctx), &pb.BatchInsertRequest{Vote: votes, Ordered: ordered})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetResult(), nil
+}
+
+func (c *Client) BatchUpdate(ctx context.Context, updates []*pb.UpdateOneRequest, ordered bool) ([]*pb.BatchItemResult, error) {
+	response, err := c.Server.BatchUpdate(incoming(ctx), &pb.BatchUpdateRequest{Vote: updates, Ordered: ordered})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetResult(), nil
+}
+
+func (c *Client) BatchDelete(ctx context.Context, ids []string, ordered bool) ([]*pb.BatchItemResult, error) {
+	response, err := c.Server.BatchDelete(incoming(ctx), &pb.BatchDeleteRequest{Id: ids, Ordered: ordered})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetResult(), nil
+}
+
+// Server side of the streams of the client, which hands the messages to the server directly
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+type ingestStream struct {
+	serverStream
+	votes    <-chan *pb.VoteStruct
+	response *pb.IngestVotesResponse
+}
+
+func (s *ingestStream) Recv() (*pb.IngestVotesRequest, error) {
+	select {
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	case vote, ok := <-s.votes:
+		if !ok {
+			return nil, io.EOF
+		}
+		return &pb.IngestVotesRequest{Vote: vote}, nil
+	}
+}
+
+func (s *ingestStream) SendAndClose(response *pb.IngestVotesResponse) error {
+	s.response = response
+	return nil
+}
+
+func (c *Client) IngestVotes(ctx context.Context, votes <-chan *pb.VoteStruct) (*pb.IngestVotesResponse, error) {
+	stream := &ingestStream{serverStream: serverStream{ctx: incoming(ctx)}, votes: votes}
+	if err := c.Server.IngestVotes(stream); err != nil {
+		return nil, err
+	}
+	return stream.response, nil
+}
+
+type exportStream struct {
+	serverStream
+	chunk func(chunk *pb.ExportVotesResponse) error
+}
+
+func (s *exportStream) Send(chunk *pb.ExportVotesResponse) error {
+	return s.chunk(chunk)
+}
+
+func (c *Client) ExportVotes(ctx context.Context, req *pb.ExportVotesRequest, chunk func(chunk *pb.ExportVotesResponse) error) error {
+	return c.Server.ExportVotes(req, &exportStream{serverStream: serverStream{ctx: incoming(ctx)}, chunk: chunk})
+}
+
+type importStream struct {
+	serverStream
+	requests []*pb.ImportVotesRequest
+	failure  func(failure *pb.BatchItemResult) error
+	summary  *pb.ImportVotesSummary
+}
+
+func (s *importStream) Recv() (*pb.ImportVotesRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *importStream) Send(response *pb.ImportVotesResponse) error {
+	for _, failure := range response.GetFailure() {
+		if err := s.failure(failure); err != nil {
+			return err
+		}
+	}
+	if response.Summary != nil {
+		s.summary = response.Summary
+	}
+	return nil
+}
+
+func (c *Client) ImportVotes(ctx context.Context, format pb.ExportFormat, dryRun bool, data io.Reader, failure func(failure *pb.BatchItemResult) error) (*pb.ImportVotesSummary, error) {
+	file, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	stream := &importStream{
+		serverStream: serverStream{ctx: incoming(ctx)},
+		requests:     []*pb.ImportVotesRequest{{Format: format, DryRun: dryRun, Data: file}},
+		failure:      failure,
+	}
+	if err := c.Server.ImportVotes(stream); err != nil {
+		return nil, err
+	}
+	return stream.summary, nil
+}
+
+// Generated client answered by the server directly. The streaming methods need a connection, so
+// they fail with codes.Unimplemented
+type voteClient struct {
+	server *Server
+}
+
+func errStreaming() error {
+	return status.Error(codes.Unimplemented, "streaming RPCs need a connection, use fake.Dial")
+}
+
+func (c voteClient) CastVote(ctx context.Context, in *pb.CastVoteRequest, opts ...grpc.CallOption) (*pb.CastVoteResponse, error) {
+	return c.server.CastVote(incoming(ctx), in)
+}
+
+func (c voteClient) ListVotesInVideo(ctx context.Context, in *pb.ListVotesInVideoRequest, opts ...grpc.CallOption) (*pb.ListVotesInVideoResponse, error) {
+	return c.server.ListVotesInVideo(incoming(ctx), in)
+}
+
+func (c voteClient) ListVotesOfUser(ctx context.Context, in *pb.ListVotesOfUserRequest, opts ...grpc.CallOption) (*pb.ListVotesOfUserResponse, error) {
+	return c.server.ListVotesOfUser(incoming(ctx), in)
+}
+
+func (c voteClient) Insert(ctx context.Context, in *pb.InsertRequest, opts ...grpc.CallOption) (*pb.InsertResponse, error) {
+	return c.server.Insert(incoming(ctx), in)
+}
+
+func (c voteClient) Get(ctx context.Context, in *pb.GetRequest, opts ...grpc.CallOption) (*pb.GetResponse, error) {
+	return c.server.Get(incoming(ctx), in)
+}
+
+func (c voteClient) UpdateOne(ctx context.Context, in *pb.UpdateOneRequest, opts ...grpc.CallOption) (*pb.UpdateOneResponse, error) {
+	return c.server.UpdateOne(incoming(ctx), in)
+}
+
+func (c voteClient) DeleteOne(ctx context.Context, in *pb.DeleteOneRequest, opts ...grpc.CallOption) (*pb.DeleteOneResponse, error) {
+	return c.server.DeleteOne(incoming(ctx), in)
+}
+
+func (c voteClient) BatchInsert(ctx context.Context, in *pb.BatchInsertRequest, opts ...grpc.CallOption) (*pb.BatchInsertResponse, error) {
+	return c.server.BatchInsert(incoming(ctx), in)
+}
+
+func (c voteClient) BatchUpdate(ctx context.Context, in *pb.BatchUpdateRequest, opts ...grpc.CallOption) (*pb.BatchUpdateResponse, error) {
+	return c.server.BatchUpdate(incoming(ctx), in)
+}
+
+func (c voteClient) BatchDelete(ctx context.Context, in *pb.BatchDeleteRequest, opts ...grpc.CallOption) (*pb.BatchDeleteResponse, error) {
+	return c.server.BatchDelete(incoming(ctx), in)
+}
+
+func (c voteClient) GetUserVoteOnVideo(ctx context.Context, in *pb.GetUserVoteOnVideoRequest, opts ...grpc.CallOption) (*pb.GetUserVoteOnVideoResponse, error) {
+	return c.server.GetUserVoteOnVideo(incoming(ctx), in)
+}
+
+func (c voteClient) GetUserVotesOnVideos(ctx context.Context, in *pb.GetUserVotesOnVideosRequest, opts ...grpc.CallOption) (*pb.GetUserVotesOnVideosResponse, error) {
+	return c.server.GetUserVotesOnVideos(incoming(ctx), in)
+}
+
+func (c voteClient) BatchGetVideoTallies(ctx context.Context, in *pb.BatchGetVideoTalliesRequest, opts ...grpc.CallOption) (*pb.BatchGetVideoTalliesResponse, error) {
+	return c.server.BatchGetVideoTallies(incoming(ctx), in)
+}
+
+func (c voteClient) IngestVotes(ctx context.Context, opts ...grpc.CallOption) (pb.Vote_IngestVotesClient, error) {
+	return nil, errStreaming()
+}
+
+func (c voteClient) ExportVotes(ctx context.Context, in *pb.ExportVotesRequest, opts ...grpc.CallOption) (pb.Vote_ExportVotesClient, error) {
+	return nil, errStreaming()
+}
+
+func (c voteClient) ImportVotes(ctx context.Context, opts ...grpc.CallOption) (pb.Vote_ImportVotesClient, error) {
+	return nil, errStreaming()
+}
@@ -0,0 +1,131 @@
+package fake_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/IsaqueB/ps-klever/pkg/grpc_client"
+	"github.com/IsaqueB/ps-klever/pkg/grpc_client/fake"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClient(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	mock_user := primitive.NewObjectID().Hex()
+	c := fake.NewClient()
+	id, err := c.Insert(grpc_client.WithIdempotencyKey(mock_ctx, "key-1"), &pb.VoteStruct{Video: mock_video, User: mock_user, Upvote: true})
+	assert.Nil(t, err)
+	_, err = c.Insert(mock_ctx, &pb.VoteStruct{Video: mock_video, User: mock_user})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err), "An user should have a single vote on a video")
+	_, err = c.Insert(mock_ctx, &pb.VoteStruct{Video: "invalid", User: mock_user})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	matched, modified, err := c.UpdateOne(mock_ctx, id, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), matched)
+	assert.Equal(t, int32(1), modified)
+	vote, err := c.Get(mock_ctx, id)
+	assert.Nil(t, err)
+	assert.False(t, vote.GetUpvote())
+	assert.Equal(t, int64(2), vote.GetVersion())
+	tallies, err := c.BatchGetVideoTallies(mock_ctx, []string{mock_video})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), tallies[mock_video].GetDownvotes())
+
+	deleted, err := c.DeleteOne(mock_ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), deleted)
+	_, err = c.Get(mock_ctx, id)
+	assert.Equal(t, codes.NotFound, status.Code(err), "Deleted votes should not be found")
+	assert.Len(t, c.Server.Votes(), 1, "Deletes should be soft")
+
+	calls := c.Server.Calls("Insert")
+	assert.Len(t, calls, 3)
+	assert.Equal(t, mock_video, calls[0].Request.(*pb.InsertRequest).GetVote().GetVideo())
+	assert.Equal(t, []string{"key-1"}, calls[0].Metadata.Get("idempotency-key"))
+}
+
+func TestCastVote(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	mock_user := primitive.NewObjectID().Hex()
+	c := fake.NewClient()
+	response, err := c.CastVote(mock_ctx, mock_video, mock_user, pb.Direction_DIRECTION_UP)
+	assert.Nil(t, err)
+	assert.Equal(t, pb.CastAction_CAST_INSERTED, response.GetAction())
+	response, _ = c.CastVote(mock_ctx, mock_video, mock_user, pb.Direction_DIRECTION_DOWN)
+	assert.Equal(t, pb.CastAction_CAST_FLIPPED, response.GetAction())
+	assert.Equal(t, int64(1), response.GetTally().GetDownvotes())
+	response, _ = c.CastVote(mock_ctx, mock_video, mock_user, pb.Direction_DIRECTION_NONE)
+	assert.Equal(t, pb.CastAction_CAST_RETRACTED, response.GetAction())
+	assert.Nil(t, response.GetVote())
+	userVote, err := c.GetUserVoteOnVideo(mock_ctx, mock_video, mock_user)
+	assert.Nil(t, err)
+	assert.Equal(t, pb.Direction_DIRECTION_NONE, userVote.GetDirection())
+}
+
+func TestErrorInjection(t *testing.T) {
+	mock_ctx := context.Background()
+	id := primitive.NewObjectID().Hex()
+	c := fake.NewClient()
+	c.Server.Seed(&pb.VoteStruct{Id: id, Video: primitive.NewObjectID().Hex(), User: primitive.NewObjectID().Hex(), Version: 1})
+	unavailable := status.Error(codes.Unavailable, "server unavailable")
+	c.Server.FailNext("Get", unavailable)
+	_, err := c.Get(mock_ctx, id)
+	assert.Equal(t, unavailable, err)
+	_, err = c.Get(mock_ctx, id)
+	assert.Nil(t, err, "FailNext should only fail the next call")
+
+	c.Server.SetError("Get", unavailable)
+	_, err = c.Get(mock_ctx, id)
+	assert.Equal(t, unavailable, err)
+	_, err = c.Get(mock_ctx, id)
+	assert.Equal(t, unavailable, err, "SetError should fail every call")
+	c.Server.SetError("Get", nil)
+	_, err = c.Get(mock_ctx, id)
+	assert.Nil(t, err)
+}
+
+func TestDial(t *testing.T) {
+	mock_ctx := context.Background()
+	mock_video := primitive.NewObjectID().Hex()
+	server := fake.NewServer()
+	c, stop, err := fake.Dial(server)
+	if err != nil {
+		t.Fatalf("Error dialing. %v", err)
+	}
+	defer stop()
+
+	// the client retries Get while the server is unavailable
+	server.FailNext("Get", status.Error(codes.Unavailable, "server unavailable"))
+	ids := server.Seed(&pb.VoteStruct{Video: mock_video, User: primitive.NewObjectID().Hex(), Upvote: true, Version: 1})
+	vote, err := c.Get(mock_ctx, ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, mock_video, vote.GetVideo())
+	assert.Len(t, server.Calls("Get"), 2)
+
+	file := "video,user,upvote\n" + mock_video + "," + primitive.NewObjectID().Hex() + ",false\n" + mock_video + ",invalid,true\n"
+	var failures []*pb.BatchItemResult
+	summary, err := c.ImportVotes(mock_ctx, pb.ExportFormat_EXPORT_FORMAT_CSV, false, strings.NewReader(file), func(failure *pb.BatchItemResult) error {
+		failures = append(failures, failure)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), summary.GetInserted())
+	assert.Equal(t, int32(1), summary.GetFailed())
+	assert.Equal(t, int32(3), failures[0].GetIndex())
+
+	var exported []string
+	err = c.ExportVotes(mock_ctx, &pb.ExportVotesRequest{Video: mock_video, Format: pb.ExportFormat_EXPORT_FORMAT_NDJSON}, func(chunk *pb.ExportVotesResponse) error {
+		exported = append(exported, strings.Split(strings.TrimSpace(string(chunk.Data)), "\n")...)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Len(t, exported, 2)
+}
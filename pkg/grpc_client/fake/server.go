@@ -0,0 +1,499 @@
+// Package fake is an in-memory Vote service for the unit tests of code using pkg/grpc_client,
+// which then don't need the real server nor MongoDB. Client answers without gRPC, and Dial serves
+// it with a real gRPC server listening in memory
+package fake
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Request received by the server, with the metadata it was sent with
+type Call struct {
+	// name of the RPC, such as "Insert"
+	Method   string
+	Request  proto.Message
+	Metadata metadata.MD
+}
+
+// Vote service keeping the votes in memory. It applies the same rules as the real one: ids must be
+// valid, an user has a single vote on a video, deletes are soft and versions are checked.
+// Every request is recorded, and errors can be injected by method
+type Server struct {
+	pb.UnimplementedVoteServer
+	mutex sync.Mutex
+	votes map[string]*pb.VoteStruct
+	calls []Call
+	// errors returned by every call of the method, and by its next calls
+	errs     map[string]error
+	nextErrs map[string][]error
+}
+
+func NewServer() *Server {
+	return &Server{
+		votes:    map[string]*pb.VoteStruct{},
+		errs:     map[string]error{},
+		nextErrs: map[string][]error{},
+	}
+}
+
+// Makes every call of the method fail with err, until it is set to nil
+func (s *Server) SetError(method string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err == nil {
+		delete(s.errs, method)
+		return
+	}
+	s.errs[method] = err
+}
+
+// Makes the next calls of the method fail with the errors, one for each call, before the
+// error set by SetError
+func (s *Server) FailNext(method string, errs ...error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nextErrs[method] = append(s.nextErrs[method], errs...)
+}
+
+// Requests received by the method, in order, or by every method if it is empty
+func (s *Server) Calls(method string) []Call {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var calls []Call
+	for _, call := range s.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Adds votes to the store as they are, such as votes already deleted or with a given version.
+// Votes without id get a new one. Returns the ids of the votes
+func (s *Server) Seed(votes ...*pb.VoteStruct) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ids := make([]string, len(votes))
+	for i, vote := range votes {
+		vote = proto.Clone(vote).(*pb.VoteStruct)
+		if vote.Id == "" {
+			vote.Id = primitive.NewObjectID().Hex()
+		}
+		s.votes[vote.Id] = vote
+		ids[i] = vote.Id
+	}
+	return ids
+}
+
+// Every vote stored, including the deleted ones, in the order of their ids
+func (s *Server) Votes() []*pb.VoteStruct {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.find(func(vote *pb.VoteStruct) bool { return true })
+}
+
+// Deletes every vote, call and error
+func (s *Server) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.votes = map[string]*pb.VoteStruct{}
+	s.calls = nil
+	s.errs = map[string]error{}
+	s.nextErrs = map[string][]error{}
+}
+
+// Records the call and returns the error injected for it. The caller must hold the mutex
+func (s *Server) call(ctx context.Context, method string, req proto.Message) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.calls = append(s.calls, Call{Method: method, Request: proto.Clone(req), Metadata: md.Copy()})
+	if next := s.nextErrs[method]; len(next) > 0 {
+		s.nextErrs[method] = next[1:]
+		return next[0]
+	}
+	return s.errs[method]
+}
+
+func validID(id string, name string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return status.Errorf(codes.InvalidArgument, "Invalid %s %q", name, id)
+	}
+	return nil
+}
+
+func notFound() error {
+	return status.Error(codes.NotFound, "Could not find the vote requested")
+}
+
+// Votes matching, in the order of their ids. The caller must hold the mutex
+func (s *Server) find(match func(vote *pb.VoteStruct) bool) []*pb.VoteStruct {
+	var votes []*pb.VoteStruct
+	for _, vote := range s.votes {
+		if match(vote) {
+			votes = append(votes, proto.Clone(vote).(*pb.VoteStruct))
+		}
+	}
+	sort.Slice(votes, func(i, j int) bool { return votes[i].Id < votes[j].Id })
+	return votes
+}
+
+// Vote of the user on the video which isn't deleted, nil if there is none
+func (s *Server) current(video string, user string) *pb.VoteStruct {
+	for _, vote := range s.votes {
+		if vote.Video == video && vote.User == user && vote.DeletedAt == nil {
+			return vote
+		}
+	}
+	return nil
+}
+
+func (s *Server) live(id string) (*pb.VoteStruct, error) {
+	if err := validID(id, "id"); err != nil {
+		return nil, err
+	}
+	vote, ok := s.votes[id]
+	if !ok || vote.DeletedAt != nil {
+		return nil, notFound()
+	}
+	return vote, nil
+}
+
+func checkVersion(vote *pb.VoteStruct, expected int64) error {
+	if expected != 0 && expected != vote.Version {
+		return status.Error(codes.FailedPrecondition, "the version of the vote is not the one expected")
+	}
+	return nil
+}
+
+func (s *Server) insert(vote *pb.VoteStruct) (*pb.VoteStruct, error) {
+	if err := validID(vote.GetVideo(), "video"); err != nil {
+		return nil, err
+	}
+	if err := validID(vote.GetUser(), "user"); err != nil {
+		return nil, err
+	}
+	if s.current(vote.Video, vote.User) != nil {
+		return nil, status.Error(codes.AlreadyExists, "The user already has a vote on the video")
+	}
+	now := timestamppb.Now()
+	stored := &pb.VoteStruct{
+		Id:        primitive.NewObjectID().Hex(),
+		Video:     vote.Video,
+		User:      vote.User,
+		Upvote:    vote.Upvote,
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.votes[stored.Id] = stored
+	return stored, nil
+}
+
+func (s *Server) update(req *pb.UpdateOneRequest) (*pb.UpdateOneResponse, error) {
+	vote, err := s.live(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(vote, req.GetExpectedVersion()); err != nil {
+		return nil, err
+	}
+	response := &pb.UpdateOneResponse{Matched: 1}
+	if vote.Upvote != req.GetNewValue() {
+		vote.Upvote = req.GetNewValue()
+		vote.Version++
+		vote.UpdatedAt = timestamppb.Now()
+		response.Modified = 1
+	}
+	response.Version = vote.Version
+	return response, nil
+}
+
+func (s *Server) delete(id string, expectedVersion int64) error {
+	vote, err := s.live(id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(vote, expectedVersion); err != nil {
+		return err
+	}
+	now := timestamppb.Now()
+	vote.DeletedAt = now
+	vote.UpdatedAt = now
+	vote.Version++
+	return nil
+}
+
+func (s *Server) tally(video string) *pb.VideoTally {
+	tally := &pb.VideoTally{Video: video}
+	for _, vote := range s.votes {
+		if vote.Video != video || vote.DeletedAt != nil || vote.InvalidatedAt != nil {
+			continue
+		}
+		if vote.Upvote {
+			tally.Upvotes++
+		} else {
+			tally.Downvotes++
+		}
+	}
+	return tally
+}
+
+func (s *Server) userVote(video string, user string) *pb.UserVote {
+	userVote := &pb.UserVote{Video: video}
+	if vote := s.current(video, user); vote != nil {
+		userVote.Vote = proto.Clone(vote).(*pb.VoteStruct)
+		userVote.Direction = direction(vote)
+	}
+	return userVote
+}
+
+func direction(vote *pb.VoteStruct) pb.Direction {
+	if vote == nil || vote.DeletedAt != nil {
+		return pb.Direction_DIRECTION_NONE
+	}
+	if vote.Upvote {
+		return pb.Direction_DIRECTION_UP
+	}
+	return pb.Direction_DIRECTION_DOWN
+}
+
+// Error of the items of an ordered batch after one which failed
+var errNotExecuted = status.Error(codes.Aborted, "not executed since a previous write of the ordered batch failed")
+
+func itemResult(index int, id string, err error) *pb.BatchItemResult {
+	result := &pb.BatchItemResult{Index: int32(index), Id: id}
+	if err != nil {
+		st := status.Convert(err)
+		result.Code = int32(st.Code())
+		result.Message = st.Message()
+	}
+	return result
+}
+
+func (s *Server) CastVote(ctx context.Context, req *pb.CastVoteRequest) (*pb.CastVoteResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "CastVote", req); err != nil {
+		return nil, err
+	}
+	if err := validID(req.GetVideo(), "video"); err != nil {
+		return nil, err
+	}
+	if err := validID(req.GetUser(), "user"); err != nil {
+		return nil, err
+	}
+	vote := s.current(req.Video, req.User)
+	response := &pb.CastVoteResponse{Direction: req.Direction, Action: pb.CastAction_CAST_UNCHANGED}
+	switch {
+	case req.Direction == pb.Direction_DIRECTION_NONE:
+		if vote != nil {
+			s.delete(vote.Id, 0)
+			response.Action = pb.CastAction_CAST_RETRACTED
+			vote = nil
+		}
+	case vote == nil:
+		vote, _ = s.insert(&pb.VoteStruct{Video: req.Video, User: req.User, Upvote: req.Direction == pb.Direction_DIRECTION_UP})
+		response.Action = pb.CastAction_CAST_INSERTED
+	case direction(vote) != req.Direction:
+		s.update(&pb.UpdateOneRequest{Id: vote.Id, NewValue: req.Direction == pb.Direction_DIRECTION_UP})
+		response.Action = pb.CastAction_CAST_FLIPPED
+	}
+	if vote != nil {
+		response.Vote = proto.Clone(vote).(*pb.VoteStruct)
+	}
+	response.Tally = s.tally(req.Video)
+	return response, nil
+}
+
+func (s *Server) ListVotesInVideo(ctx context.Context, req *pb.ListVotesInVideoRequest) (*pb.ListVotesInVideoResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "ListVotesInVideo", req); err != nil {
+		return nil, err
+	}
+	if err := validID(req.GetId(), "video"); err != nil {
+		return nil, err
+	}
+	votes := s.find(func(vote *pb.VoteStruct) bool { return vote.Video == req.Id && vote.DeletedAt == nil })
+	return &pb.ListVotesInVideoResponse{Vote: votes}, nil
+}
+
+func (s *Server) ListVotesOfUser(ctx context.Context, req *pb.ListVotesOfUserRequest) (*pb.ListVotesOfUserResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "ListVotesOfUser", req); err != nil {
+		return nil, err
+	}
+	if err := validID(req.GetId(), "user"); err != nil {
+		return nil, err
+	}
+	votes := s.find(func(vote *pb.VoteStruct) bool { return vote.User == req.Id && vote.DeletedAt == nil })
+	return &pb.ListVotesOfUserResponse{Vote: votes}, nil
+}
+
+func (s *Server) Insert(ctx context.Context, req *pb.InsertRequest) (*pb.InsertResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "Insert", req); err != nil {
+		return nil, err
+	}
+	vote, err := s.insert(req.GetVote())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.InsertResponse{Id: vote.Id}, nil
+}
+
+func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "Get", req); err != nil {
+		return nil, err
+	}
+	vote, err := s.live(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetResponse{Vote: proto.Clone(vote).(*pb.VoteStruct)}, nil
+}
+
+func (s *Server) UpdateOne(ctx context.Context, req *pb.UpdateOneRequest) (*pb.UpdateOneResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "UpdateOne", req); err != nil {
+		return nil, err
+	}
+	return s.update(req)
+}
+
+func (s *Server) DeleteOne(ctx context.Context, req *pb.DeleteOneRequest) (*pb.DeleteOneResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "DeleteOne", req); err != nil {
+		return nil, err
+	}
+	if err := s.delete(req.GetId(), req.GetExpectedVersion()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteOneResponse{Deleted: 1}, nil
+}
+
+func (s *Server) BatchInsert(ctx context.Context, req *pb.BatchInsertRequest) (*pb.BatchInsertResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "BatchInsert", req); err != nil {
+		return nil, err
+	}
+	response := &pb.BatchInsertResponse{}
+	err := error(nil)
+	for i, vote := range req.GetVote() {
+		if err != nil && req.Ordered {
+			response.Result = append(response.Result, itemResult(i, "", errNotExecuted))
+			continue
+		}
+		var stored *pb.VoteStruct
+		if stored, err = s.insert(vote); err != nil {
+			response.Result = append(response.Result, itemResult(i, "", err))
+			continue
+		}
+		response.Result = append(response.Result, itemResult(i, stored.Id, nil))
+	}
+	return response, nil
+}
+
+func (s *Server) BatchUpdate(ctx context.Context, req *pb.BatchUpdateRequest) (*pb.BatchUpdateResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "BatchUpdate", req); err != nil {
+		return nil, err
+	}
+	response := &pb.BatchUpdateResponse{}
+	err := error(nil)
+	for i, update := range req.GetVote() {
+		if err != nil && req.Ordered {
+			response.Result = append(response.Result, itemResult(i, update.GetId(), errNotExecuted))
+			continue
+		}
+		_, err = s.update(update)
+		response.Result = append(response.Result, itemResult(i, update.GetId(), err))
+	}
+	return response, nil
+}
+
+func (s *Server) BatchDelete(ctx context.Context, req *pb.BatchDeleteRequest) (*pb.BatchDeleteResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "BatchDelete", req); err != nil {
+		return nil, err
+	}
+	response := &pb.BatchDeleteResponse{}
+	err := error(nil)
+	for i, id := range req.GetId() {
+		if err != nil && req.Ordered {
+			response.Result = append(response.Result, itemResult(i, id, errNotExecuted))
+			continue
+		}
+		err = s.delete(id, 0)
+		response.Result = append(response.Result, itemResult(i, id, err))
+	}
+	return response, nil
+}
+
+func (s *Server) GetUserVoteOnVideo(ctx context.Context, req *pb.GetUserVoteOnVideoRequest) (*pb.GetUserVoteOnVideoResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "GetUserVoteOnVideo", req); err != nil {
+		return nil, err
+	}
+	if err := validID(req.GetVideo(), "video"); err != nil {
+		return nil, err
+	}
+	if err := validID(req.GetUser(), "user"); err != nil {
+		return nil, err
+	}
+	return &pb.GetUserVoteOnVideoResponse{Vote: s.userVote(req.Video, req.User)}, nil
+}
+
+func (s *Server) GetUserVotesOnVideos(ctx context.Context, req *pb.GetUserVotesOnVideosRequest) (*pb.GetUserVotesOnVideosResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "GetUserVotesOnVideos", req); err != nil {
+		return nil, err
+	}
+	if err := validID(req.GetUser(), "user"); err != nil {
+		return nil, err
+	}
+	response := &pb.GetUserVotesOnVideosResponse{}
+	for _, video := range req.GetVideo() {
+		if err := validID(video, "video"); err != nil {
+			return nil, err
+		}
+		response.Vote = append(response.Vote, s.userVote(video, req.User))
+	}
+	return response, nil
+}
+
+func (s *Server) BatchGetVideoTallies(ctx context.Context, req *pb.BatchGetVideoTalliesRequest) (*pb.BatchGetVideoTalliesResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(ctx, "BatchGetVideoTallies", req); err != nil {
+		return nil, err
+	}
+	response := &pb.BatchGetVideoTalliesResponse{Tallies: map[string]*pb.VideoTally{}}
+	for _, video := range req.GetVideo() {
+		if err := validID(video, "video"); err != nil {
+			return nil, err
+		}
+		response.Tallies[video] = s.tally(video)
+	}
+	return response, nil
+}
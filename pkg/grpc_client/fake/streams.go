@@ -0,0 +1,238 @@
+package fake
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Same as the chunks of the real server
+const EXPORT_CHUNK_SIZE = 500
+
+func (s *Server) IngestVotes(stream pb.Vote_IngestVotesServer) error {
+	response := &pb.IngestVotesResponse{}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(response)
+		}
+		if err != nil {
+			return err
+		}
+		s.mutex.Lock()
+		if err := s.call(stream.Context(), "IngestVotes", req); err != nil {
+			s.mutex.Unlock()
+			return err
+		}
+		if _, err := s.insert(req.GetVote()); err != nil {
+			response.Failed++
+			response.Failure = append(response.Failure, itemResult(int(response.Received), "", err))
+		} else {
+			response.Inserted++
+		}
+		s.mutex.Unlock()
+		response.Received++
+	}
+}
+
+func (s *Server) ExportVotes(req *pb.ExportVotesRequest, stream pb.Vote_ExportVotesServer) error {
+	s.mutex.Lock()
+	if err := s.call(stream.Context(), "ExportVotes", req); err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	votes := s.find(func(vote *pb.VoteStruct) bool {
+		created := vote.GetCreatedAt().AsTime()
+		return vote.DeletedAt == nil &&
+			(req.Video == "" || vote.Video == req.Video) &&
+			(req.User == "" || vote.User == req.User) &&
+			(req.CreatedFrom == nil || !created.Before(req.CreatedFrom.AsTime())) &&
+			(req.CreatedTo == nil || created.Before(req.CreatedTo.AsTime())) &&
+			(req.Direction == pb.Direction_DIRECTION_NONE || direction(vote) == req.Direction) &&
+			vote.Id > req.Cursor
+	})
+	s.mutex.Unlock()
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	if req.Format == pb.ExportFormat_EXPORT_FORMAT_CSV && req.Cursor == "" {
+		writer.Write([]string{"id", "video", "user", "upvote", "version", "created_at", "updated_at"})
+	}
+	chunk := &pb.ExportVotesResponse{Cursor: req.Cursor}
+	for i, vote := range votes {
+		if req.Format == pb.ExportFormat_EXPORT_FORMAT_NDJSON {
+			line, _ := protojson.Marshal(vote)
+			buffer.Write(append(line, '\n'))
+		} else {
+			writer.Write([]string{
+				vote.Id,
+				vote.Video,
+				vote.User,
+				strconv.FormatBool(vote.Upvote),
+				strconv.FormatInt(vote.Version, 10),
+				formatTime(vote.CreatedAt.AsTime()),
+				formatTime(vote.UpdatedAt.AsTime()),
+			})
+			writer.Flush()
+		}
+		chunk.Votes++
+		chunk.Cursor = vote.Id
+		if chunk.Votes == EXPORT_CHUNK_SIZE || i == len(votes)-1 {
+			chunk.Data = buffer.Bytes()
+			if err := stream.Send(chunk); err != nil {
+				return err
+			}
+			buffer.Reset()
+			chunk = &pb.ExportVotesResponse{Cursor: chunk.Cursor}
+		}
+	}
+	writer.Flush()
+	if buffer.Len() > 0 {
+		return stream.Send(&pb.ExportVotesResponse{Data: buffer.Bytes(), Cursor: req.Cursor})
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// Reads the whole file, then imports it line by line, as the real server does in bulk
+func (s *Server) ImportVotes(stream pb.Vote_ImportVotesServer) error {
+	var first *pb.ImportVotesRequest
+	var file []byte
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first = req
+		}
+		file = append(file, req.GetData()...)
+	}
+	if first == nil {
+		return status.Error(codes.InvalidArgument, "The file is empty")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.call(stream.Context(), "ImportVotes", first); err != nil {
+		return err
+	}
+	lines, votes, errs, err := parseFile(first.Format, file)
+	if err != nil {
+		return err
+	}
+	summary := &pb.ImportVotesSummary{DryRun: first.DryRun, Lines: int32(len(lines))}
+	response := &pb.ImportVotesResponse{}
+	seen := map[[2]string]int{}
+	for i, vote := range votes {
+		err := errs[i]
+		if err == nil {
+			err = validID(vote.GetVideo(), "video")
+		}
+		if err == nil {
+			err = validID(vote.GetUser(), "user")
+		}
+		if previous, ok := seen[[2]string{vote.GetVideo(), vote.GetUser()}]; err == nil && ok {
+			err = status.Errorf(codes.AlreadyExists, "The user already has a vote on the video in line %d", previous)
+		}
+		if err != nil {
+			summary.Failed++
+			response.Failure = append(response.Failure, itemResult(lines[i], "", err))
+			continue
+		}
+		seen[[2]string{vote.Video, vote.User}] = lines[i]
+		current := s.current(vote.Video, vote.User)
+		switch {
+		case current == nil:
+			summary.Inserted++
+			if !first.DryRun {
+				s.insert(vote)
+			}
+		case current.Upvote != vote.Upvote:
+			summary.Updated++
+			if !first.DryRun {
+				s.update(&pb.UpdateOneRequest{Id: current.Id, NewValue: vote.Upvote})
+			}
+		default:
+			summary.Unchanged++
+		}
+	}
+	if len(response.Failure) > 0 {
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+	return stream.Send(&pb.ImportVotesResponse{Summary: summary})
+}
+
+// Parses the lines of an imported file, returning the number of each line, its vote and its error
+func parseFile(format pb.ExportFormat, file []byte) ([]int, []*pb.VoteStruct, []error, error) {
+	var lines []int
+	var votes []*pb.VoteStruct
+	var errs []error
+	add := func(line int, vote *pb.VoteStruct, err error) {
+		lines = append(lines, line)
+		votes = append(votes, vote)
+		errs = append(errs, err)
+	}
+	if format == pb.ExportFormat_EXPORT_FORMAT_NDJSON {
+		for i, line := range strings.Split(string(file), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			vote := &pb.VoteStruct{}
+			err := protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal([]byte(line), vote)
+			if err != nil {
+				err = status.Error(codes.InvalidArgument, err.Error())
+			}
+			add(i+1, vote, err)
+		}
+		return lines, votes, errs, nil
+	}
+	reader := csv.NewReader(bytes.NewReader(file))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if len(records) == 0 {
+		return nil, nil, nil, status.Error(codes.InvalidArgument, "The file is empty")
+	}
+	columns := map[string]int{}
+	for i, column := range records[0] {
+		columns[strings.TrimSpace(column)] = i
+	}
+	for _, name := range []string{"video", "user", "upvote"} {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, nil, status.Errorf(codes.InvalidArgument, "The header of the file has no %s column", name)
+		}
+	}
+	for i, record := range records[1:] {
+		// unlike the real server, a quoted field spanning lines counts as a single line
+		line := i + 2
+		field := func(name string) string {
+			if columns[name] >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[columns[name]])
+		}
+		upvote, err := strconv.ParseBool(field("upvote"))
+		if err != nil {
+			err = status.Errorf(codes.InvalidArgument, "Invalid upvote %q", field("upvote"))
+		}
+		add(line, &pb.VoteStruct{Video: field("video"), User: field("user"), Upvote: upvote}, err)
+	}
+	return lines, votes, errs, nil
+}
@@ -0,0 +1,175 @@
+package grpc_client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// Load balancing policies. Round robin spreads the calls over every address of the endpoints,
+	// pick first sends them all to the first address reachable
+	ROUND_ROBIN = "round_robin"
+	PICK_FIRST  = "pick_first"
+
+	// Deadline of the unary calls made with a context without one
+	DEFAULT_TIMEOUT = 10 * time.Second
+
+	DEFAULT_RETRY_ATTEMPTS        = 3
+	DEFAULT_RETRY_INITIAL_BACKOFF = 100 * time.Millisecond
+	DEFAULT_RETRY_MAX_BACKOFF     = time.Second
+
+	// Pings sent on idle connections, so broken ones are found before a call is made on them. The
+	// server must allow pings this frequent
+	DEFAULT_KEEPALIVE_TIME    = 30 * time.Second
+	DEFAULT_KEEPALIVE_TIMEOUT = 10 * time.Second
+)
+
+// Calls retried when the server is unavailable, since repeating them is safe. Insert, UpdateOne
+// and DeleteOne are only safe with an idempotency key, so they are never retried
+var idempotentMethods = []methodName{
+	{"proto.Vote", "CastVote"},
+	{"proto.Vote", "Get"},
+	{"proto.Vote", "ListVotesInVideo"},
+	{"proto.Vote", "ListVotesOfUser"},
+	{"proto.Vote", "GetUserVoteOnVideo"},
+	{"proto.Vote", "GetUserVotesOnVideos"},
+	{"proto.Vote", "BatchGetVideoTallies"},
+	{"proto.Admin", "ListVotes"},
+	{"proto.Admin", "GetCacheStats"},
+	{"proto.Admin", "GetWriteBehindStats"},
+}
+
+type config struct {
+	creds            credentials.TransportCredentials
+	balancing        string
+	timeout          time.Duration
+	retryAttempts    int
+	initialBackoff   time.Duration
+	maxBackoff       time.Duration
+	keepaliveTime    time.Duration
+	keepaliveTimeout time.Duration
+	batchSize        int
+	dialOptions      []grpc.DialOption
+}
+
+func defaultConfig() config {
+	return config{
+		balancing:        ROUND_ROBIN,
+		timeout:          DEFAULT_TIMEOUT,
+		retryAttempts:    DEFAULT_RETRY_ATTEMPTS,
+		initialBackoff:   DEFAULT_RETRY_INITIAL_BACKOFF,
+		maxBackoff:       DEFAULT_RETRY_MAX_BACKOFF,
+		keepaliveTime:    DEFAULT_KEEPALIVE_TIME,
+		keepaliveTimeout: DEFAULT_KEEPALIVE_TIMEOUT,
+		batchSize:        DEFAULT_BATCH_SIZE,
+	}
+}
+
+// Configures the client built by New
+type Option func(c *config)
+
+// Connect over TLS, such as with the credentials built by credentials.NewTLS. Without it the
+// connection is insecure
+func WithTransportCredentials(creds credentials.TransportCredentials) Option {
+	return func(c *config) {
+		c.creds = creds
+	}
+}
+
+// Set the load balancing policy, ROUND_ROBIN or PICK_FIRST
+func WithBalancing(policy string) Option {
+	return func(c *config) {
+		c.balancing = policy
+	}
+}
+
+// Set the deadline of the unary calls made with a context without one. Zero disables it
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeout = timeout
+	}
+}
+
+// Set how many times the idempotent calls are attempted while the server is unavailable, waiting
+// a random backoff between attempts which doubles from initialBackoff up to maxBackoff.
+// One attempt disables retries
+func WithRetry(attempts int, initialBackoff time.Duration, maxBackoff time.Duration) Option {
+	return func(c *config) {
+		c.retryAttempts = attempts
+		c.initialBackoff = initialBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// Set how long an idle connection waits before pinging the server, and for the answer before
+// closing the connection. A zero time disables the pings
+func WithKeepalive(time time.Duration, timeout time.Duration) Option {
+	return func(c *config) {
+		c.keepaliveTime = time
+		c.keepaliveTimeout = timeout
+	}
+}
+
+// Set how many items are sent in each request of the batch methods, as SetBatchSize
+func WithBatchSize(size int) Option {
+	return func(c *config) {
+		c.batchSize = size
+	}
+}
+
+// Add options to the ones used to dial the servers, such as interceptors
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *config) {
+		c.dialOptions = append(c.dialOptions, opts...)
+	}
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+	MethodConfig        []methodConfig        `json:"methodConfig,omitempty"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%gs", d.Seconds())
+}
+
+// Service config of the connection, in the JSON format of gRPC, with the balancing policy and
+// the retry policy of the idempotent methods
+func (c config) serviceConfig() (string, error) {
+	sc := serviceConfig{LoadBalancingConfig: []map[string]struct{}{{c.balancing: {}}}}
+	if c.retryAttempts > 1 {
+		method := methodConfig{RetryPolicy: &retryPolicy{
+			MaxAttempts:          c.retryAttempts,
+			InitialBackoff:       seconds(c.initialBackoff),
+			MaxBackoff:           seconds(c.maxBackoff),
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: []string{"UNAVAILABLE"},
+		}}
+		method.Name = idempotentMethods
+		sc.MethodConfig = []methodConfig{method}
+	}
+	content, err := json.Marshal(sc)
+	return string(content), err
+}
@@ -0,0 +1,136 @@
+package grpc_client_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/grpc_client"
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Fails the first calls with codes.Unavailable, and counts the calls of each method
+type flakyVoteServer struct {
+	pb.UnimplementedVoteServer
+	mutex    sync.Mutex
+	failures int
+	calls    map[string]int
+	delay    time.Duration
+}
+
+func (s *flakyVoteServer) call(ctx context.Context, method string) error {
+	s.mutex.Lock()
+	s.calls[method]++
+	failing := s.failures > 0
+	s.failures--
+	s.mutex.Unlock()
+	if failing {
+		return status.Error(codes.Unavailable, "server unavailable")
+	}
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *flakyVoteServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	if err := s.call(ctx, "Get"); err != nil {
+		return nil, err
+	}
+	return &pb.GetResponse{Vote: &pb.VoteStruct{Id: req.GetId()}}, nil
+}
+
+func (s *flakyVoteServer) Insert(ctx context.Context, req *pb.InsertRequest) (*pb.InsertResponse, error) {
+	if err := s.call(ctx, "Insert"); err != nil {
+		return nil, err
+	}
+	return &pb.InsertResponse{}, nil
+}
+
+func (s *flakyVoteServer) count(method string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.calls[method]
+}
+
+func startFlakyServer(t *testing.T, failures int, delay time.Duration) (*flakyVoteServer, string) {
+	fake := &flakyVoteServer{failures: failures, calls: map[string]int{}, delay: delay}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening. %v", err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterVoteServer(server, fake)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return fake, lis.Addr().String()
+}
+
+func TestRetry(t *testing.T) {
+	retry := grpc_client.WithRetry(3, time.Millisecond, 10*time.Millisecond)
+	fake, address := startFlakyServer(t, 2, 0)
+	c, err := grpc_client.New([]string{address}, retry)
+	if err != nil {
+		t.Fatalf("Error creating client. %v", err)
+	}
+	defer c.Disconnect()
+	vote, err := c.Get(context.Background(), "vote-1")
+	assert.Nil(t, err, "Get should be retried until it succeeds")
+	assert.Equal(t, "vote-1", vote.GetId())
+	assert.Equal(t, 3, fake.count("Get"))
+
+	fake, address = startFlakyServer(t, 1, 0)
+	c, err = grpc_client.New([]string{address}, retry)
+	if err != nil {
+		t.Fatalf("Error creating client. %v", err)
+	}
+	defer c.Disconnect()
+	_, err = c.Insert(context.Background(), &pb.VoteStruct{})
+	assert.Equal(t, codes.Unavailable, status.Code(err), "Insert isn't idempotent, so it shouldn't be retried")
+	assert.Equal(t, 1, fake.count("Insert"))
+}
+
+func TestTimeout(t *testing.T) {
+	_, address := startFlakyServer(t, 0, time.Second)
+	c, err := grpc_client.New([]string{address}, grpc_client.WithTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Error creating client. %v", err)
+	}
+	defer c.Disconnect()
+	_, err = c.Get(context.Background(), "vote-1")
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err), "Calls without a deadline should get the default one")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = c.Get(ctx, "vote-1")
+	assert.Nil(t, err, "The deadline of the context should be kept")
+}
+
+func TestRoundRobin(t *testing.T) {
+	first, first_address := startFlakyServer(t, 0, 0)
+	second, second_address := startFlakyServer(t, 0, 0)
+	c, err := grpc_client.New([]string{first_address, second_address})
+	if err != nil {
+		t.Fatalf("Error creating client. %v", err)
+	}
+	defer c.Disconnect()
+	for i := 0; i < 10; i++ {
+		if _, err := c.Get(context.Background(), "vote-1"); err != nil {
+			t.Fatalf("Error in Get. %v", err)
+		}
+	}
+	assert.Equal(t, 10, first.count("Get")+second.count("Get"))
+	assert.NotZero(t, first.count("Get"), "The calls should be spread over the endpoints")
+	assert.NotZero(t, second.count("Get"))
+
+	_, err = grpc_client.New(nil)
+	assert.ErrorIs(t, err, grpc_client.ErrNoEndpoints)
+}
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	DEFAULT_CHECK_TIMEOUT  = 2 * time.Second
+	DEFAULT_CHECK_INTERVAL = 10 * time.Second
+)
+
+var ErrShuttingDown = errors.New("shutting down")
+
+// Checks whether the API can serve requests by pinging its dependencies, and publishes the result in
+// the grpc.health.v1 service and on the HTTP readiness endpoint. Once shut down it stays NOT_SERVING,
+// so load balancers stop sending requests before the servers stop
+type Checker struct {
+	server   *health.Server
+	ping     func(ctx context.Context) error
+	timeout  time.Duration
+	services []string
+	shutdown int32
+}
+
+// Creates a checker calling ping with timeout. Besides the overall status, the status of each
+// service given, such as "proto.Vote", is published. Everything is NOT_SERVING until the first check
+func NewChecker(ping func(ctx context.Context) error, timeout time.Duration, services ...string) *Checker {
+	c := &Checker{
+		server:   health.NewServer(),
+		ping:     ping,
+		timeout:  timeout,
+		services: append([]string{""}, services...),
+	}
+	c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	return c
+}
+
+// Server of the grpc.health.v1 service, to be registered on the gRPC server
+func (c *Checker) Server() healthpb.HealthServer {
+	return c.server
+}
+
+func (c *Checker) setStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range c.services {
+		c.server.SetServingStatus(service, status)
+	}
+}
+
+// Pings the dependencies and updates the status of every service. Returns why it is not serving
+func (c *Checker) Check(ctx context.Context) error {
+	if atomic.LoadInt32(&c.shutdown) == 1 {
+		return ErrShuttingDown
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	err := c.ping(ctx)
+	// the health server ignores updates once shut down
+	if err != nil {
+		c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	} else {
+		c.setStatus(healthpb.HealthCheckResponse_SERVING)
+	}
+	return err
+}
+
+// Checks every interval until the context is cancelled, so the gRPC status follows the dependencies.
+// A non-positive interval checks every DEFAULT_CHECK_INTERVAL
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DEFAULT_CHECK_INTERVAL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sets every service NOT_SERVING for good, called when the graceful shutdown starts
+func (c *Checker) Shutdown() {
+	atomic.StoreInt32(&c.shutdown, 1)
+	c.server.Shutdown()
+}
+
+type statusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func writeStatus(w http.ResponseWriter, code int, response statusResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Liveness endpoint, answers while the process is able to handle requests at all
+func Liveness(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	writeStatus(w, http.StatusOK, statusResponse{Status: healthpb.HealthCheckResponse_SERVING.String()})
+}
+
+// Readiness endpoint, pings the dependencies and answers 503 if they can't be reached or the
+// server is shutting down
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	if err := c.Check(r.Context()); err != nil {
+		writeStatus(w, http.StatusServiceUnavailable, statusResponse{
+			Status: healthpb.HealthCheckResponse_NOT_SERVING.String(),
+			Error:  err.Error(),
+		})
+		return
+	}
+	writeStatus(w, http.StatusOK, statusResponse{Status: healthpb.HealthCheckResponse_SERVING.String()})
+}
@@ -0,0 +1,66 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/health"
+	"github.com/stretchr/testify/assert"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func servingStatus(t *testing.T, checker *health.Checker, service string) healthpb.HealthCheckResponse_ServingStatus {
+	response, err := checker.Server().Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("Error checking %q. %v", service, err)
+	}
+	return response.Status
+}
+
+func readiness(checker *health.Checker) int {
+	w := httptest.NewRecorder()
+	checker.Readiness(w, httptest.NewRequest(http.MethodGet, "/readyz", nil), nil)
+	return w.Code
+}
+
+func TestChecker(t *testing.T) {
+	var pingErr error
+	checker := health.NewChecker(func(ctx context.Context) error {
+		return pingErr
+	}, time.Second, "proto.Vote")
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, checker, ""), "Nothing should be served before the first check")
+	assert.Nil(t, checker.Check(context.Background()))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, servingStatus(t, checker, ""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, servingStatus(t, checker, "proto.Vote"))
+	assert.Equal(t, http.StatusOK, readiness(checker))
+
+	pingErr = errors.New("unreachable")
+	assert.Equal(t, http.StatusServiceUnavailable, readiness(checker))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, checker, "proto.Vote"))
+
+	pingErr = nil
+	assert.Equal(t, http.StatusOK, readiness(checker))
+	checker.Shutdown()
+	assert.Equal(t, http.StatusServiceUnavailable, readiness(checker), "Shutting down should stop being ready")
+	assert.Equal(t, health.ErrShuttingDown, checker.Check(context.Background()))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, checker, "proto.Vote"))
+}
+
+func TestCheckTimeout(t *testing.T) {
+	checker := health.NewChecker(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 10*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, checker.Check(context.Background()), "A ping which hangs should time out")
+}
+
+func TestLiveness(t *testing.T) {
+	w := httptest.NewRecorder()
+	health.Liveness(w, httptest.NewRequest(http.MethodGet, "/healthz", nil), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"SERVING"}`, w.Body.String())
+}
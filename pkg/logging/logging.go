@@ -0,0 +1,201 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Header with the id of a request, taken from the caller if sent or else generated, and
+	// answered in the response
+	REQUEST_ID_HEADER = "X-Request-Id"
+	// Metadata key of the request id, the gateway forwards the header with it
+	REQUEST_ID_METADATA_KEY = "x-request-id"
+
+	DEFAULT_LEVEL = "info"
+)
+
+type requestIDKey struct{}
+
+// Creates a logger writing JSON lines to the standard error, from level on: debug, info, warn or error
+func New(level string) (*zap.Logger, error) {
+	var zapLevel zapcore.Level
+	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	config := zap.NewProductionConfig()
+	config.Level = zap.NewAtomicLevelAt(zapLevel)
+	config.EncoderConfig.TimeKey = "time"
+	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	// log lines are not sampled, so access logs are complete
+	config.Sampling = nil
+	return config.Build()
+}
+
+// Creates the logger with the level in LOG_LEVEL, info if it is not set
+func NewFromEnv() (*zap.Logger, error) {
+	level := os.Getenv("LOG_LEVEL")
+	if level == "" {
+		level = DEFAULT_LEVEL
+	}
+	return New(level)
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+func NewContext(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestId)
+}
+
+// Id of the request being handled, empty outside of requests
+func RequestID(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIDKey{}).(string)
+	return requestId
+}
+
+// Adds the id of the request to every line of the logger, if ctx belongs to one
+func WithRequest(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if requestId := RequestID(ctx); requestId != "" {
+		return logger.With(zap.String("request_id", requestId))
+	}
+	return logger
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Takes the request id from the metadata or generates one, sends it back in the header and logs the RPC
+func serverCall(ctx context.Context, logger *zap.Logger, method string, call func(ctx context.Context) error) error {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestId := firstValue(md, REQUEST_ID_METADATA_KEY)
+	if requestId == "" {
+		requestId = newRequestID()
+	}
+	ctx = NewContext(ctx, requestId)
+	// only fails when called outside of a gRPC server
+	_ = grpc.SetHeader(ctx, metadata.Pairs(REQUEST_ID_METADATA_KEY, requestId))
+	err := call(ctx)
+	fields := []zap.Field{
+		zap.String("request_id", requestId),
+		zap.String("method", method),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("latency", time.Since(start)),
+		zap.String("tenant", firstValue(md, tenant.METADATA_KEY)),
+		zap.String("user_agent", firstValue(md, "user-agent")),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields = append(fields, zap.String("peer", p.Addr.String()))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	logger.Info("grpc access", fields...)
+	return err
+}
+
+// Gives an id to every unary RPC and writes its access log
+func UnaryServerInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var resp interface{}
+		err := serverCall(ctx, logger, info.FullMethod, func(ctx context.Context) (err error) {
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+// Server stream whose context has the request id
+type requestStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestStream) Context() context.Context {
+	return s.ctx
+}
+
+// Gives an id to every streaming RPC and writes its access log once it returns
+func StreamServerInterceptor(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return serverCall(ss.Context(), logger, info.FullMethod, func(ctx context.Context) error {
+			return handler(srv, &requestStream{ServerStream: ss, ctx: ctx})
+		})
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Lets handlers streaming a response, such as exports, flush through the writer
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Gives an id to every request handled by the gateway, answered in the X-Request-Id header, and
+// writes its access log
+func HTTPMiddleware(logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestId := r.Header.Get(REQUEST_ID_HEADER)
+		if requestId == "" {
+			requestId = newRequestID()
+			// forwarded to the handler in the metadata
+			r.Header.Set(REQUEST_ID_HEADER, requestId)
+		}
+		w.Header().Set(REQUEST_ID_HEADER, requestId)
+		writer := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(writer, r.WithContext(NewContext(r.Context(), requestId)))
+		remote := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(remote); err == nil {
+			remote = host
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			remote = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+		logger.Info("http access",
+			zap.String("request_id", requestId),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", writer.status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("tenant", r.Header.Get(tenant.METADATA_KEY)),
+			zap.String("user_agent", r.UserAgent()),
+			zap.String("remote", remote),
+		)
+	})
+}
@@ -0,0 +1,110 @@
+package logging_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IsaqueB/ps-klever/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestNew(t *testing.T) {
+	logger, err := logging.New("warn")
+	if err != nil {
+		t.Fatalf("Error creating logger. %v", err)
+	}
+	assert.False(t, logger.Core().Enabled(zapcore.InfoLevel))
+	assert.True(t, logger.Core().Enabled(zapcore.WarnLevel))
+	_, err = logging.New("loud")
+	assert.NotNil(t, err, "Unknown levels should be refused")
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	interceptor := logging.UnaryServerInterceptor(zap.New(core))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "request-1", "x-tenant-id", "acme"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.Vote/Get"}
+	var handled string
+	_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled = logging.RequestID(ctx)
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "request-1", handled, "The request id of the caller should be used")
+	if !assert.Equal(t, 1, logs.Len()) {
+		return
+	}
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "request-1", fields["request_id"])
+	assert.Equal(t, "/proto.Vote/Get", fields["method"])
+	assert.Equal(t, "NotFound", fields["code"])
+	assert.Equal(t, "acme", fields["tenant"])
+	assert.Contains(t, fields, "latency")
+	// without a request id from the caller
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled = logging.RequestID(ctx)
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	assert.Len(t, handled, 32, "A request id should be generated")
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	var handled string
+	handler := logging.HTTPMiddleware(zap.New(core), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled = logging.RequestID(r.Context())
+		w.WriteHeader(http.StatusCreated)
+	}))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1", nil)
+	r.Header.Set("X-Request-Id", "request-2")
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, "request-2", handled)
+	assert.Equal(t, "request-2", w.Header().Get("X-Request-Id"))
+	if !assert.Equal(t, 1, logs.Len()) {
+		return
+	}
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "request-2", fields["request_id"])
+	assert.Equal(t, "POST", fields["method"])
+	assert.Equal(t, "/v1", fields["path"])
+	assert.Equal(t, int64(http.StatusCreated), fields["status"])
+	// without a request id from the caller
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1", nil))
+	assert.NotEqual(t, "", w.Header().Get("X-Request-Id"), "A request id should be generated")
+	assert.Equal(t, handled, w.Header().Get("X-Request-Id"))
+}
+
+// Streaming responses, such as the export, flush the rows as they are written
+func TestHTTPMiddlewareFlush(t *testing.T) {
+	handler := logging.HTTPMiddleware(zap.NewNop(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !assert.True(t, ok, "The writer should be a http.Flusher") {
+			return
+		}
+		w.Write([]byte("row\n"))
+		flusher.Flush()
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/export", nil))
+	assert.True(t, w.Flushed, "Flushes should reach the underlying writer")
+}
+
+func TestWithRequest(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logging.WithRequest(logging.NewContext(context.Background(), "request-3"), zap.New(core)).Info("line")
+	logging.WithRequest(context.Background(), zap.New(core)).Info("line")
+	assert.Equal(t, "request-3", logs.All()[0].ContextMap()["request_id"])
+	assert.NotContains(t, logs.All()[1].ContextMap(), "request_id", "Lines outside requests should not have a request id")
+}
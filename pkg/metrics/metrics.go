@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const NAMESPACE = "vote"
+
+// Registry of every metric of the API, served by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "grpc_requests_total",
+		Help:      "gRPC requests handled, by method and status code.",
+	}, []string{"method", "code"})
+	grpcLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Time taken to handle gRPC requests, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled by the gateway, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	httpLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests by the gateway, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	mongoLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "Time taken by MongoDB commands, by command and whether it failed.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command", "failed"})
+	mongoConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "mongo_pool_connections",
+		Help:      "Connections of the MongoDB pool, open and in use.",
+	}, []string{"state"})
+	votesCast = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "votes_cast_total",
+		Help:      "Votes written, by direction and what was done to the vote stored.",
+	}, []string{"direction", "action"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		grpcRequests, grpcLatency,
+		httpRequests, httpLatency,
+		mongoLatency, mongoConnections,
+		votesCast,
+	)
+}
+
+// Serves the metrics in the Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Counts a vote written, direction being up, down or none and action what was done to the vote,
+// such as inserted or retracted
+func VoteCast(direction string, action string) {
+	votesCast.WithLabelValues(direction, action).Inc()
+}
+
+func observeRPC(method string, start time.Time, err error) {
+	grpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	grpcLatency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// Measures every unary RPC served by the gRPC server
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeRPC(info.FullMethod, start, err)
+	return resp, err
+}
+
+// Measures every streaming RPC served by the gRPC server, from its start until it returns
+func StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeRPC(info.FullMethod, start, err)
+	return err
+}
+
+type routeKey struct{}
+
+// Route matched by the gateway, filled in by RouteAnnotator once the request is matched
+type route struct {
+	pattern string
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Lets handlers streaming a response, such as exports, flush through the writer
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Measures every request handled by the gateway. The route label is the path pattern of the RPC,
+// so ids in paths don't create new series. The gateway mux must use RouteAnnotator
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		matched := &route{pattern: "unmatched"}
+		writer := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(writer, r.WithContext(context.WithValue(r.Context(), routeKey{}, matched)))
+		httpRequests.WithLabelValues(r.Method, matched.pattern, strconv.Itoa(writer.status)).Inc()
+		httpLatency.WithLabelValues(r.Method, matched.pattern).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Metadata annotator of the gateway mux which tells HTTPMiddleware the route of the request
+func RouteAnnotator(ctx context.Context, r *http.Request) metadata.MD {
+	if matched, ok := r.Context().Value(routeKey{}).(*route); ok {
+		if pattern, ok := runtime.HTTPPathPattern(ctx); ok {
+			matched.pattern = pattern
+		}
+	}
+	return nil
+}
+
+// Monitor of the MongoDB client measuring the time taken by each command
+func CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			mongoLatency.WithLabelValues(e.CommandName, "false").Observe(time.Duration(e.DurationNanos).Seconds())
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			mongoLatency.WithLabelValues(e.CommandName, "true").Observe(time.Duration(e.DurationNanos).Seconds())
+		},
+	}
+}
+
+// Monitor of the MongoDB client tracking the connections of its pool
+func PoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				mongoConnections.WithLabelValues("open").Inc()
+			case event.ConnectionClosed:
+				mongoConnections.WithLabelValues("open").Dec()
+			case event.GetSucceeded:
+				mongoConnections.WithLabelValues("in_use").Inc()
+			case event.ConnectionReturned:
+				mongoConnections.WithLabelValues("in_use").Dec()
+			}
+		},
+	}
+}
@@ -0,0 +1,85 @@
+package metrics_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IsaqueB/ps-klever/pkg/metrics"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Scrapes the metrics handler
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := ioutil.ReadAll(w.Body)
+	if err != nil {
+		t.Fatalf("Error reading metrics. %v", err)
+	}
+	return string(body)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.Vote/Get"}
+	_, err := metrics.UnaryServerInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err), "Errors of the handler should be returned")
+	_, err = metrics.UnaryServerInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	assert.Nil(t, err)
+	body := scrape(t)
+	assert.Contains(t, body, `vote_grpc_requests_total{code="NotFound",method="/proto.Vote/Get"} 1`)
+	assert.Contains(t, body, `vote_grpc_requests_total{code="OK",method="/proto.Vote/Get"} 1`)
+	assert.Contains(t, body, `vote_grpc_request_duration_seconds_count{method="/proto.Vote/Get"} 2`)
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	mux := runtime.NewServeMux(runtime.WithMetadata(metrics.RouteAnnotator))
+	// what the handlers of the gateway do once a route is matched
+	matched := func(w http.ResponseWriter, r *http.Request) {
+		if _, err := runtime.AnnotateIncomingContext(r.Context(), mux, r, "/proto.Vote/Get", runtime.WithHTTPPathPattern("/v1/{id}")); err != nil {
+			t.Fatalf("Error annotating context. %v", err)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+	handler := metrics.HTTPMiddleware(http.HandlerFunc(matched))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/61c9d1f1e1b2a3c4d5e6f7a8", nil))
+	handler = metrics.HTTPMiddleware(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	body := scrape(t)
+	assert.Contains(t, body, `vote_http_requests_total{method="GET",route="/v1/{id}",status="404"} 1`, "Ids in paths should not be labels")
+	assert.Contains(t, body, `vote_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+}
+
+// Streaming responses, such as the export, flush the rows as they are written
+func TestHTTPMiddlewareFlush(t *testing.T) {
+	handler := metrics.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !assert.True(t, ok, "The writer should be a http.Flusher") {
+			return
+		}
+		w.Write([]byte("row\n"))
+		flusher.Flush()
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.True(t, w.Flushed, "Flushes should reach the underlying writer")
+}
+
+func TestVoteCast(t *testing.T) {
+	metrics.VoteCast("up", "inserted")
+	metrics.VoteCast("up", "inserted")
+	metrics.VoteCast("none", "retracted")
+	body := scrape(t)
+	assert.Contains(t, body, `vote_votes_cast_total{action="inserted",direction="up"} 2`)
+	assert.Contains(t, body, `vote_votes_cast_total{action="retracted",direction="none"} 1`)
+}
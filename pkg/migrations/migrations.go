@@ -0,0 +1,399 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Collection of the main database recording the migrations applied to each tenant, which also
+// holds the lock of the instance migrating
+const MIGRATIONS_COLLECTION = "schema_migrations"
+
+const (
+	DEFAULT_LOCK_TIMEOUT = 5 * time.Minute
+	// the lock expires if its owner stops refreshing it, so a crashed instance doesn't hold it forever
+	DEFAULT_LOCK_TTL    = time.Minute
+	BACKFILL_BATCH_SIZE = 1000
+	lockID              = "lock"
+	lockPollInterval    = time.Second
+)
+
+var (
+	ErrLocked          = errors.New("another instance is migrating the database")
+	ErrUnknownVersion  = errors.New("there is no migration with the version given")
+	ErrInvalidVersions = errors.New("migration versions must be positive, unique and in ascending order")
+	ErrBackfillStalled = errors.New("the backfill update did not change the votes matching its filter")
+)
+
+// Versioned step of the schema of the votes. Up applies it to the collection of votes of a tenant
+// and Down reverts it. Both may be run again after failing halfway, so they must be idempotent
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, votes *mongo.Collection) error
+	Down    func(ctx context.Context, votes *mongo.Collection) error
+}
+
+// Record of a migration applied to the votes of a tenant
+type record struct {
+	// tenant and version
+	ID        string    `bson:"_id"`
+	Tenant    string    `bson:"tenant"`
+	Version   int       `bson:"version"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Whether a migration was applied to the votes of a tenant. AppliedAt is nil while it is pending
+type Status struct {
+	Tenant    string
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator interface {
+	// Applies the pending migrations to the default tenant and to every other tenant found
+	Up(ctx context.Context) error
+	// Applies the pending migrations to the tenant, such as one created after Up. Returns right
+	// away if none is pending
+	UpTenant(ctx context.Context, tenantId string) error
+	// Reverts the migrations after version, the newest first. Zero reverts every migration
+	Down(ctx context.Context, version int) error
+	Status(ctx context.Context) ([]Status, error)
+	// Set how long to wait for another instance to finish migrating before ErrLocked
+	SetLockTimeout(timeout time.Duration)
+	SetLogger(logger *zap.Logger)
+}
+
+type migrator struct {
+	client      *database.MongoClient
+	database    string
+	tenants     tenant.Config
+	migrations  []Migration
+	lockTimeout time.Duration
+	lockTTL     time.Duration
+	logger      *zap.Logger
+}
+
+// Creates a migrator of the votes stored in the database, as the tenants config lays them out
+func NewMigrator(client *database.MongoClient, databaseName string, tenants tenant.Config, migrations []Migration) Migrator {
+	return &migrator{
+		client:      client,
+		database:    databaseName,
+		tenants:     tenants,
+		migrations:  migrations,
+		lockTimeout: DEFAULT_LOCK_TIMEOUT,
+		lockTTL:     DEFAULT_LOCK_TTL,
+		logger:      zap.NewNop(),
+	}
+}
+
+func (m *migrator) SetLockTimeout(timeout time.Duration) {
+	m.lockTimeout = timeout
+}
+
+func (m *migrator) SetLogger(logger *zap.Logger) {
+	m.logger = logger
+}
+
+// Returns ErrInvalidVersions unless the versions are positive and ascending, so the order
+// migrations are applied in never depends on how the list was built
+func Validate(migrations []Migration) error {
+	for i, migration := range migrations {
+		if migration.Version <= 0 || (i > 0 && migration.Version <= migrations[i-1].Version) {
+			return ErrInvalidVersions
+		}
+		if migration.Up == nil || migration.Down == nil {
+			return fmt.Errorf("migration %d must have both up and down steps", migration.Version)
+		}
+	}
+	return nil
+}
+
+func (m *migrator) collection() *mongo.Collection {
+	return (*m.client).GetClient().Database(m.database).Collection(MIGRATIONS_COLLECTION)
+}
+
+func recordID(tenantId string, version int) string {
+	return fmt.Sprintf("%s/%d", tenantId, version)
+}
+
+// The default tenant and every other tenant found
+func (m *migrator) tenantIds(ctx context.Context) ([]string, error) {
+	tenants, err := database.NewVoteRepository(m.client, m.database, m.tenants).Tenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{""}, tenants...), nil
+}
+
+func (m *migrator) votes(tenantId string) *mongo.Collection {
+	databaseName, collectionName := m.tenants.Namespace(tenantId, m.database, database.VOTE_COLLECTION)
+	return (*m.client).GetClient().Database(databaseName).Collection(collectionName)
+}
+
+// Versions of the migrations applied to the votes of the tenant
+func (m *migrator) applied(ctx context.Context, tenantId string) (map[int]time.Time, error) {
+	cursor, err := m.collection().Find(ctx, bson.M{"tenant": tenantId})
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := map[int]time.Time{}
+	for _, r := range records {
+		applied[r.Version] = r.AppliedAt
+	}
+	return applied, nil
+}
+
+// Acquires the lock, waiting up to the lock timeout while another instance holds it. The lock is
+// refreshed until the function returned releases it
+func (m *migrator) lock(ctx context.Context) (func(), error) {
+	owner := fmt.Sprintf("%s-%d-%d", hostname(), os.Getpid(), time.Now().UnixNano())
+	deadline := time.Now().Add(m.lockTimeout)
+	for {
+		now := time.Now().UTC()
+		// the lock can only be taken when it expired, or else the upsert conflicts with it
+		_, err := m.collection().UpdateOne(ctx, bson.M{"_id": lockID, "expires_at": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{"owner": owner, "expires_at": now.Add(m.lockTTL)}}, options.Update().SetUpsert(true))
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLocked
+		}
+		m.logger.Info("waiting for another instance to finish migrating")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+	refreshCtx, stop := context.WithCancel(context.Background())
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		ticker := time.NewTicker(m.lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-refreshCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			_, err := m.collection().UpdateOne(refreshCtx, bson.M{"_id": lockID, "owner": owner},
+				bson.M{"$set": bson.M{"expires_at": time.Now().UTC().Add(m.lockTTL)}})
+			if err != nil && refreshCtx.Err() == nil {
+				m.logger.Error("could not refresh the migrations lock", zap.Error(err))
+			}
+		}
+	}()
+	return func() {
+		stop()
+		<-refreshed
+		if _, err := m.collection().DeleteOne(context.Background(), bson.M{"_id": lockID, "owner": owner}); err != nil {
+			m.logger.Error("could not release the migrations lock", zap.Error(err))
+		}
+	}, nil
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
+
+func (m *migrator) Up(ctx context.Context) error {
+	if err := Validate(m.migrations); err != nil {
+		return err
+	}
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tenantIds, err := m.tenantIds(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tenantId := range tenantIds {
+		if err := m.up(ctx, tenantId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *migrator) UpTenant(ctx context.Context, tenantId string) error {
+	if err := Validate(m.migrations); err != nil {
+		return err
+	}
+	applied, err := m.applied(ctx, tenantId)
+	if err != nil {
+		return err
+	}
+	if len(m.pending(applied)) == 0 {
+		return nil
+	}
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return m.up(ctx, tenantId)
+}
+
+// Migrations not applied yet, in order
+func (m *migrator) pending(applied map[int]time.Time) []Migration {
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+// Applies the pending migrations to the tenant. The lock must be held
+func (m *migrator) up(ctx context.Context, tenantId string) error {
+	applied, err := m.applied(ctx, tenantId)
+	if err != nil {
+		return err
+	}
+	for _, migration := range m.pending(applied) {
+		m.logger.Info("applying migration", zap.String("tenant", tenantId), zap.Int("version", migration.Version), zap.String("name", migration.Name))
+		if err := migration.Up(ctx, m.votes(tenantId)); err != nil {
+			return fmt.Errorf("migration %d of tenant %q: %w", migration.Version, tenantId, err)
+		}
+		_, err := m.collection().InsertOne(ctx, record{
+			ID:        recordID(tenantId, migration.Version),
+			Tenant:    tenantId,
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *migrator) Down(ctx context.Context, version int) error {
+	if err := Validate(m.migrations); err != nil {
+		return err
+	}
+	known := version == 0
+	for _, migration := range m.migrations {
+		known = known || migration.Version == version
+	}
+	if !known {
+		return ErrUnknownVersion
+	}
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tenantIds, err := m.tenantIds(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tenantId := range tenantIds {
+		applied, err := m.applied(ctx, tenantId)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && m.migrations[i].Version > version; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			m.logger.Info("reverting migration", zap.String("tenant", tenantId), zap.Int("version", migration.Version), zap.String("name", migration.Name))
+			if err := migration.Down(ctx, m.votes(tenantId)); err != nil {
+				return fmt.Errorf("migration %d of tenant %q: %w", migration.Version, tenantId, err)
+			}
+			if _, err := m.collection().DeleteOne(ctx, bson.M{"_id": recordID(tenantId, migration.Version)}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Status of every migration for the default tenant and every other tenant found, sorted by tenant
+// and version
+func (m *migrator) Status(ctx context.Context) ([]Status, error) {
+	tenantIds, err := m.tenantIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tenantIds)
+	var statuses []Status
+	for _, tenantId := range tenantIds {
+		applied, err := m.applied(ctx, tenantId)
+		if err != nil {
+			return nil, err
+		}
+		for _, migration := range m.migrations {
+			status := Status{Tenant: tenantId, Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+// Applies update to the votes matching filter in batches, so a backfill of a large collection
+// doesn't hold a single long write. The update must make the votes stop matching the filter, or
+// else it never ends. Returns the amount of votes updated
+func Backfill(ctx context.Context, votes *mongo.Collection, filter bson.M, update interface{}, batchSize int) (int64, error) {
+	var updated int64
+	for {
+		cursor, err := votes.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(int64(batchSize)))
+		if err != nil {
+			return updated, err
+		}
+		var batch []bson.M
+		if err = cursor.All(ctx, &batch); err != nil {
+			return updated, err
+		}
+		if len(batch) == 0 {
+			return updated, nil
+		}
+		ids := make(bson.A, len(batch))
+		for i, vote := range batch {
+			ids[i] = vote["_id"]
+		}
+		result, err := votes.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, update)
+		if err != nil {
+			return updated, err
+		}
+		if result.ModifiedCount == 0 {
+			return updated, ErrBackfillStalled
+		}
+		updated += result.ModifiedCount
+	}
+}
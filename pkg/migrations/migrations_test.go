@@ -0,0 +1,145 @@
+package migrations_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IsaqueB/ps-klever/pkg/database"
+	"github.com/IsaqueB/ps-klever/pkg/migrations"
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// migrations run against their own database, so they don't change the indexes the other tests rely on
+const testDatabase = "ps-klever-test-migrations"
+
+func noop(ctx context.Context, votes *mongo.Collection) error {
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, migrations.Validate(migrations.Votes))
+	assert.Equal(t, migrations.ErrInvalidVersions, migrations.Validate([]migrations.Migration{
+		{Version: 2, Up: noop, Down: noop},
+		{Version: 1, Up: noop, Down: noop},
+	}), "Versions out of order should be refused")
+	assert.Equal(t, migrations.ErrInvalidVersions, migrations.Validate([]migrations.Migration{
+		{Version: 1, Up: noop, Down: noop},
+		{Version: 1, Up: noop, Down: noop},
+	}), "Repeated versions should be refused")
+	assert.NotNil(t, migrations.Validate([]migrations.Migration{{Version: 1, Up: noop}}), "Migrations should be reversible")
+}
+
+func connect(t *testing.T) database.MongoClient {
+	client := database.NewMongoClient()
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Error connecting to database. %v", err)
+	}
+	return client
+}
+
+func indexNames(t *testing.T, votes *mongo.Collection) []string {
+	specs, err := votes.Indexes().ListSpecifications(context.Background())
+	if err != nil {
+		t.Fatalf("Error listing indexes. %v", err)
+	}
+	var names []string
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	return names
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	client := connect(t)
+	defer client.Disconnect()
+	db := client.GetClient().Database(testDatabase)
+	if err := db.Drop(ctx); err != nil {
+		t.Fatalf("Error dropping database. %v", err)
+	}
+	votes := db.Collection(database.VOTE_COLLECTION)
+	// a vote written before timestamps existed
+	mock_id := primitive.NewObjectID()
+	if _, err := votes.InsertOne(ctx, bson.M{"_id": mock_id, "video": mock_id, "user": mock_id, "upvote": true}); err != nil {
+		t.Fatalf("Error inserting vote. %v", err)
+	}
+	migrator := migrations.NewMigrator(&client, testDatabase, tenant.Config{Strategy: tenant.PREFIX_STRATEGY}, migrations.Votes)
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Error migrating up. %v", err)
+	}
+	assert.ElementsMatch(t, []string{"_id_", migrations.USER_INDEX, migrations.UNIQUE_VOTE_INDEX,
+		migrations.DELETED_AT_INDEX, migrations.CREATED_AT_INDEX}, indexNames(t, votes))
+	var vote database.VoteModel
+	if err := votes.FindOne(ctx, bson.M{"_id": mock_id}).Decode(&vote); err != nil {
+		t.Fatalf("Error finding vote. %v", err)
+	}
+	assert.NotNil(t, vote.CreatedAt, "Existing votes should be backfilled")
+	assert.NotNil(t, vote.UpdatedAt, "Existing votes should be backfilled")
+	_, err := votes.InsertOne(ctx, bson.M{"video": mock_id, "user": mock_id, "upvote": false})
+	assert.True(t, mongo.IsDuplicateKeyError(err), "An user should have a single vote on a video")
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Error reading status. %v", err)
+	}
+	assert.Len(t, statuses, len(migrations.Votes))
+	for _, status := range statuses {
+		assert.NotNil(t, status.AppliedAt, "Migration %d should be applied", status.Version)
+	}
+	// running again applies nothing
+	assert.Nil(t, migrator.Up(ctx))
+
+	if err := migrator.Down(ctx, 2); err != nil {
+		t.Fatalf("Error migrating down. %v", err)
+	}
+	assert.ElementsMatch(t, []string{"_id_", migrations.VIDEO_USER_INDEX, migrations.USER_INDEX}, indexNames(t, votes))
+	if err := votes.FindOne(ctx, bson.M{"_id": mock_id}).Decode(&vote); err != nil {
+		t.Fatalf("Error finding vote. %v", err)
+	}
+	assert.Nil(t, vote.CreatedAt)
+	assert.Equal(t, migrations.ErrUnknownVersion, migrator.Down(ctx, 42))
+	assert.Nil(t, migrator.Down(ctx, 0))
+	assert.ElementsMatch(t, []string{"_id_"}, indexNames(t, votes))
+}
+
+func TestConcurrentUp(t *testing.T) {
+	ctx := context.Background()
+	client := connect(t)
+	defer client.Disconnect()
+	if err := client.GetClient().Database(testDatabase).Drop(ctx); err != nil {
+		t.Fatalf("Error dropping database. %v", err)
+	}
+	var applied int32
+	var mutex sync.Mutex
+	counting := []migrations.Migration{{
+		Version: 1,
+		Up: func(ctx context.Context, votes *mongo.Collection) error {
+			mutex.Lock()
+			applied++
+			mutex.Unlock()
+			// long enough for the other instance to find the lock taken
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		},
+		Down: noop,
+	}}
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = migrations.NewMigrator(&client, testDatabase, tenant.Config{}, counting).Up(ctx)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(1), applied, "Instances migrating together should apply each migration once")
+}
@@ -0,0 +1,136 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Names of the indexes created by the migrations
+const (
+	VIDEO_USER_INDEX = "video_1_user_1"
+	USER_INDEX       = "user_1"
+	// unique among the votes which weren't deleted, which all lack deleted_at
+	UNIQUE_VOTE_INDEX = "video_1_user_1_deleted_at_1"
+	DELETED_AT_INDEX  = "deleted_at_1"
+	CREATED_AT_INDEX  = "created_at_1"
+)
+
+// code of the error dropping an index which doesn't exist
+const indexNotFound = 27
+
+// Migrations of the votes, in the order they are applied. New migrations are appended with the next version
+var Votes = []Migration{
+	{
+		Version: 1,
+		Name:    "index votes by video and user",
+		Up:      createIndex(VIDEO_USER_INDEX, bson.D{{Key: "video", Value: 1}, {Key: "user", Value: 1}}, options.Index()),
+		Down:    dropIndex(VIDEO_USER_INDEX),
+	},
+	{
+		Version: 2,
+		Name:    "index votes by user",
+		Up:      createIndex(USER_INDEX, bson.D{{Key: "user", Value: 1}}, options.Index()),
+		Down:    dropIndex(USER_INDEX),
+	},
+	{
+		Version: 3,
+		Name:    "allow a single vote of an user on a video",
+		Up:      uniqueVoteUp,
+		Down:    uniqueVoteDown,
+	},
+	{
+		Version: 4,
+		Name:    "index deleted votes",
+		Up:      createIndex(DELETED_AT_INDEX, bson.D{{Key: "deleted_at", Value: 1}}, options.Index().SetSparse(true)),
+		Down:    dropIndex(DELETED_AT_INDEX),
+	},
+	{
+		Version: 5,
+		Name:    "add timestamps to votes",
+		Up:      timestampsUp,
+		Down:    timestampsDown,
+	},
+	{
+		Version: 6,
+		Name:    "add versions to votes",
+		Up:      versionsUp,
+		Down:    versionsDown,
+	},
+}
+
+func createIndex(name string, keys bson.D, opts *options.IndexOptions) func(ctx context.Context, votes *mongo.Collection) error {
+	return func(ctx context.Context, votes *mongo.Collection) error {
+		_, err := votes.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: opts.SetName(name)})
+		return err
+	}
+}
+
+func dropIndex(name string) func(ctx context.Context, votes *mongo.Collection) error {
+	return func(ctx context.Context, votes *mongo.Collection) error {
+		_, err := votes.Indexes().DropOne(ctx, name)
+		if command, ok := err.(mongo.CommandError); ok && command.Code == indexNotFound {
+			return nil
+		}
+		return err
+	}
+}
+
+// The unique index also serves the queries by video and by video and user, so the index of
+// version 1 is dropped once it exists
+func uniqueVoteUp(ctx context.Context, votes *mongo.Collection) error {
+	keys := bson.D{{Key: "video", Value: 1}, {Key: "user", Value: 1}, {Key: "deleted_at", Value: 1}}
+	err := createIndex(UNIQUE_VOTE_INDEX, keys, options.Index().SetUnique(true))(ctx, votes)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("an user has many votes on a video, which must be deleted before migrating: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+	return dropIndex(VIDEO_USER_INDEX)(ctx, votes)
+}
+
+func uniqueVoteDown(ctx context.Context, votes *mongo.Collection) error {
+	if err := createIndex(VIDEO_USER_INDEX, bson.D{{Key: "video", Value: 1}, {Key: "user", Value: 1}}, options.Index())(ctx, votes); err != nil {
+		return err
+	}
+	return dropIndex(UNIQUE_VOTE_INDEX)(ctx, votes)
+}
+
+// Votes written before timestamps existed get the time of the migration, since their creation
+// time is unknown: the ids of cast votes are hashes, not ObjectIDs carrying a time
+func timestampsUp(ctx context.Context, votes *mongo.Collection) error {
+	backfill := mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "created_at", Value: "$$NOW"},
+		{Key: "updated_at", Value: bson.M{"$ifNull": bson.A{"$updated_at", "$$NOW"}}},
+	}}}}
+	if _, err := Backfill(ctx, votes, bson.M{"created_at": bson.M{"$exists": false}}, backfill, BACKFILL_BATCH_SIZE); err != nil {
+		return err
+	}
+	return createIndex(CREATED_AT_INDEX, bson.D{{Key: "created_at", Value: 1}}, options.Index())(ctx, votes)
+}
+
+// Votes written before versions existed start at version 1, as if they were inserted now
+func versionsUp(ctx context.Context, votes *mongo.Collection) error {
+	_, err := Backfill(ctx, votes, bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"version": 1}}, BACKFILL_BATCH_SIZE)
+	return err
+}
+
+// The versions are kept, since writes made after migrating incremented them too and a version
+// can't be told apart from one which was backfilled
+func versionsDown(ctx context.Context, votes *mongo.Collection) error {
+	return nil
+}
+
+func timestampsDown(ctx context.Context, votes *mongo.Collection) error {
+	if err := dropIndex(CREATED_AT_INDEX)(ctx, votes); err != nil {
+		return err
+	}
+	_, err := Backfill(ctx, votes, bson.M{"created_at": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"created_at": "", "updated_at": ""}}, BACKFILL_BATCH_SIZE)
+	return err
+}
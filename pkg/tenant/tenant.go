@@ -0,0 +1,155 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata key of the tenant. The HTTP gateway forwards the X-Tenant-Id header to it. It is only
+// trusted when TrustHeader is set, otherwise the tenant comes from the caller's token
+const METADATA_KEY = "x-tenant-id"
+
+// Where the votes of each tenant are stored
+const (
+	// every tenant has its own database, named "<database>-<tenant>"
+	DATABASE_STRATEGY = "database"
+	// every tenant has its own collection, named "<tenant>_<collection>", in the shared database
+	PREFIX_STRATEGY = "prefix"
+)
+
+var (
+	ErrInvalidTenant   = errors.New("tenant id must have up to 64 letters, digits, '-' or '_', and not be reserved")
+	ErrUnknownStrategy = errors.New("tenant strategy must be database or prefix")
+	validTenant        = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+)
+
+// Tenant ids which can't be used, alone or followed by '-', as the databases named after them
+// are not of tenants: the test databases and the ones of MongoDB itself
+var RESERVED = []string{"test", "admin", "local", "config"}
+
+// Whether the id can be used by a tenant
+func Valid(id string) bool {
+	if !validTenant.MatchString(id) {
+		return false
+	}
+	for _, reserved := range RESERVED {
+		if strings.EqualFold(id, reserved) || strings.HasPrefix(strings.ToLower(id), reserved+"-") {
+			return false
+		}
+	}
+	return true
+}
+
+type contextKey struct{}
+
+type Config struct {
+	Strategy string
+	// Tenant used when the request doesn't carry one. Empty means the votes are stored
+	// without tenant, as they were before tenants existed
+	DefaultTenant string
+	// Maximum amount of votes a tenant may store. Zero means unlimited
+	DefaultQuota int64
+	Quotas       map[string]int64
+	// If true, the tenant sent in the metadata is used when the caller's token has none, such as
+	// behind a proxy which authenticates the callers and sets it. Otherwise anyone could send it
+	TrustHeader bool
+}
+
+// Reads the configuration from TENANT_STRATEGY, DEFAULT_TENANT, TENANT_DEFAULT_QUOTA,
+// TENANT_QUOTAS, the last one formatted as "tenant=quota,other=quota", and TENANT_TRUST_HEADER
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Strategy:      os.Getenv("TENANT_STRATEGY"),
+		DefaultTenant: os.Getenv("DEFAULT_TENANT"),
+		Quotas:        map[string]int64{},
+		TrustHeader:   os.Getenv("TENANT_TRUST_HEADER") == "true",
+	}
+	if config.Strategy == "" {
+		config.Strategy = PREFIX_STRATEGY
+	}
+	if config.Strategy != PREFIX_STRATEGY && config.Strategy != DATABASE_STRATEGY {
+		return Config{}, ErrUnknownStrategy
+	}
+	if config.DefaultTenant != "" && !Valid(config.DefaultTenant) {
+		return Config{}, ErrInvalidTenant
+	}
+	if value := os.Getenv("TENANT_DEFAULT_QUOTA"); value != "" {
+		quota, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TENANT_DEFAULT_QUOTA: %v", err)
+		}
+		config.DefaultQuota = quota
+	}
+	if value := os.Getenv("TENANT_QUOTAS"); value != "" {
+		for _, entry := range strings.Split(value, ",") {
+			pair := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+			if len(pair) != 2 || !validTenant.MatchString(pair[0]) {
+				return Config{}, fmt.Errorf("invalid TENANT_QUOTAS entry: %q", entry)
+			}
+			quota, err := strconv.ParseInt(pair[1], 10, 64)
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid TENANT_QUOTAS entry: %q", entry)
+			}
+			config.Quotas[pair[0]] = quota
+		}
+	}
+	return config, nil
+}
+
+// Maximum amount of votes the tenant may store, zero if unlimited
+func (c Config) Quota(tenant string) int64 {
+	if quota, ok := c.Quotas[tenant]; ok {
+		return quota
+	}
+	return c.DefaultQuota
+}
+
+// Names of the database and collection that store the votes of the tenant
+func (c Config) Namespace(tenant string, database string, collection string) (string, string) {
+	if tenant == "" {
+		return database, collection
+	}
+	if c.Strategy == DATABASE_STRATEGY {
+		return database + "-" + tenant, collection
+	}
+	return database, tenant + "_" + collection
+}
+
+// Returns a context carrying the tenant. Used by authentication layers once the tenant
+// was taken from the caller's claims, which has priority over the metadata header
+func NewContext(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// Tenant sent in the metadata of the request, empty if none
+func FromMetadata(ctx context.Context) string {
+	if md, found := metadata.FromIncomingContext(ctx); found {
+		if values := md.Get(METADATA_KEY); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// Returns the tenant of the request: the one set by NewContext, or else the one sent in
+// the metadata if it is trusted, or else the default tenant. Empty tenants are not set
+func (c Config) FromContext(ctx context.Context) (string, error) {
+	tenant, _ := ctx.Value(contextKey{}).(string)
+	if tenant == "" && c.TrustHeader {
+		tenant = FromMetadata(ctx)
+	}
+	if tenant == "" {
+		return c.DefaultTenant, nil
+	}
+	if !Valid(tenant) {
+		return "", ErrInvalidTenant
+	}
+	return tenant, nil
+}
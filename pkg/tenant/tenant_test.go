@@ -0,0 +1,97 @@
+package tenant_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IsaqueB/ps-klever/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("TENANT_STRATEGY", tenant.DATABASE_STRATEGY)
+	t.Setenv("DEFAULT_TENANT", "main")
+	t.Setenv("TENANT_DEFAULT_QUOTA", "100")
+	t.Setenv("TENANT_QUOTAS", "small=10, big=1000")
+	config, err := tenant.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Error reading config. %v", err)
+	}
+	assert.Equal(t, tenant.DATABASE_STRATEGY, config.Strategy)
+	assert.Equal(t, "main", config.DefaultTenant)
+	assert.Equal(t, int64(10), config.Quota("small"))
+	assert.Equal(t, int64(1000), config.Quota("big"))
+	assert.Equal(t, int64(100), config.Quota("other"))
+}
+
+func TestConfigFromEnvInvalid(t *testing.T) {
+	t.Setenv("TENANT_STRATEGY", "table")
+	if _, err := tenant.ConfigFromEnv(); err != tenant.ErrUnknownStrategy {
+		t.Errorf("Expected ErrUnknownStrategy, got %v", err)
+	}
+	t.Setenv("TENANT_STRATEGY", "")
+	t.Setenv("TENANT_QUOTAS", "small:10")
+	if _, err := tenant.ConfigFromEnv(); err == nil {
+		t.Errorf("Expected error parsing TENANT_QUOTAS")
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	prefix := tenant.Config{Strategy: tenant.PREFIX_STRATEGY}
+	database, collection := prefix.Namespace("acme", "ps-klever", "vote")
+	assert.Equal(t, "ps-klever", database)
+	assert.Equal(t, "acme_vote", collection)
+	database, collection = prefix.Namespace("", "ps-klever", "vote")
+	assert.Equal(t, "ps-klever", database)
+	assert.Equal(t, "vote", collection)
+
+	separate := tenant.Config{Strategy: tenant.DATABASE_STRATEGY}
+	database, collection = separate.Namespace("acme", "ps-klever", "vote")
+	assert.Equal(t, "ps-klever-acme", database)
+	assert.Equal(t, "vote", collection)
+}
+
+func TestFromContext(t *testing.T) {
+	config := tenant.Config{DefaultTenant: "main"}
+	// without tenant the default one is used
+	id, err := config.FromContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "main", id)
+	// metadata is ignored unless trusted
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.METADATA_KEY, "acme"))
+	id, err = config.FromContext(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "main", id)
+	trusted := tenant.Config{DefaultTenant: "main", TrustHeader: true}
+	id, err = trusted.FromContext(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme", id)
+	// tenant set by authentication has priority over metadata
+	id, err = trusted.FromContext(tenant.NewContext(ctx, "claimed"))
+	assert.Nil(t, err)
+	assert.Equal(t, "claimed", id)
+	// ids that could escape the namespace are refused
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.METADATA_KEY, "../admin"))
+	_, err = trusted.FromContext(ctx)
+	assert.Equal(t, tenant.ErrInvalidTenant, err)
+	_, err = config.FromContext(tenant.NewContext(context.Background(), "../admin"))
+	assert.Equal(t, tenant.ErrInvalidTenant, err)
+	// jobs of the votes without tenant keep an empty one
+	id, err = config.FromContext(tenant.NewContext(context.Background(), ""))
+	assert.Nil(t, err)
+	assert.Equal(t, "main", id)
+	// ids of databases which are not of tenants are reserved
+	_, err = config.FromContext(tenant.NewContext(context.Background(), "test-migrations"))
+	assert.Equal(t, tenant.ErrInvalidTenant, err)
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, tenant.Valid("acme"))
+	assert.True(t, tenant.Valid("testing"))
+	assert.False(t, tenant.Valid(""))
+	assert.False(t, tenant.Valid("a.b"))
+	assert.False(t, tenant.Valid("test"))
+	assert.False(t, tenant.Valid("Admin"))
+	assert.False(t, tenant.Valid("test-migrations"))
+}
@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Spans are not recorded
+	NONE_EXPORTER = "none"
+	// Spans are written as JSON to the standard output
+	STDOUT_EXPORTER = "stdout"
+	// Spans are written as JSON to a file
+	FILE_EXPORTER = "file"
+	// Spans are sent to an OpenTelemetry collector with OTLP over gRPC, configured by the
+	// standard OTEL_EXPORTER_OTLP_* variables
+	OTLP_EXPORTER = "otlp"
+
+	SERVICE_NAME = "ps-klever"
+)
+
+var ErrUnknownExporter = errors.New("unknown traces exporter")
+
+type Config struct {
+	Exporter string
+	// File the spans are written to with FILE_EXPORTER
+	File string
+	// Fraction of the traces started here which are recorded. Traces started by callers follow their decision
+	SampleRatio float64
+	// Used instead of File or the standard output, so tests can read the spans
+	Writer io.Writer
+}
+
+// Reads the configuration from TRACES_EXPORTER, TRACES_FILE and TRACES_SAMPLE_RATIO. Tracing is disabled by default
+func ConfigFromEnv() (Config, error) {
+	config := Config{Exporter: os.Getenv("TRACES_EXPORTER"), File: os.Getenv("TRACES_FILE"), SampleRatio: 1}
+	if config.Exporter == "" {
+		config.Exporter = NONE_EXPORTER
+	}
+	if config.File == "" {
+		config.File = "traces.json"
+	}
+	if ratio := os.Getenv("TRACES_SAMPLE_RATIO"); ratio != "" {
+		parsed, err := strconv.ParseFloat(ratio, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TRACES_SAMPLE_RATIO: %w", err)
+		}
+		config.SampleRatio = parsed
+	}
+	return config, nil
+}
+
+func newExporter(ctx context.Context, config Config) (sdktrace.SpanExporter, error) {
+	if config.Writer != nil {
+		return stdouttrace.New(stdouttrace.WithWriter(config.Writer))
+	}
+	switch config.Exporter {
+	case STDOUT_EXPORTER:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case FILE_EXPORTER:
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(file))
+	case OTLP_EXPORTER:
+		return otlptracegrpc.New(ctx)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownExporter, config.Exporter)
+}
+
+// Installs the global tracer provider and the W3C trace context propagator. Returns a function which
+// exports the spans still buffered, to be called before exiting
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if config.Exporter == NONE_EXPORTER && config.Writer == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := newExporter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(SERVICE_NAME))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Starts a span for every request handled by the gateway, continuing the trace of the caller if
+// it sent one. The gateway mux must use RouteAnnotator
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "HTTP",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}))
+}
+
+// Metadata annotator of the gateway mux which names the span of the request after its route, and
+// propagates the trace to the handler in the metadata, as a gRPC call would
+func RouteAnnotator(ctx context.Context, r *http.Request) metadata.MD {
+	span := trace.SpanFromContext(ctx)
+	if pattern, ok := runtime.HTTPPathPattern(ctx); ok {
+		span.SetName(r.Method + " " + pattern)
+	}
+	if method, ok := runtime.RPCMethod(ctx); ok {
+		span.SetAttributes(semconv.RPCMethodKey.String(method))
+	}
+	md := metadata.MD{}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	return md
+}
+
+// Writes and reads the trace context in gRPC metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Starts a span for every unary RPC served, continuing the trace found in the metadata
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return otelgrpc.UnaryServerInterceptor()
+}
+
+// Starts a span for every streaming RPC served, continuing the trace found in the metadata
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return otelgrpc.StreamServerInterceptor()
+}
+
+// Monitor of the MongoDB client which starts a child span for each command
+func CommandMonitor() *event.CommandMonitor {
+	return otelmongo.NewMonitor()
+}
@@ -0,0 +1,109 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IsaqueB/ps-klever/pkg/tracing"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type exportedSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+		SpanID  string
+	}
+	Parent struct {
+		SpanID string
+	}
+}
+
+// Sets up tracing exporting to a buffer, and returns the spans exported once done is called
+func setupTracing(t *testing.T) func() []exportedSpan {
+	var buffer bytes.Buffer
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{SampleRatio: 1, Writer: &buffer})
+	if err != nil {
+		t.Fatalf("Error setting up tracing. %v", err)
+	}
+	return func() []exportedSpan {
+		if err := shutdown(context.Background()); err != nil {
+			t.Fatalf("Error exporting spans. %v", err)
+		}
+		var spans []exportedSpan
+		decoder := json.NewDecoder(&buffer)
+		for decoder.More() {
+			var span exportedSpan
+			if err := decoder.Decode(&span); err != nil {
+				t.Fatalf("Error decoding spans. %v", err)
+			}
+			spans = append(spans, span)
+		}
+		return spans
+	}
+}
+
+func TestTraceFromMetadataToMongo(t *testing.T) {
+	done := setupTracing(t)
+	// trace started by a caller and sent in the metadata
+	parent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", parent))
+	monitor := tracing.CommandMonitor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.Vote/Get"}
+	_, err := tracing.UnaryServerInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		command, _ := bson.Marshal(bson.D{{Key: "find", Value: "votes"}})
+		monitor.Started(ctx, &event.CommandStartedEvent{Command: command, DatabaseName: "db", CommandName: "find", RequestID: 1})
+		monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1}})
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	spans := done()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	// the command finishes first
+	command, rpc := spans[0], spans[1]
+	assert.Equal(t, "proto.Vote/Get", rpc.Name)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", rpc.SpanContext.TraceID, "The trace of the caller should be continued")
+	assert.Equal(t, "b7ad6b7169203331", rpc.Parent.SpanID)
+	assert.Equal(t, rpc.SpanContext.TraceID, command.SpanContext.TraceID)
+	assert.Equal(t, rpc.SpanContext.SpanID, command.Parent.SpanID, "The command should be a child of the RPC")
+}
+
+func TestRouteAnnotator(t *testing.T) {
+	done := setupTracing(t)
+	mux := runtime.NewServeMux(runtime.WithMetadata(tracing.RouteAnnotator))
+	var propagated string
+	var spanContext trace.SpanContext
+	// what the handlers of the gateway do once a route is matched
+	matched := func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := runtime.AnnotateIncomingContext(r.Context(), mux, r, "/proto.Vote/Get", runtime.WithHTTPPathPattern("/v1/{id}"))
+		if err != nil {
+			t.Fatalf("Error annotating context. %v", err)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get("traceparent"); len(values) > 0 {
+			propagated = values[0]
+		}
+		spanContext = trace.SpanContextFromContext(ctx)
+	}
+	handler := tracing.HTTPMiddleware(http.HandlerFunc(matched))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/61c9d1f1e1b2a3c4d5e6f7a8", nil))
+	spans := done()
+	if !assert.Len(t, spans, 1) {
+		return
+	}
+	assert.Equal(t, "GET /v1/{id}", spans[0].Name, "The span should be named after the route")
+	assert.Equal(t, "00-"+spanContext.TraceID().String()+"-"+spanContext.SpanID().String()+"-01", propagated,
+		"The trace should be propagated in the metadata")
+}
@@ -0,0 +1,177 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Every append is synced to disk before it is acknowledged
+	SYNC_ALWAYS = "always"
+	// Appends are synced when the segment is rotated, a crash of the machine may lose the last ones
+	SYNC_ROTATE = "rotate"
+
+	segmentPrefix = "segment-"
+	segmentSuffix = ".log"
+)
+
+var ErrUnknownSync = errors.New("unknown sync mode")
+
+// Write-ahead log made of segment files with one record per line. Records are appended to the
+// active segment, which is rotated so the records in it can be applied and the segment removed.
+// Segments left by a previous process are kept until they are read and removed, so nothing
+// acknowledged is lost on a crash
+type Log struct {
+	mu     sync.Mutex
+	dir    string
+	sync   string
+	next   int
+	active *os.File
+	writer *bufio.Writer
+	// records appended to the active segment
+	appended int
+}
+
+// Opens the log in dir, creating it if needed. Segments found in dir stay pending until removed
+func Open(dir string, syncMode string) (*Log, error) {
+	if syncMode != SYNC_ALWAYS && syncMode != SYNC_ROTATE {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSync, syncMode)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, sync: syncMode}
+	segments, err := l.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		l.next = segmentNumber(segments[len(segments)-1]) + 1
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func segmentNumber(path string) int {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), segmentPrefix), segmentSuffix)
+	number, _ := strconv.Atoi(name)
+	return number
+}
+
+// Lists the segment files in the order they were written
+func (l *Log) segments() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(l.dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(paths, func(i, j int) bool { return segmentNumber(paths[i]) < segmentNumber(paths[j]) })
+	return paths, nil
+}
+
+func (l *Log) open() error {
+	path := filepath.Join(l.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, l.next, segmentSuffix))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.next++
+	l.active = file
+	l.writer = bufio.NewWriter(file)
+	l.appended = 0
+	return nil
+}
+
+func (l *Log) close() error {
+	if err := l.writer.Flush(); err != nil {
+		return err
+	}
+	if err := l.active.Sync(); err != nil {
+		return err
+	}
+	return l.active.Close()
+}
+
+// Appends a record, which must not contain line breaks. Returns the amount of records in the active segment
+func (l *Log) Append(record []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.writer.Write(append(record, '\n')); err != nil {
+		return 0, err
+	}
+	if l.sync == SYNC_ALWAYS {
+		if err := l.writer.Flush(); err != nil {
+			return 0, err
+		}
+		if err := l.active.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	l.appended++
+	return l.appended, nil
+}
+
+// Closes the active segment and starts a new one. Returns every segment not removed yet, oldest first,
+// which new records are no longer appended to
+func (l *Log) Rotate() ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.appended > 0 {
+		if err := l.close(); err != nil {
+			return nil, err
+		}
+		if err := l.open(); err != nil {
+			return nil, err
+		}
+	}
+	segments, err := l.segments()
+	if err != nil {
+		return nil, err
+	}
+	// the active segment is the last one
+	return segments[:len(segments)-1], nil
+}
+
+// Calls read with each record of the segment. A last record cut by a crash while it was written is skipped
+func ReadSegment(path string, read func(record []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// a line without its line break was not fully written
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := read(line[:len(line)-1]); err != nil {
+			return err
+		}
+	}
+}
+
+// Removes a segment whose records were applied
+func (l *Log) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// Syncs and closes the active segment. Its records are pending when the log is opened again
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.close()
+}
@@ -0,0 +1,96 @@
+package wal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IsaqueB/ps-klever/pkg/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(t *testing.T, segments []string) []string {
+	var records []string
+	for _, segment := range segments {
+		err := wal.ReadSegment(segment, func(record []byte) error {
+			records = append(records, string(record))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Error reading segment. %v", err)
+		}
+	}
+	return records
+}
+
+func TestAppendRotate(t *testing.T) {
+	l, err := wal.Open(t.TempDir(), wal.SYNC_ALWAYS)
+	if err != nil {
+		t.Fatalf("Error opening log. %v", err)
+	}
+	defer l.Close()
+	segments, err := l.Rotate()
+	assert.NoError(t, err)
+	assert.Empty(t, segments, "An empty log should have no segments to apply")
+	for i, record := range []string{"a", "b"} {
+		appended, err := l.Append([]byte(record))
+		assert.NoError(t, err)
+		assert.Equal(t, i+1, appended)
+	}
+	segments, err = l.Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, readAll(t, segments))
+	// records appended after rotating go to the next segment
+	l.Append([]byte("c"))
+	for _, segment := range segments {
+		assert.NoError(t, l.Remove(segment))
+	}
+	segments, err = l.Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, readAll(t, segments))
+}
+
+func TestRecovery(t *testing.T) {
+	dir := t.TempDir()
+	l, err := wal.Open(dir, wal.SYNC_ROTATE)
+	if err != nil {
+		t.Fatalf("Error opening log. %v", err)
+	}
+	l.Append([]byte("a"))
+	l.Append([]byte("b"))
+	assert.NoError(t, l.Close())
+	// the process stops without applying the records
+	l, err = wal.Open(dir, wal.SYNC_ROTATE)
+	if err != nil {
+		t.Fatalf("Error opening log. %v", err)
+	}
+	defer l.Close()
+	l.Append([]byte("c"))
+	segments, err := l.Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, readAll(t, segments), "Records of the previous process should be applied first")
+}
+
+func TestTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	l, err := wal.Open(dir, wal.SYNC_ALWAYS)
+	if err != nil {
+		t.Fatalf("Error opening log. %v", err)
+	}
+	l.Append([]byte("a"))
+	l.Close()
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"))
+	// a crash while writing leaves a record without its line break
+	file, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("Error opening segment. %v", err)
+	}
+	file.Write([]byte("tor"))
+	file.Close()
+	assert.Equal(t, []string{"a"}, readAll(t, segments))
+}
+
+func TestUnknownSync(t *testing.T) {
+	_, err := wal.Open(t.TempDir(), "never")
+	assert.ErrorIs(t, err, wal.ErrUnknownSync)
+}
@@ -0,0 +1,12 @@
+package proto
+
+import (
+	// embeds the OpenAPI document
+	_ "embed"
+)
+
+// OpenAPI v2 document of the HTTP routes, generated from the annotations of vote.proto by
+// protoc-gen-openapiv2. Regenerate it with make whenever vote.proto changes
+//
+//go:embed vote.swagger.json
+var OpenAPI []byte
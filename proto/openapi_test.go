@@ -0,0 +1,142 @@
+package proto_test
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	pb "github.com/IsaqueB/ps-klever/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type openAPIParameter struct {
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+type openAPIOperation struct {
+	OperationID string             `json:"operationId"`
+	Parameters  []openAPIParameter `json:"parameters"`
+}
+
+type openAPIDefinition struct {
+	Properties map[string]interface{} `json:"properties"`
+	Enum       []string               `json:"enum"`
+}
+
+type openAPI struct {
+	Paths       map[string]map[string]openAPIOperation `json:"paths"`
+	Definitions map[string]openAPIDefinition           `json:"definitions"`
+}
+
+// Method and path of the HTTP route of an RPC, if it has one
+func httpRoute(method protoreflect.MethodDescriptor) (string, string, string, bool) {
+	rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return "", "", "", false
+	}
+	switch pattern := rule.Pattern.(type) {
+	case *annotations.HttpRule_Get:
+		return "get", pattern.Get, rule.Body, true
+	case *annotations.HttpRule_Post:
+		return "post", pattern.Post, rule.Body, true
+	case *annotations.HttpRule_Put:
+		return "put", pattern.Put, rule.Body, true
+	case *annotations.HttpRule_Delete:
+		return "delete", pattern.Delete, rule.Body, true
+	case *annotations.HttpRule_Patch:
+		return "patch", pattern.Patch, rule.Body, true
+	}
+	return "", "", "", false
+}
+
+func jsonNames(fields protoreflect.FieldDescriptors) []string {
+	var names []string
+	for i := 0; i < fields.Len(); i++ {
+		names = append(names, fields.Get(i).JSONName())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func loadOpenAPI(t *testing.T) openAPI {
+	var spec openAPI
+	if err := json.Unmarshal(pb.OpenAPI, &spec); err != nil {
+		t.Fatalf("Error decoding the OpenAPI document. %v", err)
+	}
+	return spec
+}
+
+// Fails if a route was added, changed or removed in vote.proto without regenerating the document
+func TestOpenAPIRoutes(t *testing.T) {
+	spec := loadOpenAPI(t)
+	routes := 0
+	services := pb.File_proto_vote_proto.Services()
+	for i := 0; i < services.Len(); i++ {
+		service := services.Get(i)
+		methods := service.Methods()
+		for j := 0; j < methods.Len(); j++ {
+			method := methods.Get(j)
+			verb, path, body, ok := httpRoute(method)
+			if !ok {
+				continue
+			}
+			routes++
+			operation, ok := spec.Paths[path][verb]
+			if !assert.True(t, ok, "%s %s of %s is missing", verb, path, method.FullName()) {
+				continue
+			}
+			assert.Equal(t, string(service.Name())+"_"+string(method.Name()), operation.OperationID, "%s %s", verb, path)
+			if body != "" {
+				continue
+			}
+			// without a body, every field of the request is a path or query parameter
+			var parameters []string
+			for _, parameter := range operation.Parameters {
+				parameters = append(parameters, parameter.Name)
+			}
+			sort.Strings(parameters)
+			assert.Equal(t, jsonNames(method.Input().Fields()), parameters, "Parameters of %s %s", verb, path)
+		}
+	}
+	operations := 0
+	for _, verbs := range spec.Paths {
+		operations += len(verbs)
+	}
+	assert.Equal(t, routes, operations, "The document should not have routes which were removed")
+}
+
+// Fails if a message or enum of the document differs from vote.proto
+func TestOpenAPIDefinitions(t *testing.T) {
+	spec := loadOpenAPI(t)
+	file := pb.File_proto_vote_proto
+	for name, definition := range spec.Definitions {
+		// definitions of other packages, such as google.rpc.Status, are named after them
+		if !strings.HasPrefix(name, "proto") || strings.HasPrefix(name, "protobuf") {
+			continue
+		}
+		name = strings.TrimPrefix(name, "proto")
+		if message := file.Messages().ByName(protoreflect.Name(name)); message != nil {
+			var properties []string
+			for property := range definition.Properties {
+				properties = append(properties, property)
+			}
+			sort.Strings(properties)
+			assert.Equal(t, jsonNames(message.Fields()), properties, "Fields of %s", name)
+			continue
+		}
+		if enum := file.Enums().ByName(protoreflect.Name(name)); enum != nil {
+			var values []string
+			for i := 0; i < enum.Values().Len(); i++ {
+				values = append(values, string(enum.Values().Get(i).Name()))
+			}
+			assert.Equal(t, values, definition.Enum, "Values of %s", name)
+			continue
+		}
+		t.Errorf("%s is not in vote.proto anymore", name)
+	}
+}
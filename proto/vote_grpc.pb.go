@@ -22,12 +22,25 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type VoteClient interface {
+	CastVote(ctx context.Context, in *CastVoteRequest, opts ...grpc.CallOption) (*CastVoteResponse, error)
 	ListVotesInVideo(ctx context.Context, in *ListVotesInVideoRequest, opts ...grpc.CallOption) (*ListVotesInVideoResponse, error)
 	ListVotesOfUser(ctx context.Context, in *ListVotesOfUserRequest, opts ...grpc.CallOption) (*ListVotesOfUserResponse, error)
 	Insert(ctx context.Context, in *InsertRequest, opts ...grpc.CallOption) (*InsertResponse, error)
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	UpdateOne(ctx context.Context, in *UpdateOneRequest, opts ...grpc.CallOption) (*UpdateOneResponse, error)
 	DeleteOne(ctx context.Context, in *DeleteOneRequest, opts ...grpc.CallOption) (*DeleteOneResponse, error)
+	BatchInsert(ctx context.Context, in *BatchInsertRequest, opts ...grpc.CallOption) (*BatchInsertResponse, error)
+	BatchUpdate(ctx context.Context, in *BatchUpdateRequest, opts ...grpc.CallOption) (*BatchUpdateResponse, error)
+	BatchDelete(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchDeleteResponse, error)
+	GetUserVoteOnVideo(ctx context.Context, in *GetUserVoteOnVideoRequest, opts ...grpc.CallOption) (*GetUserVoteOnVideoResponse, error)
+	GetUserVotesOnVideos(ctx context.Context, in *GetUserVotesOnVideosRequest, opts ...grpc.CallOption) (*GetUserVotesOnVideosResponse, error)
+	BatchGetVideoTallies(ctx context.Context, in *BatchGetVideoTalliesRequest, opts ...grpc.CallOption) (*BatchGetVideoTalliesResponse, error)
+	IngestVotes(ctx context.Context, opts ...grpc.CallOption) (Vote_IngestVotesClient, error)
+	// Served over HTTP by GET /v1/export, which streams the file
+	ExportVotes(ctx context.Context, in *ExportVotesRequest, opts ...grpc.CallOption) (Vote_ExportVotesClient, error)
+	// Receives a file of votes and imports the ones of users without a vote on the video, or with a
+	// different one. Importing the same file again changes nothing
+	ImportVotes(ctx context.Context, opts ...grpc.CallOption) (Vote_ImportVotesClient, error)
 }
 
 type voteClient struct {
@@ -38,6 +51,15 @@ func NewVoteClient(cc grpc.ClientConnInterface) VoteClient {
 	return &voteClient{cc}
 }
 
+func (c *voteClient) CastVote(ctx context.Context, in *CastVoteRequest, opts ...grpc.CallOption) (*CastVoteResponse, error) {
+	out := new(CastVoteResponse)
+	err := c.cc.Invoke(ctx, "/proto.Vote/CastVote", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *voteClient) ListVotesInVideo(ctx context.Context, in *ListVotesInVideoRequest, opts ...grpc.CallOption) (*ListVotesInVideoResponse, error) {
 	out := new(ListVotesInVideoResponse)
 	err := c.cc.Invoke(ctx, "/proto.Vote/ListVotesInVideo", in, out, opts...)
@@ -92,16 +114,180 @@ func (c *voteClient) DeleteOne(ctx context.Context, in *DeleteOneRequest, opts .
 	return out, nil
 }
 
+func (c *voteClient) BatchInsert(ctx context.Context, in *BatchInsertRequest, opts ...grpc.CallOption) (*BatchInsertResponse, error) {
+	out := new(BatchInsertResponse)
+	err := c.cc.Invoke(ctx, "/proto.Vote/BatchInsert", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *voteClient) BatchUpdate(ctx context.Context, in *BatchUpdateRequest, opts ...grpc.CallOption) (*BatchUpdateResponse, error) {
+	out := new(BatchUpdateResponse)
+	err := c.cc.Invoke(ctx, "/proto.Vote/BatchUpdate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *voteClient) BatchDelete(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchDeleteResponse, error) {
+	out := new(BatchDeleteResponse)
+	err := c.cc.Invoke(ctx, "/proto.Vote/BatchDelete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *voteClient) GetUserVoteOnVideo(ctx context.Context, in *GetUserVoteOnVideoRequest, opts ...grpc.CallOption) (*GetUserVoteOnVideoResponse, error) {
+	out := new(GetUserVoteOnVideoResponse)
+	err := c.cc.Invoke(ctx, "/proto.Vote/GetUserVoteOnVideo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *voteClient) GetUserVotesOnVideos(ctx context.Context, in *GetUserVotesOnVideosRequest, opts ...grpc.CallOption) (*GetUserVotesOnVideosResponse, error) {
+	out := new(GetUserVotesOnVideosResponse)
+	err := c.cc.Invoke(ctx, "/proto.Vote/GetUserVotesOnVideos", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *voteClient) BatchGetVideoTallies(ctx context.Context, in *BatchGetVideoTalliesRequest, opts ...grpc.CallOption) (*BatchGetVideoTalliesResponse, error) {
+	out := new(BatchGetVideoTalliesResponse)
+	err := c.cc.Invoke(ctx, "/proto.Vote/BatchGetVideoTallies", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *voteClient) IngestVotes(ctx context.Context, opts ...grpc.CallOption) (Vote_IngestVotesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Vote_ServiceDesc.Streams[0], "/proto.Vote/IngestVotes", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &voteIngestVotesClient{stream}
+	return x, nil
+}
+
+type Vote_IngestVotesClient interface {
+	Send(*IngestVotesRequest) error
+	CloseAndRecv() (*IngestVotesResponse, error)
+	grpc.ClientStream
+}
+
+type voteIngestVotesClient struct {
+	grpc.ClientStream
+}
+
+func (x *voteIngestVotesClient) Send(m *IngestVotesRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *voteIngestVotesClient) CloseAndRecv() (*IngestVotesResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(IngestVotesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *voteClient) ExportVotes(ctx context.Context, in *ExportVotesRequest, opts ...grpc.CallOption) (Vote_ExportVotesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Vote_ServiceDesc.Streams[1], "/proto.Vote/ExportVotes", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &voteExportVotesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Vote_ExportVotesClient interface {
+	Recv() (*ExportVotesResponse, error)
+	grpc.ClientStream
+}
+
+type voteExportVotesClient struct {
+	grpc.ClientStream
+}
+
+func (x *voteExportVotesClient) Recv() (*ExportVotesResponse, error) {
+	m := new(ExportVotesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *voteClient) ImportVotes(ctx context.Context, opts ...grpc.CallOption) (Vote_ImportVotesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Vote_ServiceDesc.Streams[2], "/proto.Vote/ImportVotes", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &voteImportVotesClient{stream}
+	return x, nil
+}
+
+type Vote_ImportVotesClient interface {
+	Send(*ImportVotesRequest) error
+	Recv() (*ImportVotesResponse, error)
+	grpc.ClientStream
+}
+
+type voteImportVotesClient struct {
+	grpc.ClientStream
+}
+
+func (x *voteImportVotesClient) Send(m *ImportVotesRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *voteImportVotesClient) Recv() (*ImportVotesResponse, error) {
+	m := new(ImportVotesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // VoteServer is the server API for Vote service.
 // All implementations must embed UnimplementedVoteServer
 // for forward compatibility
 type VoteServer interface {
+	CastVote(context.Context, *CastVoteRequest) (*CastVoteResponse, error)
 	ListVotesInVideo(context.Context, *ListVotesInVideoRequest) (*ListVotesInVideoResponse, error)
 	ListVotesOfUser(context.Context, *ListVotesOfUserRequest) (*ListVotesOfUserResponse, error)
 	Insert(context.Context, *InsertRequest) (*InsertResponse, error)
 	Get(context.Context, *GetRequest) (*GetResponse, error)
 	UpdateOne(context.Context, *UpdateOneRequest) (*UpdateOneResponse, error)
 	DeleteOne(context.Context, *DeleteOneRequest) (*DeleteOneResponse, error)
+	BatchInsert(context.Context, *BatchInsertRequest) (*BatchInsertResponse, error)
+	BatchUpdate(context.Context, *BatchUpdateRequest) (*BatchUpdateResponse, error)
+	BatchDelete(context.Context, *BatchDeleteRequest) (*BatchDeleteResponse, error)
+	GetUserVoteOnVideo(context.Context, *GetUserVoteOnVideoRequest) (*GetUserVoteOnVideoResponse, error)
+	GetUserVotesOnVideos(context.Context, *GetUserVotesOnVideosRequest) (*GetUserVotesOnVideosResponse, error)
+	BatchGetVideoTallies(context.Context, *BatchGetVideoTalliesRequest) (*BatchGetVideoTalliesResponse, error)
+	IngestVotes(Vote_IngestVotesServer) error
+	// Served over HTTP by GET /v1/export, which streams the file
+	ExportVotes(*ExportVotesRequest, Vote_ExportVotesServer) error
+	// Receives a file of votes and imports the ones of users without a vote on the video, or with a
+	// different one. Importing the same file again changes nothing
+	ImportVotes(Vote_ImportVotesServer) error
 	mustEmbedUnimplementedVoteServer()
 }
 
@@ -109,6 +295,9 @@ type VoteServer interface {
 type UnimplementedVoteServer struct {
 }
 
+func (UnimplementedVoteServer) CastVote(context.Context, *CastVoteRequest) (*CastVoteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CastVote not implemented")
+}
 func (UnimplementedVoteServer) ListVotesInVideo(context.Context, *ListVotesInVideoRequest) (*ListVotesInVideoResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListVotesInVideo not implemented")
 }
@@ -127,6 +316,33 @@ func (UnimplementedVoteServer) UpdateOne(context.Context, *UpdateOneRequest) (*U
 func (UnimplementedVoteServer) DeleteOne(context.Context, *DeleteOneRequest) (*DeleteOneResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteOne not implemented")
 }
+func (UnimplementedVoteServer) BatchInsert(context.Context, *BatchInsertRequest) (*BatchInsertResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchInsert not implemented")
+}
+func (UnimplementedVoteServer) BatchUpdate(context.Context, *BatchUpdateRequest) (*BatchUpdateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchUpdate not implemented")
+}
+func (UnimplementedVoteServer) BatchDelete(context.Context, *BatchDeleteRequest) (*BatchDeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchDelete not implemented")
+}
+func (UnimplementedVoteServer) GetUserVoteOnVideo(context.Context, *GetUserVoteOnVideoRequest) (*GetUserVoteOnVideoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserVoteOnVideo not implemented")
+}
+func (UnimplementedVoteServer) GetUserVotesOnVideos(context.Context, *GetUserVotesOnVideosRequest) (*GetUserVotesOnVideosResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserVotesOnVideos not implemented")
+}
+func (UnimplementedVoteServer) BatchGetVideoTallies(context.Context, *BatchGetVideoTalliesRequest) (*BatchGetVideoTalliesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetVideoTallies not implemented")
+}
+func (UnimplementedVoteServer) IngestVotes(Vote_IngestVotesServer) error {
+	return status.Errorf(codes.Unimplemented, "method IngestVotes not implemented")
+}
+func (UnimplementedVoteServer) ExportVotes(*ExportVotesRequest, Vote_ExportVotesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportVotes not implemented")
+}
+func (UnimplementedVoteServer) ImportVotes(Vote_ImportVotesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ImportVotes not implemented")
+}
 func (UnimplementedVoteServer) mustEmbedUnimplementedVoteServer() {}
 
 // UnsafeVoteServer may be embedded to opt out of forward compatibility for this service.
@@ -140,6 +356,24 @@ func RegisterVoteServer(s grpc.ServiceRegistrar, srv VoteServer) {
 	s.RegisterService(&Vote_ServiceDesc, srv)
 }
 
+func _Vote_CastVote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CastVoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VoteServer).CastVote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Vote/CastVote",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VoteServer).CastVote(ctx, req.(*CastVoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Vote_ListVotesInVideo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ListVotesInVideoRequest)
 	if err := dec(in); err != nil {
@@ -248,6 +482,187 @@ func _Vote_DeleteOne_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Vote_BatchInsert_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchInsertRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VoteServer).BatchInsert(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Vote/BatchInsert",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VoteServer).BatchInsert(ctx, req.(*BatchInsertRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Vote_BatchUpdate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchUpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VoteServer).BatchUpdate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Vote/BatchUpdate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VoteServer).BatchUpdate(ctx, req.(*BatchUpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Vote_BatchDelete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchDeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VoteServer).BatchDelete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Vote/BatchDelete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VoteServer).BatchDelete(ctx, req.(*BatchDeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Vote_GetUserVoteOnVideo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserVoteOnVideoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VoteServer).GetUserVoteOnVideo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Vote/GetUserVoteOnVideo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VoteServer).GetUserVoteOnVideo(ctx, req.(*GetUserVoteOnVideoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Vote_GetUserVotesOnVideos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserVotesOnVideosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VoteServer).GetUserVotesOnVideos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Vote/GetUserVotesOnVideos",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VoteServer).GetUserVotesOnVideos(ctx, req.(*GetUserVotesOnVideosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Vote_BatchGetVideoTallies_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetVideoTalliesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VoteServer).BatchGetVideoTallies(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Vote/BatchGetVideoTallies",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VoteServer).BatchGetVideoTallies(ctx, req.(*BatchGetVideoTalliesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Vote_IngestVotes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(VoteServer).IngestVotes(&voteIngestVotesServer{stream})
+}
+
+type Vote_IngestVotesServer interface {
+	SendAndClose(*IngestVotesResponse) error
+	Recv() (*IngestVotesRequest, error)
+	grpc.ServerStream
+}
+
+type voteIngestVotesServer struct {
+	grpc.ServerStream
+}
+
+func (x *voteIngestVotesServer) SendAndClose(m *IngestVotesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *voteIngestVotesServer) Recv() (*IngestVotesRequest, error) {
+	m := new(IngestVotesRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Vote_ExportVotes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportVotesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VoteServer).ExportVotes(m, &voteExportVotesServer{stream})
+}
+
+type Vote_ExportVotesServer interface {
+	Send(*ExportVotesResponse) error
+	grpc.ServerStream
+}
+
+type voteExportVotesServer struct {
+	grpc.ServerStream
+}
+
+func (x *voteExportVotesServer) Send(m *ExportVotesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Vote_ImportVotes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(VoteServer).ImportVotes(&voteImportVotesServer{stream})
+}
+
+type Vote_ImportVotesServer interface {
+	Send(*ImportVotesResponse) error
+	Recv() (*ImportVotesRequest, error)
+	grpc.ServerStream
+}
+
+type voteImportVotesServer struct {
+	grpc.ServerStream
+}
+
+func (x *voteImportVotesServer) Send(m *ImportVotesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *voteImportVotesServer) Recv() (*ImportVotesRequest, error) {
+	m := new(ImportVotesRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Vote_ServiceDesc is the grpc.ServiceDesc for Vote service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -255,6 +670,10 @@ var Vote_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.Vote",
 	HandlerType: (*VoteServer)(nil),
 	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CastVote",
+			Handler:    _Vote_CastVote_Handler,
+		},
 		{
 			MethodName: "ListVotesInVideo",
 			Handler:    _Vote_ListVotesInVideo_Handler,
@@ -279,6 +698,529 @@ var Vote_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteOne",
 			Handler:    _Vote_DeleteOne_Handler,
 		},
+		{
+			MethodName: "BatchInsert",
+			Handler:    _Vote_BatchInsert_Handler,
+		},
+		{
+			MethodName: "BatchUpdate",
+			Handler:    _Vote_BatchUpdate_Handler,
+		},
+		{
+			MethodName: "BatchDelete",
+			Handler:    _Vote_BatchDelete_Handler,
+		},
+		{
+			MethodName: "GetUserVoteOnVideo",
+			Handler:    _Vote_GetUserVoteOnVideo_Handler,
+		},
+		{
+			MethodName: "GetUserVotesOnVideos",
+			Handler:    _Vote_GetUserVotesOnVideos_Handler,
+		},
+		{
+			MethodName: "BatchGetVideoTallies",
+			Handler:    _Vote_BatchGetVideoTallies_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "IngestVotes",
+			Handler:       _Vote_IngestVotes_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ExportVotes",
+			Handler:       _Vote_ExportVotes_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportVotes",
+			Handler:       _Vote_ImportVotes_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/vote.proto",
+}
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	RestoreVote(ctx context.Context, in *RestoreVoteRequest, opts ...grpc.CallOption) (*RestoreVoteResponse, error)
+	ListVotes(ctx context.Context, in *ListVotesRequest, opts ...grpc.CallOption) (*ListVotesResponse, error)
+	GetCacheStats(ctx context.Context, in *GetCacheStatsRequest, opts ...grpc.CallOption) (*GetCacheStatsResponse, error)
+	GetWriteBehindStats(ctx context.Context, in *GetWriteBehindStatsRequest, opts ...grpc.CallOption) (*GetWriteBehindStatsResponse, error)
+	ModerateVotes(ctx context.Context, in *ModerateVotesRequest, opts ...grpc.CallOption) (*ModerateVotesResponse, error)
+	GetModerationJob(ctx context.Context, in *GetModerationJobRequest, opts ...grpc.CallOption) (*GetModerationJobResponse, error)
+	ListAuditEntries(ctx context.Context, in *ListAuditEntriesRequest, opts ...grpc.CallOption) (*ListAuditEntriesResponse, error)
+	BanUser(ctx context.Context, in *BanUserRequest, opts ...grpc.CallOption) (*BanUserResponse, error)
+	UnbanUser(ctx context.Context, in *UnbanUserRequest, opts ...grpc.CallOption) (*UnbanUserResponse, error)
+	ListBans(ctx context.Context, in *ListBansRequest, opts ...grpc.CallOption) (*ListBansResponse, error)
+	GetFaultInjection(ctx context.Context, in *GetFaultInjectionRequest, opts ...grpc.CallOption) (*GetFaultInjectionResponse, error)
+	SetFaultInjection(ctx context.Context, in *SetFaultInjectionRequest, opts ...grpc.CallOption) (*SetFaultInjectionResponse, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) RestoreVote(ctx context.Context, in *RestoreVoteRequest, opts ...grpc.CallOption) (*RestoreVoteResponse, error) {
+	out := new(RestoreVoteResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/RestoreVote", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListVotes(ctx context.Context, in *ListVotesRequest, opts ...grpc.CallOption) (*ListVotesResponse, error) {
+	out := new(ListVotesResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/ListVotes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetCacheStats(ctx context.Context, in *GetCacheStatsRequest, opts ...grpc.CallOption) (*GetCacheStatsResponse, error) {
+	out := new(GetCacheStatsResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/GetCacheStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetWriteBehindStats(ctx context.Context, in *GetWriteBehindStatsRequest, opts ...grpc.CallOption) (*GetWriteBehindStatsResponse, error) {
+	out := new(GetWriteBehindStatsResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/GetWriteBehindStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ModerateVotes(ctx context.Context, in *ModerateVotesRequest, opts ...grpc.CallOption) (*ModerateVotesResponse, error) {
+	out := new(ModerateVotesResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/ModerateVotes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetModerationJob(ctx context.Context, in *GetModerationJobRequest, opts ...grpc.CallOption) (*GetModerationJobResponse, error) {
+	out := new(GetModerationJobResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/GetModerationJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListAuditEntries(ctx context.Context, in *ListAuditEntriesRequest, opts ...grpc.CallOption) (*ListAuditEntriesResponse, error) {
+	out := new(ListAuditEntriesResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/ListAuditEntries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) BanUser(ctx context.Context, in *BanUserRequest, opts ...grpc.CallOption) (*BanUserResponse, error) {
+	out := new(BanUserResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/BanUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) UnbanUser(ctx context.Context, in *UnbanUserRequest, opts ...grpc.CallOption) (*UnbanUserResponse, error) {
+	out := new(UnbanUserResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/UnbanUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListBans(ctx context.Context, in *ListBansRequest, opts ...grpc.CallOption) (*ListBansResponse, error) {
+	out := new(ListBansResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/ListBans", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetFaultInjection(ctx context.Context, in *GetFaultInjectionRequest, opts ...grpc.CallOption) (*GetFaultInjectionResponse, error) {
+	out := new(GetFaultInjectionResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/GetFaultInjection", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetFaultInjection(ctx context.Context, in *SetFaultInjectionRequest, opts ...grpc.CallOption) (*SetFaultInjectionResponse, error) {
+	out := new(SetFaultInjectionResponse)
+	err := c.cc.Invoke(ctx, "/proto.Admin/SetFaultInjection", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	RestoreVote(context.Context, *RestoreVoteRequest) (*RestoreVoteResponse, error)
+	ListVotes(context.Context, *ListVotesRequest) (*ListVotesResponse, error)
+	GetCacheStats(context.Context, *GetCacheStatsRequest) (*GetCacheStatsResponse, error)
+	GetWriteBehindStats(context.Context, *GetWriteBehindStatsRequest) (*GetWriteBehindStatsResponse, error)
+	ModerateVotes(context.Context, *ModerateVotesRequest) (*ModerateVotesResponse, error)
+	GetModerationJob(context.Context, *GetModerationJobRequest) (*GetModerationJobResponse, error)
+	ListAuditEntries(context.Context, *ListAuditEntriesRequest) (*ListAuditEntriesResponse, error)
+	BanUser(context.Context, *BanUserRequest) (*BanUserResponse, error)
+	UnbanUser(context.Context, *UnbanUserRequest) (*UnbanUserResponse, error)
+	ListBans(context.Context, *ListBansRequest) (*ListBansResponse, error)
+	GetFaultInjection(context.Context, *GetFaultInjectionRequest) (*GetFaultInjectionResponse, error)
+	SetFaultInjection(context.Context, *SetFaultInjectionRequest) (*SetFaultInjectionResponse, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) RestoreVote(context.Context, *RestoreVoteRequest) (*RestoreVoteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreVote not implemented")
+}
+func (UnimplementedAdminServer) ListVotes(context.Context, *ListVotesRequest) (*ListVotesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVotes not implemented")
+}
+func (UnimplementedAdminServer) GetCacheStats(context.Context, *GetCacheStatsRequest) (*GetCacheStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCacheStats not implemented")
+}
+func (UnimplementedAdminServer) GetWriteBehindStats(context.Context, *GetWriteBehindStatsRequest) (*GetWriteBehindStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWriteBehindStats not implemented")
+}
+func (UnimplementedAdminServer) ModerateVotes(context.Context, *ModerateVotesRequest) (*ModerateVotesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ModerateVotes not implemented")
+}
+func (UnimplementedAdminServer) GetModerationJob(context.Context, *GetModerationJobRequest) (*GetModerationJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetModerationJob not implemented")
+}
+func (UnimplementedAdminServer) ListAuditEntries(context.Context, *ListAuditEntriesRequest) (*ListAuditEntriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuditEntries not implemented")
+}
+func (UnimplementedAdminServer) BanUser(context.Context, *BanUserRequest) (*BanUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BanUser not implemented")
+}
+func (UnimplementedAdminServer) UnbanUser(context.Context, *UnbanUserRequest) (*UnbanUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnbanUser not implemented")
+}
+func (UnimplementedAdminServer) ListBans(context.Context, *ListBansRequest) (*ListBansResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBans not implemented")
+}
+func (UnimplementedAdminServer) GetFaultInjection(context.Context, *GetFaultInjectionRequest) (*GetFaultInjectionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFaultInjection not implemented")
+}
+func (UnimplementedAdminServer) SetFaultInjection(context.Context, *SetFaultInjectionRequest) (*SetFaultInjectionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetFaultInjection not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_RestoreVote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreVoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RestoreVote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/RestoreVote",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RestoreVote(ctx, req.(*RestoreVoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListVotes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVotesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListVotes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/ListVotes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListVotes(ctx, req.(*ListVotesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetCacheStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCacheStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetCacheStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/GetCacheStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetCacheStats(ctx, req.(*GetCacheStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetWriteBehindStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetWriteBehindStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetWriteBehindStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/GetWriteBehindStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetWriteBehindStats(ctx, req.(*GetWriteBehindStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ModerateVotes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModerateVotesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ModerateVotes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/ModerateVotes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ModerateVotes(ctx, req.(*ModerateVotesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetModerationJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetModerationJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetModerationJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/GetModerationJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetModerationJob(ctx, req.(*GetModerationJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListAuditEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAuditEntriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListAuditEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/ListAuditEntries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListAuditEntries(ctx, req.(*ListAuditEntriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_BanUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BanUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).BanUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/BanUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).BanUser(ctx, req.(*BanUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_UnbanUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnbanUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).UnbanUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/UnbanUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).UnbanUser(ctx, req.(*UnbanUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListBans_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBansRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListBans(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/ListBans",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListBans(ctx, req.(*ListBansRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetFaultInjection_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetFaultInjectionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetFaultInjection(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/GetFaultInjection",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetFaultInjection(ctx, req.(*GetFaultInjectionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetFaultInjection_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetFaultInjectionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetFaultInjection(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/SetFaultInjection",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetFaultInjection(ctx, req.(*SetFaultInjectionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RestoreVote",
+			Handler:    _Admin_RestoreVote_Handler,
+		},
+		{
+			MethodName: "ListVotes",
+			Handler:    _Admin_ListVotes_Handler,
+		},
+		{
+			MethodName: "GetCacheStats",
+			Handler:    _Admin_GetCacheStats_Handler,
+		},
+		{
+			MethodName: "GetWriteBehindStats",
+			Handler:    _Admin_GetWriteBehindStats_Handler,
+		},
+		{
+			MethodName: "ModerateVotes",
+			Handler:    _Admin_ModerateVotes_Handler,
+		},
+		{
+			MethodName: "GetModerationJob",
+			Handler:    _Admin_GetModerationJob_Handler,
+		},
+		{
+			MethodName: "ListAuditEntries",
+			Handler:    _Admin_ListAuditEntries_Handler,
+		},
+		{
+			MethodName: "BanUser",
+			Handler:    _Admin_BanUser_Handler,
+		},
+		{
+			MethodName: "UnbanUser",
+			Handler:    _Admin_UnbanUser_Handler,
+		},
+		{
+			MethodName: "ListBans",
+			Handler:    _Admin_ListBans_Handler,
+		},
+		{
+			MethodName: "GetFaultInjection",
+			Handler:    _Admin_GetFaultInjection_Handler,
+		},
+		{
+			MethodName: "SetFaultInjection",
+			Handler:    _Admin_SetFaultInjection_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/vote.proto",